@@ -0,0 +1,34 @@
+// Command migrate-media copies product images from a local directory into the
+// media storage configured by MEDIA_STORAGE and the S3_* variables.
+//
+//	MEDIA_STORAGE=s3 S3_ENDPOINT=localhost:9000 S3_BUCKET=media S3_USE_SSL=false \
+//	S3_ACCESS_KEY=... S3_SECRET_KEY=... go run ./cmd/migrate-media -from static/img
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/nathanialw/ecommerce/internal/storage"
+	"github.com/nathanialw/ecommerce/pkg/manage"
+)
+
+func main() {
+	fromDir := flag.String("from", "static/img", "directory to copy images from")
+	remove := flag.Bool("delete", false, "delete each file from the directory once copied")
+	flag.Parse()
+
+	to, err := storage.New(storage.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to open media storage: %v", err)
+	}
+	if local, ok := to.(*storage.Local); ok && local.Dir == *fromDir {
+		log.Fatalf("Media storage is already %s; set MEDIA_STORAGE to where the files should go", *fromDir)
+	}
+
+	from := storage.NewLocal(*fromDir, "")
+	if err := manage.MigrateMedia(context.Background(), from, to, *remove); err != nil {
+		log.Fatalf("Media migration failed: %v", err)
+	}
+}
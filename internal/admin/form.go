@@ -0,0 +1,325 @@
+package admin
+
+import (
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/images"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/barcode"
+	"github.com/nathanialw/ecommerce/pkg/isbn"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// ProductForm is the add or edit product form bound to a product, with what
+// is wrong with it.
+type ProductForm struct {
+	Product models.Product
+	// Uploads holds the new image chosen for a variant, by variant index
+	Uploads map[int]*multipart.FileHeader
+	Errors  models.FieldErrors
+	// keepCodes is set when the form has no sku or barcode fields, so the
+	// variants' stored ones are kept
+	keepCodes bool
+}
+
+// BindProductForm reads the product form from a parsed multipart request.
+// Every field is checked and each problem recorded against its field, so the
+// form can be shown again with all of them marked. Rows of variant fields
+// that are short of values are treated as blank, never out of range.
+func BindProductForm(r *http.Request) *ProductForm {
+	f := &ProductForm{
+		Uploads: make(map[int]*multipart.FileHeader),
+		Errors:  models.FieldErrors{},
+	}
+	p := &f.Product
+
+	p.ID = f.count("id", r.FormValue("id"))
+	if p.ID != 0 {
+		if p.Version = f.count("version", r.FormValue("version")); p.Version == 0 {
+			f.Errors.Add("version", "The form is out of date; reload the page")
+		}
+	}
+
+	p.Title = strings.TrimSpace(r.FormValue("title"))
+	if p.Title == "" {
+		f.Errors.Add("title", "Enter a title")
+	}
+	p.Author = strings.TrimSpace(r.FormValue("author"))
+	p.Description = strings.TrimSpace(r.FormValue("description"))
+
+	p.ProductType = r.FormValue("product_type")
+	switch p.ProductType {
+	case "":
+		p.ProductType = models.ProductTypeBook
+	case models.ProductTypeBook, models.ProductTypeGiftCard:
+	default:
+		f.Errors.Add("product_type", "Choose a product type")
+	}
+
+	f.bindPublication(r)
+	f.bindBookDetails(r)
+	f.bindContributors(r)
+	f.bindTaxonomy(r)
+	f.bindVariants(r)
+	return f
+}
+
+// bindPublication reads the status and publish_at fields. A new product is a
+// draft unless the form says otherwise, and a scheduled one needs a time to
+// be published at, entered in the server's time zone.
+func (f *ProductForm) bindPublication(r *http.Request) {
+	p := &f.Product
+	p.Status = r.FormValue("status")
+	if p.Status == "" && p.ID == 0 {
+		p.Status = models.StatusDraft
+	}
+	if !slices.Contains(models.PublicationStatuses, p.Status) {
+		f.Errors.Add("status", "Choose a status")
+	}
+
+	if v := strings.TrimSpace(r.FormValue("publish_at")); v != "" {
+		when, err := time.ParseInLocation("2006-01-02T15:04", v, time.Local)
+		if err != nil {
+			f.Errors.Add("publish_at", "Enter a date and time such as 2024-03-15T09:00")
+		} else {
+			p.PublishAt = &when
+		}
+	}
+	if p.Status == models.StatusScheduled && p.PublishAt == nil && !f.Errors.Has("publish_at") {
+		f.Errors.Add("publish_at", "Choose when to publish")
+	}
+}
+
+// bindBookDetails reads the publisher, publication date, language, page
+// count and series fields.
+func (f *ProductForm) bindBookDetails(r *http.Request) {
+	p := &f.Product
+	p.Publisher = strings.TrimSpace(r.FormValue("publisher"))
+	p.Series = strings.TrimSpace(r.FormValue("series"))
+	p.Language = strings.ToLower(strings.TrimSpace(r.FormValue("language")))
+	if p.Language == "" {
+		p.Language = "en"
+	}
+
+	if v := strings.TrimSpace(r.FormValue("publication_date")); v != "" {
+		date, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			f.Errors.Add("publication_date", "Enter a date such as 2024-03-15")
+		} else {
+			p.PublicationDate = &date
+		}
+	}
+	p.PageCount = f.count("page_count", r.FormValue("page_count"))
+	p.SeriesVolume = f.count("series_volume", r.FormValue("series_volume"))
+}
+
+// bindContributors reads the contributor_name and contributor_role lists. A
+// form without them falls back to its single author field.
+func (f *ProductForm) bindContributors(r *http.Request) {
+	names := r.Form["contributor_name"]
+	roles := r.Form["contributor_role"]
+	for i := range max(len(names), len(roles)) {
+		name := strings.TrimSpace(at(names, i))
+		if name == "" {
+			continue
+		}
+		role := at(roles, i)
+		if !slices.Contains(models.ContributorRoles, role) {
+			f.Errors.Add(fmt.Sprintf("contributor_role[%d]", i), "Choose a role")
+			continue
+		}
+		f.Product.Contributors = append(f.Product.Contributors, models.Contributor{Name: name, Role: role})
+	}
+
+	if len(f.Product.Contributors) == 0 && f.Product.Author != "" {
+		f.Product.Contributors = []models.Contributor{{Name: f.Product.Author, Role: models.RoleAuthor}}
+	}
+}
+
+// bindTaxonomy reads the category_id list and the comma-separated tags field.
+func (f *ProductForm) bindTaxonomy(r *http.Request) {
+	for _, v := range r.Form["category_id"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			f.Errors.Add("category_id", "Choose categories from the list")
+			continue
+		}
+		f.Product.Categories = append(f.Product.Categories, models.Category{ID: id})
+	}
+	for _, tag := range strings.Split(r.FormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			f.Product.Tags = append(f.Product.Tags, models.Tag{Name: tag})
+		}
+	}
+}
+
+// bindVariants reads one variant per format field, with its codes, stock and
+// prices. Each variant's image is the variant_image[i] upload, the i-th of a
+// plain variant_image list with one file per variant, or the
+// existing_image_path it already had.
+func (f *ProductForm) bindVariants(r *http.Request) {
+	formats := r.Form["format"]
+	if len(formats) == 0 {
+		f.Errors.Add("variants", "Add at least one format")
+		return
+	}
+
+	var uploads []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		uploads = r.MultipartForm.File["variant_image"]
+	}
+	if len(uploads) > 0 && len(uploads) != len(formats) {
+		f.Errors.Add("variant_image", "Upload one image for each format, or none")
+		uploads = nil
+	}
+
+	_, hasSKUs := r.Form["sku"]
+	_, hasBarcodes := r.Form["barcode"]
+	f.keepCodes = !hasSKUs && !hasBarcodes
+
+	isbns := make(map[string]int)
+	codes := make(map[string]int)
+	for i := range formats {
+		field := func(name string) string { return fmt.Sprintf("%s[%d]", name, i) }
+		v := models.Variant{ImagePath: at(r.Form["existing_image_path"], i)}
+
+		switch id := at(r.Form["variant_id"], i); id {
+		case "", "new":
+		default:
+			if v.ID = f.count(field("variant_id"), id); v.ID == 0 {
+				f.Errors.Add(field("variant_id"), "Unknown variant")
+			}
+		}
+
+		v.Format = strings.ToLower(strings.TrimSpace(formats[i]))
+		if !slices.Contains(models.Formats, v.Format) {
+			f.Errors.Add(field("format"), "Choose a format")
+		}
+
+		if raw := strings.TrimSpace(at(r.Form["isbn"], i)); raw != "" {
+			number, err := isbn.Normalize(raw)
+			if err != nil {
+				f.Errors.Add(field("isbn"), "Enter a valid ISBN-10 or ISBN-13")
+			} else if j, ok := isbns[number]; ok {
+				f.Errors.Add(field("isbn"), fmt.Sprintf("Format %d has the same ISBN", j+1))
+			} else {
+				isbns[number] = i
+				v.ISBN = number
+			}
+		}
+
+		if v.SKU = strings.TrimSpace(at(r.Form["sku"], i)); v.SKU != "" {
+			if j, ok := codes["sku:"+v.SKU]; ok {
+				f.Errors.Add(field("sku"), fmt.Sprintf("Format %d has the same SKU", j+1))
+			}
+			codes["sku:"+v.SKU] = i
+		}
+		if raw := strings.TrimSpace(at(r.Form["barcode"], i)); raw != "" {
+			code, err := barcode.Normalize(raw)
+			if err != nil {
+				f.Errors.Add(field("barcode"), "Enter a valid EAN-13 or UPC-A barcode")
+			} else if j, ok := codes["barcode:"+code]; ok {
+				f.Errors.Add(field("barcode"), fmt.Sprintf("Format %d has the same barcode", j+1))
+			} else {
+				codes["barcode:"+code] = i
+				v.Barcode = code
+			}
+		}
+
+		if strings.TrimSpace(at(r.Form["stock"], i)) == "" {
+			f.Errors.Add(field("stock"), "Enter the number in stock")
+		}
+		v.Stock = f.count(field("stock"), at(r.Form["stock"], i))
+		if shown := strings.TrimSpace(at(r.Form["stock_shown"], i)); v.ID != 0 && shown != "" {
+			n := f.count(field("stock_shown"), shown)
+			v.StockShown = &n
+		}
+
+		if strings.TrimSpace(at(r.Form["price"], i)) == "" {
+			f.Errors.Add(field("price"), "Enter a price")
+		}
+		v.Cents = f.cents(field("price"), at(r.Form["price"], i))
+		v.Price = float64(v.Cents) / 100
+		for _, currency := range services.SupportedCurrencies {
+			if currency == services.BaseCurrency {
+				continue
+			}
+			value := at(r.Form["price_"+currency], i)
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			if v.Prices == nil {
+				v.Prices = make(map[string]int64)
+			}
+			v.Prices[currency] = f.cents(field("price_"+currency), value)
+		}
+
+		fh := upload(r, field("variant_image"))
+		if fh == nil && i < len(uploads) {
+			fh = uploads[i]
+		}
+		if fh != nil {
+			if fh.Size > images.MaxUploadBytes {
+				f.Errors.Add(field("variant_image"), images.ErrTooLarge.Error())
+			} else {
+				f.Uploads[i] = fh
+			}
+		}
+
+		f.Product.Variants = append(f.Product.Variants, v)
+	}
+}
+
+// count reads an optional whole number of zero or more.
+func (f *ProductForm) count(field, value string) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		f.Errors.Add(field, "Enter a whole number")
+		return 0
+	}
+	return n
+}
+
+// cents reads an optional price in dollars, such as "12.99".
+// maxPrice is the highest price the form takes, well inside what cents and
+// the variants.cents column can hold.
+const maxPrice = 1e7
+
+func (f *ProductForm) cents(field, value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(price) || price < 0 || price > maxPrice {
+		f.Errors.Add(field, "Enter a price such as 12.99")
+		return 0
+	}
+	return int64(math.Round(price * 100))
+}
+
+// at returns the i-th value, or "" when there are fewer.
+func at(values []string, i int) string {
+	if i < len(values) {
+		return values[i]
+	}
+	return ""
+}
+
+func upload(r *http.Request, name string) *multipart.FileHeader {
+	if r.MultipartForm == nil || len(r.MultipartForm.File[name]) == 0 {
+		return nil
+	}
+	return r.MultipartForm.File[name][0]
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"mime/multipart"
+
+	"github.com/nathanialw/ecommerce/internal/images"
+)
+
+// SaveImage runs an uploaded file through the image pipeline and returns the
+// name to store as the variant's image path.
+func SaveImage(fh *multipart.FileHeader) (string, error) {
+	if fh.Size > images.MaxUploadBytes {
+		return "", images.ErrTooLarge
+	}
+	file, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return images.Save(file)
+}
@@ -1,99 +1,109 @@
 package admin
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"math"
-	"net/http"
-	"os"
-	"strconv"
 
 	"github.com/nathanialw/ecommerce/internal/cache"
 	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/images"
+	"github.com/nathanialw/ecommerce/internal/services"
 	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
-func UpdateProduct(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20) // 10 MB
-	if err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
-		return
+// SaveProduct stores the new images of a bound product form and then writes
+// the product in one transaction. When the form has errors, when an ISBN,
+// SKU or barcode belongs to another variant, or when someone else saved the
+// product first, nothing is saved and f.Errors is returned saying why.
+func SaveProduct(f *ProductForm) error {
+	if len(f.Errors) > 0 {
+		return f.Errors
 	}
+	p := &f.Product
 
-	// Get product details
-	id, _ := strconv.Atoi(r.FormValue("id"))
-	title := r.FormValue("title")
-	author := r.FormValue("author")
-	description := r.FormValue("description")
-
-	// Handle variants (you may want to loop through variants from the form)
-	variantIds := r.Form["variant_id"]
-	colors := r.Form["color"]
-	stockValues := r.Form["stock"]
-	priceValues := r.Form["price"]
-	existingImagePaths := r.Form["existing_image_path"]
-
-	for i := 0; i < len(colors); i++ {
-		// Ensure all variant fields are populated
-		if len(colors) != len(stockValues) || len(colors) != len(priceValues) {
-			http.Error(w, "Variant fields mismatch", http.StatusBadRequest)
-			return
+	previous := make(map[int]models.Variant)
+	if p.ID != 0 {
+		stored, err := db.GetVariantsByProductID(p.ID)
+		if err != nil {
+			return err
 		}
+		for _, v := range stored {
+			previous[v.ID] = v
+		}
+	}
+	if f.keepCodes {
+		for i, v := range p.Variants {
+			p.Variants[i].SKU, p.Variants[i].Barcode = previous[v.ID].SKU, previous[v.ID].Barcode
+		}
+	}
 
-		// Ensure we have all fields for each variant
-
-		variantID, _ := strconv.Atoi(variantIds[i])
-		color := colors[i]
-		stock, _ := strconv.Atoi(stockValues[i])
-		price, _ := strconv.ParseFloat(priceValues[i], 64)
-		cents := int64(math.Round(price * 100))
-		// Default to existing image path from hidden field
-		imagePath := existingImagePaths[i]
-
-		file, handler, err := r.FormFile(fmt.Sprintf("variant_image[%d]", i))
-		if err == nil {
-			defer file.Close()
-			imagePath = handler.Filename
-			savePath := "static/img/" + imagePath
-
-			dst, err := os.Create(savePath)
+	for i, v := range p.Variants {
+		taken := func(field, message, isbn, sku, barcode string) error {
+			matches, err := db.FindVariants(isbn, sku, barcode)
 			if err != nil {
-				log.Printf("Failed to create file for variant %d: %v", i, err)
-			} else {
-				defer dst.Close()
-				_, err = io.Copy(dst, file)
-				if err != nil {
-					log.Printf("Failed to save image for variant %d: %v", i, err)
-				}
+				return err
+			}
+			if len(matches) > 0 && matches[0].ID != v.ID {
+				f.Errors.Add(fmt.Sprintf("%s[%d]", field, i), message)
 			}
-		} else {
-			// No file uploaded, keep existing imagePath
+			return nil
 		}
-
-		// Create a variant for each set of values
-		variant := models.Variant{
-			ID:        variantID,
-			Color:     color,
-			Stock:     stock,
-			Cents:     cents,
-			ImagePath: imagePath,
+		if v.ISBN != "" {
+			if err := taken("isbn", "Another book already has this ISBN", v.ISBN, "", ""); err != nil {
+				return err
+			}
+		}
+		if v.SKU != "" {
+			if err := taken("sku", "Another variant already has this SKU", "", v.SKU, ""); err != nil {
+				return err
+			}
 		}
+		if v.Barcode != "" {
+			if err := taken("barcode", "Another variant already has this barcode", "", "", v.Barcode); err != nil {
+				return err
+			}
+		}
+	}
+	if len(f.Errors) > 0 {
+		return f.Errors
+	}
 
-		if variantIds[i] == "new" {
-			db.InsertVariant(id, variant.Color, variant.Stock, variant.Cents, variant.ImagePath)
-		} else {
-			db.UpdateProductVariantByID(variant)
+	var saved []string
+	for i, fh := range f.Uploads {
+		imagePath, err := SaveImage(fh)
+		if err != nil {
+			f.Errors.Add(fmt.Sprintf("variant_image[%d]", i), err.Error())
+			continue
 		}
+		p.Variants[i].ImagePath = imagePath
+		saved = append(saved, imagePath)
+	}
+	if len(f.Errors) > 0 {
+		images.RemoveUnused(saved...)
+		return f.Errors
 	}
 
-	// Update product details and its variants
-	err = db.UpdateProductByID(id, title, author, description)
+	err := db.SaveProduct(p, "")
+	if errors.Is(err, db.ErrVersionConflict) {
+		images.RemoveUnused(saved...)
+		f.Errors.Add("version", "Someone else saved this book while you were editing it. "+
+			"Nothing was saved; reload the page to see their changes and make yours again.")
+		return f.Errors
+	}
 	if err != nil {
-		http.Error(w, "Failed to update", http.StatusInternalServerError)
-		return
+		images.RemoveUnused(saved...)
+		return err
+	}
+
+	var replaced []string
+	for _, v := range p.Variants {
+		if old, ok := previous[v.ID]; ok && old.ImagePath != v.ImagePath {
+			replaced = append(replaced, old.ImagePath)
+		}
 	}
+	images.RemoveUnused(replaced...)
 
-	// Rebuild the cache or update any other necessary data
 	cache.UpdateCache()
+	services.CheckStockSoon()
+	return nil
 }
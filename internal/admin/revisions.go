@@ -0,0 +1,214 @@
+package admin
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// Diff lists the fields that differ from before to after. Variants are
+// matched by ID and categories are named from the cache.
+func Diff(before, after models.ProductSnapshot) []models.FieldChange {
+	var changes []models.FieldChange
+	field := func(name, b, a string) {
+		if b != a {
+			changes = append(changes, models.FieldChange{Field: name, Before: b, After: a})
+		}
+	}
+
+	field("Title", before.Title, after.Title)
+	field("Author", before.Author, after.Author)
+	field("Contributors", credits(before.Contributors), credits(after.Contributors))
+	field("Description", before.Description, after.Description)
+	field("Product type", before.ProductType, after.ProductType)
+	field("Publisher", before.Publisher, after.Publisher)
+	field("Publication date", date(before.PublicationDate, "2006-01-02"), date(after.PublicationDate, "2006-01-02"))
+	field("Language", before.Language, after.Language)
+	field("Page count", number(before.PageCount), number(after.PageCount))
+	field("Series", before.Series, after.Series)
+	field("Series volume", number(before.SeriesVolume), number(after.SeriesVolume))
+	field("Status", before.Status, after.Status)
+	field("Publish at", date(before.PublishAt, "2006-01-02 15:04"), date(after.PublishAt, "2006-01-02 15:04"))
+	field("Categories", categoryNames(before.Category_IDs), categoryNames(after.Category_IDs))
+	field("Tags", strings.Join(before.Tags, ", "), strings.Join(after.Tags, ", "))
+
+	for _, a := range after.Variants {
+		i := slices.IndexFunc(before.Variants, func(b models.VariantSnapshot) bool { return b.ID == a.ID })
+		if i < 0 {
+			field(variantLabel(a), "", "Added at "+money(a.Cents, services.BaseCurrency))
+			continue
+		}
+		b, label := before.Variants[i], variantLabel(a)
+		field(label+" format", b.Format, a.Format)
+		field(label+" ISBN", b.ISBN, a.ISBN)
+		field(label+" SKU", b.SKU, a.SKU)
+		field(label+" barcode", b.Barcode, a.Barcode)
+		field(label+" price", money(b.Cents, services.BaseCurrency), money(a.Cents, services.BaseCurrency))
+		field(label+" stock", strconv.Itoa(b.Stock), strconv.Itoa(a.Stock))
+		field(label+" image", b.ImagePath, a.ImagePath)
+		currencies := maps.Clone(b.Prices)
+		if currencies == nil {
+			currencies = make(map[string]int64)
+		}
+		maps.Copy(currencies, a.Prices)
+		for _, c := range slices.Sorted(maps.Keys(currencies)) {
+			field(label+" price in "+c, optionalMoney(b.Prices, c), optionalMoney(a.Prices, c))
+		}
+	}
+	for _, b := range before.Variants {
+		if !slices.ContainsFunc(after.Variants, func(a models.VariantSnapshot) bool { return a.ID == b.ID }) {
+			field(variantLabel(b), "Priced at "+money(b.Cents, services.BaseCurrency), "")
+		}
+	}
+	return changes
+}
+
+// RevertProduct saves the product as it was in one of its revisions, which
+// makes a new revision. Stock, images, SKUs, barcodes and the publication
+// status are left as they are now, as are variants added since; variants
+// archived since are not brought back.
+func RevertProduct(productID, revisionID int) error {
+	rev, err := db.GetProductRevision(revisionID)
+	if err != nil {
+		return err
+	}
+	if rev.Product_ID != productID {
+		return fmt.Errorf("revision %d is not of product %d", revisionID, productID)
+	}
+	current, err := db.GetProductByID(productID)
+	if err != nil {
+		return err
+	}
+
+	s := rev.Snapshot
+	p := models.Product{
+		ID:              current.ID,
+		Version:         current.Version,
+		Title:           s.Title,
+		Author:          s.Author,
+		Description:     s.Description,
+		ProductType:     s.ProductType,
+		Publisher:       s.Publisher,
+		PublicationDate: s.PublicationDate,
+		Language:        s.Language,
+		PageCount:       s.PageCount,
+		Series:          s.Series,
+		SeriesVolume:    s.SeriesVolume,
+		Status:          current.Status,
+		PublishAt:       current.PublishAt,
+	}
+	for _, c := range s.Contributors {
+		p.Contributors = append(p.Contributors, models.Contributor{Name: c.Name, Role: c.Role})
+	}
+	categories := cache.GetCategories()
+	for _, id := range s.Category_IDs {
+		// Skip categories deleted since
+		if slices.ContainsFunc(categories, func(c models.Category) bool { return c.ID == id }) {
+			p.Categories = append(p.Categories, models.Category{ID: id})
+		}
+	}
+	for _, name := range s.Tags {
+		p.Tags = append(p.Tags, models.Tag{Name: name})
+	}
+
+	variantIDs := make([]int, len(current.Variants))
+	for i, v := range current.Variants {
+		variantIDs[i] = v.ID
+	}
+	priceLists, err := db.GetVariantPriceLists(variantIDs)
+	if err != nil {
+		return err
+	}
+	for _, v := range current.Variants {
+		v.Prices = priceLists[v.ID]
+		if i := slices.IndexFunc(s.Variants, func(old models.VariantSnapshot) bool { return old.ID == v.ID }); i >= 0 {
+			old := s.Variants[i]
+			v.Format, v.ISBN, v.Cents, v.Prices = old.Format, old.ISBN, old.Cents, old.Prices
+			if v.ISBN != "" {
+				matches, err := db.FindVariants(v.ISBN, "", "")
+				if err != nil {
+					return err
+				}
+				if len(matches) > 0 && matches[0].ID != v.ID {
+					return fmt.Errorf("ISBN %s now belongs to another book", v.ISBN)
+				}
+			}
+		}
+		p.Variants = append(p.Variants, v)
+	}
+
+	if err := db.SaveProduct(&p, fmt.Sprintf("Reverted to version %d", rev.Version)); err != nil {
+		return err
+	}
+	cache.UpdateCache()
+	return nil
+}
+
+func credits(contributors []models.SnapshotCredit) string {
+	parts := make([]string, len(contributors))
+	for i, c := range contributors {
+		parts[i] = c.Name + " (" + c.Role + ")"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func categoryNames(ids []int) string {
+	categories := cache.GetCategories()
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = "#" + strconv.Itoa(id)
+		for _, c := range categories {
+			if c.ID == id {
+				names[i] = c.Name
+				break
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func variantLabel(v models.VariantSnapshot) string {
+	label := v.Format
+	if label != "" {
+		label = strings.ToUpper(label[:1]) + label[1:]
+	}
+	if v.ISBN != "" {
+		label += " " + v.ISBN
+	}
+	return label
+}
+
+func date(t *time.Time, layout string) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+func number(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func money(cents int64, currency string) string {
+	return fmt.Sprintf("%d.%02d %s", cents/100, cents%100, currency)
+}
+
+// optionalMoney is the explicit price in a currency, or "" without one.
+func optionalMoney(prices map[string]int64, currency string) string {
+	cents, ok := prices[currency]
+	if !ok {
+		return ""
+	}
+	return money(cents, currency)
+}
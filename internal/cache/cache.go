@@ -1,39 +1,60 @@
 package cache
 
 import (
+	"fmt"
 	"log"
 	"sync"
 
 	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
 var (
-	authors []string
-	mu      sync.RWMutex
+	authors    []models.Author
+	categories []models.Category
+	synonyms   []models.Synonym
+	prefixes   prefixIndex
+	mu         sync.RWMutex
 )
 
-// LoadAuthors queries the DB once and caches the result.
+// LoadCache queries the DB once and caches the authors, categories and search
+// synonyms, and builds the autocomplete index of titles, authors and
+// categories.
 func LoadCache() error {
-	gs, err := db.GetCache()
-	if err != nil {
-		return err
-	}
-	mu.Lock()
-	authors = gs
-	mu.Unlock()
-	log.Printf("Loaded %d authors into cache", len(gs))
-	return nil
+	return updateCache()
 }
 
-func GetCache() []string {
+func GetCache() []models.Author {
 	mu.RLock()
 	defer mu.RUnlock()
 	return authors
 }
 
+// GetCategories returns every category as a flat list; see
+// services.CategoryTree for nesting them.
+func GetCategories() []models.Category {
+	mu.RLock()
+	defer mu.RUnlock()
+	return categories
+}
+
+func GetSynonyms() []models.Synonym {
+	mu.RLock()
+	defer mu.RUnlock()
+	return synonyms
+}
+
+// Suggest returns up to limit titles, authors and categories with words
+// starting with the words of query.
+func Suggest(query string, limit int) []models.Suggestion {
+	mu.RLock()
+	defer mu.RUnlock()
+	return prefixes.lookup(query, limit)
+}
+
 func UpdateCache() {
 	if err := updateCache(); err != nil {
-		log.Printf("Failed to update authors cache: %v", err)
+		log.Printf("Failed to update cache: %v", err)
 	}
 }
 
@@ -42,9 +63,44 @@ func updateCache() error {
 	if err != nil {
 		return err
 	}
+	newCategories, err := db.GetAllCategories()
+	if err != nil {
+		return err
+	}
+	titles, err := db.GetProductTitles()
+	if err != nil {
+		return err
+	}
+	newSynonyms, err := db.GetAllSynonyms()
+	if err != nil {
+		return err
+	}
+
+	var suggestions []models.Suggestion
+	for _, p := range titles {
+		suggestions = append(suggestions, models.Suggestion{
+			Type: models.SuggestTitle, Label: p.Title, URL: fmt.Sprintf("/product/%d", p.ID),
+		})
+	}
+	for _, a := range newAuthors {
+		suggestions = append(suggestions, models.Suggestion{
+			Type: models.SuggestAuthor, Label: a.Name, URL: "/author/" + a.Slug,
+		})
+	}
+	for _, c := range newCategories {
+		suggestions = append(suggestions, models.Suggestion{
+			Type: models.SuggestCategory, Label: c.Name, URL: "/category/" + c.Slug,
+		})
+	}
+	newPrefixes := buildPrefixIndex(suggestions)
+
 	mu.Lock()
 	authors = newAuthors
+	categories = newCategories
+	synonyms = newSynonyms
+	prefixes = newPrefixes
 	mu.Unlock()
-	log.Printf("Updated authors cache with %d entries", len(newAuthors))
+	log.Printf("Updated cache with %d authors, %d categories and %d titles",
+		len(newAuthors), len(newCategories), len(titles))
 	return nil
 }
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// prefixEntry files a suggestion under one of its words, so "tolk" finds
+// "J.R.R. Tolkien" as well as titles starting with it.
+type prefixEntry struct {
+	key        string
+	suggestion *models.Suggestion
+}
+
+// prefixIndex is a sorted list of entries searched by binary search. It is
+// rebuilt whole on every cache update and never modified after.
+type prefixIndex []prefixEntry
+
+func buildPrefixIndex(suggestions []models.Suggestion) prefixIndex {
+	var index prefixIndex
+	for i := range suggestions {
+		s := &suggestions[i]
+		for _, word := range strings.FieldsFunc(normalize(s.Label), isSeparator) {
+			index = append(index, prefixEntry{key: word, suggestion: s})
+		}
+	}
+	sort.Slice(index, func(i, j int) bool {
+		return index[i].key < index[j].key
+	})
+	return index
+}
+
+// lookup returns up to limit suggestions with a word starting with each word
+// of the query, the last of which may be partly typed.
+func (index prefixIndex) lookup(query string, limit int) []models.Suggestion {
+	words := strings.FieldsFunc(normalize(query), isSeparator)
+	if len(words) == 0 {
+		return nil
+	}
+
+	// Find candidates by the longest word, then check they have the others
+	longest := words[0]
+	for _, w := range words[1:] {
+		if len(w) > len(longest) {
+			longest = w
+		}
+	}
+
+	var results []models.Suggestion
+	seen := make(map[*models.Suggestion]bool)
+	start := sort.Search(len(index), func(i int) bool { return index[i].key >= longest })
+	for _, e := range index[start:] {
+		if !strings.HasPrefix(e.key, longest) || len(results) == limit {
+			break
+		}
+		if seen[e.suggestion] || !hasWordPrefixes(e.suggestion.Label, words) {
+			continue
+		}
+		seen[e.suggestion] = true
+		results = append(results, *e.suggestion)
+	}
+	return results
+}
+
+func hasWordPrefixes(label string, prefixes []string) bool {
+	words := strings.FieldsFunc(normalize(label), isSeparator)
+	for _, p := range prefixes {
+		found := false
+		for _, w := range words {
+			if strings.HasPrefix(w, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func normalize(s string) string {
+	return strings.ToLower(s)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
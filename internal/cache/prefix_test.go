@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func TestPrefixIndexLookup(t *testing.T) {
+	index := buildPrefixIndex([]models.Suggestion{
+		{Type: "author", Label: "J.R.R. Tolkien"},
+		{Type: "product", Label: "The Lord of the Rings"},
+		{Type: "product", Label: "The Hobbit"},
+		{Type: "product", Label: "Lord of the Flies"},
+		{Type: "series", Label: "The Wheel of Time"},
+	})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"tolk", []string{"J.R.R. Tolkien"}},
+		{"TOLKIEN", []string{"J.R.R. Tolkien"}},
+		{"lord", []string{"Lord of the Flies", "The Lord of the Rings"}},
+		// Every word must start a word of the label, in any order
+		{"lord rin", []string{"The Lord of the Rings"}},
+		{"rings lo", []string{"The Lord of the Rings"}},
+		{"the of", []string{"Lord of the Flies", "The Lord of the Rings", "The Wheel of Time"}},
+		{"lord time", nil},
+		// Words only match from their start
+		{"olkien", nil},
+		{"j.r.r", []string{"J.R.R. Tolkien"}},
+		{"", nil},
+		{"  -- ", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, s := range index.lookup(tt.query, 10) {
+			got = append(got, s.Label)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("lookup(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	if got := index.lookup("the", 2); len(got) != 2 {
+		t.Errorf("lookup with a limit of 2 returned %d suggestions", len(got))
+	}
+}
@@ -0,0 +1,157 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// Columns are the catalog CSV columns in export order, one row per variant.
+// Imports accept any subset that includes isbn or sku.
+func Columns() []string {
+	columns := []string{
+		"product_id", "isbn", "sku", "barcode", "title", "contributors", "description",
+		"publisher", "publication_date", "language", "page_count", "series",
+		"series_volume", "format", "price", "stock", "image_path",
+	}
+	for _, currency := range services.SupportedCurrencies {
+		if currency != services.BaseCurrency {
+			columns = append(columns, priceColumn(currency))
+		}
+	}
+	return columns
+}
+
+// priceColumn is the column holding the explicit price in a currency other
+// than the base one.
+func priceColumn(currency string) string {
+	return "price_" + strings.ToLower(currency)
+}
+
+// ReadCSV reads a catalog CSV. The file is rejected when its header is
+// unusable; a row that can't be read becomes a record with Err set.
+func ReadCSV(data []byte) ([]Record, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\uFEFF"))))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	known := make(map[string]bool)
+	for _, c := range Columns() {
+		known[c] = true
+	}
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown column %q", header[i])
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+	if !seen["isbn"] && !seen["sku"] {
+		return nil, fmt.Errorf("the file needs an isbn or sku column")
+	}
+
+	var records []Record
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				records = append(records, Record{Line: pe.StartLine, Err: pe.Err})
+				continue
+			}
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		if len(row) != len(header) {
+			records = append(records, Record{
+				Line: line,
+				Err:  fmt.Errorf("expected %d fields, found %d", len(header), len(row)),
+			})
+			continue
+		}
+
+		rec := Record{Line: line, Fields: make(map[string]string, len(row))}
+		for i, value := range row {
+			rec.Fields[header[i]] = strings.TrimSpace(value)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// WriteCSV writes the products as a catalog CSV that ReadCSV can import back.
+func WriteCSV(w io.Writer, products []models.Product) error {
+	cw := csv.NewWriter(w)
+	columns := Columns()
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		for _, v := range p.Variants {
+			fields := map[string]string{
+				"product_id":    strconv.Itoa(p.ID),
+				"isbn":          v.ISBN,
+				"sku":           v.SKU,
+				"barcode":       v.Barcode,
+				"title":         p.Title,
+				"contributors":  formatContributors(p.Contributors),
+				"description":   p.Description,
+				"publisher":     p.Publisher,
+				"language":      p.Language,
+				"series":        p.Series,
+				"format":        v.Format,
+				"price":         formatCents(v.Cents),
+				"stock":         strconv.Itoa(v.Stock),
+				"image_path":    v.ImagePath,
+				"page_count":    optionalInt(p.PageCount),
+				"series_volume": optionalInt(p.SeriesVolume),
+			}
+			if p.PublicationDate != nil {
+				fields["publication_date"] = p.PublicationDate.Format(dateLayout)
+			}
+			for currency, cents := range v.Prices {
+				fields[priceColumn(currency)] = formatCents(cents)
+			}
+
+			row := make([]string, len(columns))
+			for i, c := range columns {
+				row[i] = fields[c]
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,422 @@
+// Package catalog imports and exports the product catalog in bulk, as CSV or
+// as ONIX 3.0 from publishers' feeds, and publishes scheduled products.
+package catalog
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/barcode"
+	"github.com/nathanialw/ecommerce/pkg/isbn"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const dateLayout = "2006-01-02"
+
+// Record is one variant read from an import file, keyed by CSV column name.
+// Only the columns the file supplied are present, and a blank value leaves
+// the existing one alone, so a file of ISBNs and stock updates stock only.
+type Record struct {
+	Line   int
+	Fields map[string]string
+	// Err is set when the row couldn't be read at all
+	Err error
+}
+
+// Imports run one at a time on a single goroutine; a few more can wait.
+const (
+	importQueue    = 16
+	importProgress = 50 // rows between progress updates
+)
+
+var imports = make(chan int, importQueue)
+
+// StartImporter starts the goroutine that runs queued imports. Imports that
+// were cut off by a restart are marked as failed first.
+func StartImporter() {
+	if err := db.FailInterruptedImports(); err != nil {
+		log.Printf("Failed to clear interrupted imports: %v", err)
+	}
+
+	go func() {
+		for id := range imports {
+			run(id)
+		}
+	}()
+}
+
+// Queue saves an import job and queues it to run, returning its ID.
+func Queue(job models.ImportJob) (int, error) {
+	id, err := db.InsertImportJob(job)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case imports <- id:
+		return id, nil
+	default:
+		now := time.Now()
+		job.ID, job.Status, job.FinishedAt = id, models.JobFailed, &now
+		job.Error = "Too many imports were waiting"
+		db.UpdateImportProgress(job, nil)
+		return 0, fmt.Errorf("too many imports are waiting; try again shortly")
+	}
+}
+
+// run reads a queued import's file and applies each row, saving progress as
+// it goes so the progress page can follow along.
+func run(id int) {
+	job, err := db.GetImportJob(id)
+	if err != nil {
+		log.Printf("Import %d: %v", id, err)
+		return
+	}
+
+	var pending []models.ImportRow
+	save := func() {
+		if err := db.UpdateImportProgress(job, pending); err != nil {
+			log.Printf("Import %d: %v", id, err)
+		}
+		pending = nil
+	}
+	finish := func(err error) {
+		job.Status = models.JobDone
+		if err != nil {
+			job.Status = models.JobFailed
+			job.Error = err.Error()
+		}
+		now := time.Now()
+		job.FinishedAt = &now
+		save()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import %d panicked: %v", id, r)
+			finish(fmt.Errorf("import stopped unexpectedly at row %d", job.Processed+1))
+		}
+	}()
+
+	job.Status = models.JobRunning
+	save()
+
+	data, err := db.GetImportJobData(id)
+	if err != nil {
+		finish(err)
+		return
+	}
+	var records []Record
+	switch job.Format {
+	case models.ImportCSV:
+		records, err = ReadCSV(data)
+	case models.ImportONIX:
+		records, err = ReadONIX(data)
+	default:
+		err = fmt.Errorf("unknown import format %q", job.Format)
+	}
+	if err != nil {
+		finish(err)
+		return
+	}
+
+	job.Total = len(records)
+	im := importer{dryRun: job.DryRun, books: make(map[string]newBook), keys: make(map[string]int)}
+	for _, rec := range records {
+		row := im.apply(rec)
+		switch row.Action {
+		case models.ImportCreate:
+			job.Created++
+		case models.ImportUpdate:
+			job.Updated++
+		default:
+			job.Failed++
+		}
+		job.Processed++
+		pending = append(pending, row)
+		if len(pending) == importProgress {
+			save()
+		}
+	}
+	finish(nil)
+
+	if !job.DryRun && job.Created+job.Updated > 0 {
+		cache.UpdateCache()
+		services.CheckStockSoon()
+	}
+}
+
+// newBook is a product created earlier in the same import, so later rows for
+// another format of the same book are added to it.
+type newBook struct {
+	productID int
+	line      int
+}
+
+type importer struct {
+	dryRun bool
+	books  map[string]newBook
+	// keys holds the line each ISBN and SKU was first seen on
+	keys map[string]int
+}
+
+// apply creates or updates the variant a record describes, or in a dry run
+// works out which it would do.
+func (im *importer) apply(rec Record) models.ImportRow {
+	row := models.ImportRow{Line: rec.Line, Action: models.ImportError}
+	fail := func(err error) models.ImportRow {
+		row.Action = models.ImportError
+		row.Message = err.Error()
+		return row
+	}
+	if rec.Err != nil {
+		row.Key = cmp.Or(rec.Fields["isbn"], rec.Fields["sku"])
+		return fail(rec.Err)
+	}
+
+	number, sku, err := recordKey(rec)
+	if err != nil {
+		return fail(err)
+	}
+	row.Key = cmp.Or(number, sku)
+	if row.Key == "" {
+		return fail(fmt.Errorf("the row needs an ISBN or SKU"))
+	}
+	for _, key := range []string{number, sku} {
+		if line, ok := im.keys[key]; ok && key != "" {
+			return fail(fmt.Errorf("%s already appeared on line %d", key, line))
+		}
+	}
+	for _, key := range []string{number, sku} {
+		if key != "" {
+			im.keys[key] = rec.Line
+		}
+	}
+
+	matches, err := db.FindVariants(number, sku, "")
+	if err != nil {
+		return fail(err)
+	}
+	if len(matches) > 1 {
+		return fail(fmt.Errorf("ISBN %s and SKU %s belong to different variants", number, sku))
+	}
+
+	var p *models.Product
+	var v models.Variant
+	var group string
+	if len(matches) == 1 {
+		row.Action = models.ImportUpdate
+		v = matches[0]
+		if p, err = db.GetProductByID(v.Product_ID); err != nil {
+			return fail(err)
+		}
+	} else {
+		row.Action = models.ImportCreate
+		if p, group, err = im.productFor(rec, &row); err != nil {
+			return fail(err)
+		}
+	}
+	p.Contributors = nil
+	v.Prices = nil
+
+	if err := applyFields(rec, p, &v); err != nil {
+		return fail(err)
+	}
+	row.Title = p.Title
+	if row.Action == models.ImportCreate {
+		if err := checkNew(rec, p, v); err != nil {
+			return fail(err)
+		}
+	}
+
+	if !im.dryRun {
+		if err := db.SaveImportedVariant(p, &v); err != nil {
+			return fail(fmt.Errorf("saving failed: %v", err))
+		}
+	}
+	if group != "" {
+		if _, ok := im.books[group]; !ok {
+			im.books[group] = newBook{productID: p.ID, line: rec.Line}
+		}
+	}
+	return row
+}
+
+// productFor finds the product a new variant belongs to: the one named in
+// product_id, one created for the same title and contributors earlier in the
+// import, or a new one. group is set when the product is new to this import.
+func (im *importer) productFor(rec Record, row *models.ImportRow) (p *models.Product, group string, err error) {
+	if v := rec.Fields["product_id"]; v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid product_id %q", v)
+		}
+		p, err = db.GetProductByID(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("product %d does not exist", id)
+		}
+		return p, "", nil
+	}
+
+	group = strings.ToLower(rec.Fields["title"] + "\x00" + rec.Fields["contributors"])
+	if book, ok := im.books[group]; ok {
+		row.Message = fmt.Sprintf("Adds a format to the book on line %d", book.line)
+		if book.productID == 0 {
+			// A dry run: the product only exists on paper
+			return &models.Product{Language: "en"}, group, nil
+		}
+		p, err = db.GetProductByID(book.productID)
+		return p, group, err
+	}
+	return &models.Product{Language: "en"}, group, nil
+}
+
+// recordKey returns the record's ISBN, as ISBN-13, and SKU.
+func recordKey(rec Record) (number, sku string, err error) {
+	if v := rec.Fields["isbn"]; v != "" {
+		if number, err = isbn.Normalize(v); err != nil {
+			return "", "", fmt.Errorf("invalid ISBN %q", v)
+		}
+	}
+	return number, rec.Fields["sku"], nil
+}
+
+// applyFields copies the record's non-blank fields onto the product and
+// variant.
+func applyFields(rec Record, p *models.Product, v *models.Variant) error {
+	var err error
+	for column, value := range rec.Fields {
+		if value == "" {
+			continue
+		}
+
+		switch column {
+		case "isbn":
+			v.ISBN, err = isbn.Normalize(value)
+		case "sku":
+			v.SKU = value
+		case "barcode":
+			v.Barcode, err = barcode.Normalize(value)
+		case "title":
+			p.Title = value
+		case "contributors":
+			p.Contributors, err = parseContributors(value)
+		case "description":
+			p.Description = value
+		case "publisher":
+			p.Publisher = value
+		case "publication_date":
+			var date time.Time
+			if date, err = time.Parse(dateLayout, value); err == nil {
+				p.PublicationDate = &date
+			}
+		case "language":
+			p.Language = strings.ToLower(value)
+		case "page_count":
+			p.PageCount, err = parseCount(value)
+		case "series":
+			p.Series = value
+		case "series_volume":
+			p.SeriesVolume, err = parseCount(value)
+		case "format":
+			v.Format = strings.ToLower(value)
+			if !slices.Contains(models.Formats, v.Format) {
+				err = fmt.Errorf("unknown format")
+			}
+		case "price":
+			v.Cents, err = parseCents(value)
+		case "stock":
+			v.Stock, err = parseCount(value)
+		case "image_path":
+			v.ImagePath = value
+		default:
+			currency, ok := strings.CutPrefix(column, "price_")
+			if !ok {
+				continue
+			}
+			var cents int64
+			if cents, err = parseCents(value); err == nil {
+				if v.Prices == nil {
+					v.Prices = make(map[string]int64)
+				}
+				v.Prices[strings.ToUpper(currency)] = cents
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", strings.ReplaceAll(column, "_", " "), value)
+		}
+	}
+	return nil
+}
+
+// checkNew makes sure a row that creates a variant says enough to sell it.
+func checkNew(rec Record, p *models.Product, v models.Variant) error {
+	switch {
+	case p.Title == "":
+		return fmt.Errorf("a new book needs a title")
+	case v.Format == "":
+		return fmt.Errorf("a new variant needs a format")
+	case rec.Fields["price"] == "":
+		return fmt.Errorf("a new variant needs a %s price", services.BaseCurrency)
+	}
+	return nil
+}
+
+// parseContributors reads a contributors field such as
+// "Jane Doe; Ann Lee (translator)". A name without a role is an author.
+func parseContributors(value string) ([]models.Contributor, error) {
+	var contributors []models.Contributor
+	for _, part := range strings.Split(value, ";") {
+		name, role := strings.TrimSpace(part), models.RoleAuthor
+		if open := strings.LastIndex(name, "("); open > 0 && strings.HasSuffix(name, ")") {
+			role = strings.ToLower(strings.TrimSpace(name[open+1 : len(name)-1]))
+			name = strings.TrimSpace(name[:open])
+		}
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(models.ContributorRoles, role) {
+			return nil, fmt.Errorf("unknown contributor role %q", role)
+		}
+		contributors = append(contributors, models.Contributor{Name: name, Role: role})
+	}
+	return contributors, nil
+}
+
+// formatContributors writes contributors the way parseContributors reads them.
+func formatContributors(contributors []models.Contributor) string {
+	parts := make([]string, len(contributors))
+	for i, c := range contributors {
+		parts[i] = c.Name
+		if c.Role != models.RoleAuthor {
+			parts[i] += " (" + c.Role + ")"
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func parseCount(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid count %q", value)
+	}
+	return n, nil
+}
+
+// parseCents reads a price in dollars, such as "19.99".
+func parseCents(value string) (int64, error) {
+	price, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+	if err != nil || price < 0 {
+		return 0, fmt.Errorf("invalid price %q", value)
+	}
+	return int64(math.Round(price * 100)), nil
+}
@@ -0,0 +1,420 @@
+package catalog
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// ONIX 3.0 reference-tag elements read by ReadONIX. Everything else in a
+// product record is ignored.
+type onixProduct struct {
+	NotificationType string           `xml:"NotificationType"`
+	Identifiers      []onixIdentifier `xml:"ProductIdentifier"`
+	Descriptive      struct {
+		Form         string            `xml:"ProductForm"`
+		Collections  []onixCollection  `xml:"Collection"`
+		Titles       []onixTitleDetail `xml:"TitleDetail"`
+		Contributors []onixContributor `xml:"Contributor"`
+		Languages    []struct {
+			Role string `xml:"LanguageRole"`
+			Code string `xml:"LanguageCode"`
+		} `xml:"Language"`
+		Extents []struct {
+			Type  string `xml:"ExtentType"`
+			Value string `xml:"ExtentValue"`
+			Unit  string `xml:"ExtentUnit"`
+		} `xml:"Extent"`
+	} `xml:"DescriptiveDetail"`
+	Collateral struct {
+		Texts []struct {
+			Type string `xml:"TextType"`
+			Text struct {
+				Body string `xml:",innerxml"`
+			} `xml:"Text"`
+		} `xml:"TextContent"`
+	} `xml:"CollateralDetail"`
+	Publishing struct {
+		Publishers []struct {
+			Role string `xml:"PublishingRole"`
+			Name string `xml:"PublisherName"`
+		} `xml:"Publisher"`
+		Dates []struct {
+			Role string   `xml:"PublishingDateRole"`
+			Date onixDate `xml:"Date"`
+		} `xml:"PublishingDate"`
+	} `xml:"PublishingDetail"`
+	Supply []struct {
+		Details []onixSupplyDetail `xml:"SupplyDetail"`
+	} `xml:"ProductSupply"`
+}
+
+type onixIdentifier struct {
+	Type  string `xml:"ProductIDType"`
+	Value string `xml:"IDValue"`
+}
+
+type onixCollection struct {
+	Titles []onixTitleDetail `xml:"TitleDetail"`
+}
+
+type onixTitleDetail struct {
+	Type     string `xml:"TitleType"`
+	Elements []struct {
+		Level         string `xml:"TitleElementLevel"`
+		PartNumber    string `xml:"PartNumber"`
+		Text          string `xml:"TitleText"`
+		Prefix        string `xml:"TitlePrefix"`
+		WithoutPrefix string `xml:"TitleWithoutPrefix"`
+	} `xml:"TitleElement"`
+}
+
+type onixContributor struct {
+	Sequence       int      `xml:"SequenceNumber"`
+	Roles          []string `xml:"ContributorRole"`
+	PersonName     string   `xml:"PersonName"`
+	NameInverted   string   `xml:"PersonNameInverted"`
+	NamesBeforeKey string   `xml:"NamesBeforeKey"`
+	KeyNames       string   `xml:"KeyNames"`
+	CorporateName  string   `xml:"CorporateName"`
+}
+
+type onixDate struct {
+	Format string `xml:"dateformat,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type onixSupplyDetail struct {
+	Stock []struct {
+		OnHand string `xml:"OnHand"`
+	} `xml:"Stock"`
+	Prices []struct {
+		Type     string `xml:"PriceType"`
+		Amount   string `xml:"PriceAmount"`
+		Currency string `xml:"CurrencyCode"`
+	} `xml:"Price"`
+}
+
+// ONIX code list values the import understands.
+var (
+	// List 17: contributor roles
+	onixRoles = map[string]string{
+		"A01": models.RoleAuthor,
+		"B01": models.RoleEditor,
+		"B06": models.RoleTranslator,
+		"A12": models.RoleIllustrator,
+	}
+	// List 74: ISO 639-2 codes of languages with a two-letter code we
+	// store instead; others are kept as they are
+	onixLanguages = map[string]string{
+		"eng": "en", "fre": "fr", "spa": "es", "ger": "de", "ita": "it",
+		"por": "pt", "dut": "nl", "chi": "zh", "jpn": "ja", "kor": "ko",
+		"rus": "ru", "ara": "ar", "heb": "he", "hin": "hi", "pol": "pl",
+		"swe": "sv", "nor": "no", "dan": "da", "fin": "fi", "gre": "el",
+		"tur": "tr", "ukr": "uk", "cze": "cs", "lat": "la", "ice": "is",
+	}
+)
+
+// List 55: date formats
+var onixDateLayouts = map[string]string{"": "20060102", "00": "20060102", "01": "200601", "05": "2006"}
+
+var (
+	markup = regexp.MustCompile(`<[^>]*>`)
+	cdata  = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+)
+
+// ReadONIX reads the products of an ONIX 3.0 message written with reference
+// tags. Each product becomes one record, numbered by the line it starts on.
+func ReadONIX(data []byte) ([]Record, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+
+	var records []Record
+	rootSeen := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading ONIX: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := d.InputPos()
+
+		if !rootSeen {
+			rootSeen = true
+			if err := checkONIXRoot(start); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if start.Name.Local != "Product" {
+			continue
+		}
+
+		var op onixProduct
+		if err := d.DecodeElement(&op, &start); err != nil {
+			return nil, fmt.Errorf("reading ONIX product at line %d: %v", line, err)
+		}
+		rec := op.record()
+		rec.Line = line
+		records = append(records, rec)
+	}
+	if !rootSeen {
+		return nil, fmt.Errorf("the file is not an ONIX message")
+	}
+	return records, nil
+}
+
+func checkONIXRoot(root xml.StartElement) error {
+	switch root.Name.Local {
+	case "ONIXMessage":
+	case "ONIXmessage":
+		return fmt.Errorf("ONIX short tags are not supported; send the file with reference tags")
+	default:
+		return fmt.Errorf("the file is not an ONIX message")
+	}
+	for _, attr := range root.Attr {
+		if attr.Name.Local == "release" && !strings.HasPrefix(attr.Value, "3.") {
+			return fmt.Errorf("ONIX release %s is not supported; only ONIX 3.0 is", attr.Value)
+		}
+	}
+	return nil
+}
+
+// record maps the product onto catalog CSV columns.
+func (op onixProduct) record() Record {
+	rec := Record{Fields: make(map[string]string)}
+	for _, id := range op.Identifiers {
+		value := strings.TrimSpace(id.Value)
+		switch id.Type {
+		case "15", "02": // ISBN-13, ISBN-10
+			rec.Fields["isbn"] = value
+		case "03": // GTIN-13, an ISBN when it's in the Bookland range
+			if rec.Fields["isbn"] == "" && (strings.HasPrefix(value, "978") || strings.HasPrefix(value, "979")) {
+				rec.Fields["isbn"] = value
+			}
+		case "01": // proprietary
+			rec.Fields["sku"] = value
+		}
+	}
+
+	if op.NotificationType == "05" {
+		rec.Err = fmt.Errorf("delete notifications are not applied")
+		return rec
+	}
+
+	d := op.Descriptive
+	format, err := onixFormat(d.Form)
+	if err != nil {
+		rec.Err = err
+		return rec
+	}
+	rec.Fields["format"] = format
+
+	if title, _ := onixTitle(d.Titles, "01"); title != "" {
+		rec.Fields["title"] = title
+	}
+	for _, c := range d.Collections {
+		if series, volume := onixTitle(c.Titles, "02"); series != "" {
+			rec.Fields["series"], rec.Fields["series_volume"] = series, volume
+			break
+		}
+	}
+	if rec.Fields["series"] == "" {
+		rec.Fields["series"], rec.Fields["series_volume"] = onixTitle(d.Titles, "02")
+	}
+	if _, err := parseCount(rec.Fields["series_volume"]); err != nil {
+		delete(rec.Fields, "series_volume")
+	}
+
+	if contributors := onixContributors(d.Contributors); len(contributors) > 0 {
+		rec.Fields["contributors"] = formatContributors(contributors)
+	}
+
+	for _, l := range d.Languages {
+		if l.Role == "01" && len(l.Code) == 3 {
+			code := strings.ToLower(l.Code)
+			if two, ok := onixLanguages[code]; ok {
+				code = two
+			}
+			rec.Fields["language"] = code
+			break
+		}
+	}
+	for _, e := range d.Extents {
+		if (e.Type == "00" || e.Type == "11") && e.Unit == "03" {
+			rec.Fields["page_count"] = strings.TrimSpace(e.Value)
+			break
+		}
+	}
+
+	rec.Fields["description"] = onixText(op, "03")
+	if rec.Fields["description"] == "" {
+		rec.Fields["description"] = onixText(op, "02")
+	}
+
+	for _, pub := range op.Publishing.Publishers {
+		if pub.Role == "01" {
+			rec.Fields["publisher"] = strings.TrimSpace(pub.Name)
+			break
+		}
+	}
+	for _, date := range op.Publishing.Dates {
+		if date.Role == "01" {
+			if t, ok := date.Date.parse(); ok {
+				rec.Fields["publication_date"] = t.Format(dateLayout)
+			}
+			break
+		}
+	}
+
+	op.supply(rec.Fields)
+	return rec
+}
+
+// onixFormat maps an ONIX product form (list 150) to a variant format.
+func onixFormat(form string) (string, error) {
+	switch {
+	case form == "BB":
+		return models.FormatHardcover, nil
+	case strings.HasPrefix(form, "B"):
+		return models.FormatPaperback, nil
+	case strings.HasPrefix(form, "E"):
+		return models.FormatEbook, nil
+	}
+	return "", fmt.Errorf("product form %q is not a book format we sell", form)
+}
+
+// onixTitle returns the distinctive title at the given title element level,
+// with its part number.
+func onixTitle(titles []onixTitleDetail, level string) (title, part string) {
+	for _, t := range titles {
+		if t.Type != "01" {
+			continue
+		}
+		for _, e := range t.Elements {
+			if e.Level != level {
+				continue
+			}
+			title = strings.TrimSpace(e.Text)
+			if title == "" {
+				title = strings.TrimSpace(e.Prefix + " " + e.WithoutPrefix)
+			}
+			return title, strings.TrimSpace(e.PartNumber)
+		}
+	}
+	return "", ""
+}
+
+// onixContributors returns the contributors in sequence, leaving out roles
+// the shop doesn't show.
+func onixContributors(list []onixContributor) []models.Contributor {
+	slices.SortStableFunc(list, func(a, b onixContributor) int { return cmp.Compare(a.Sequence, b.Sequence) })
+
+	var contributors []models.Contributor
+	for _, c := range list {
+		name := strings.TrimSpace(c.PersonName)
+		if name == "" && c.KeyNames != "" {
+			name = strings.TrimSpace(c.NamesBeforeKey + " " + c.KeyNames)
+		}
+		if name == "" && c.NameInverted != "" {
+			last, first, _ := strings.Cut(c.NameInverted, ",")
+			name = strings.TrimSpace(strings.TrimSpace(first) + " " + strings.TrimSpace(last))
+		}
+		if name == "" {
+			name = strings.TrimSpace(c.CorporateName)
+		}
+		// The contributors field is ";"-separated
+		name = strings.ReplaceAll(name, ";", ",")
+		if name == "" {
+			continue
+		}
+
+		for _, code := range c.Roles {
+			if role, ok := onixRoles[code]; ok {
+				contributors = append(contributors, models.Contributor{Name: name, Role: role})
+				break
+			}
+		}
+	}
+	return contributors
+}
+
+// onixText returns the product's text of the given type (list 153) as plain
+// text.
+func onixText(op onixProduct, textType string) string {
+	for _, t := range op.Collateral.Texts {
+		if t.Type != textType {
+			continue
+		}
+		// XHTML arrives as markup and HTML escaped or in CDATA; unescape
+		// once so both are tags, then drop the tags
+		body := cdata.ReplaceAllString(t.Text.Body, "$1")
+		text := markup.ReplaceAllString(html.UnescapeString(body), " ")
+		return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+	}
+	return ""
+}
+
+// parse reads a publishing date in the formats publishers use: YYYYMMDD by
+// default, or just the month or year.
+func (d onixDate) parse() (time.Time, bool) {
+	layout, ok := onixDateLayouts[d.Format]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, strings.TrimSpace(d.Value))
+	return t, err == nil
+}
+
+// supply sets stock on hand and the recommended retail prices in the
+// currencies the shop sells in.
+func (op onixProduct) supply(fields map[string]string) {
+	stockSeen := false
+	var onHand int
+	for _, s := range op.Supply {
+		for _, detail := range s.Details {
+			for _, stock := range detail.Stock {
+				if n, err := strconv.Atoi(strings.TrimSpace(stock.OnHand)); err == nil && n >= 0 {
+					onHand += n
+					stockSeen = true
+				}
+			}
+			for _, price := range detail.Prices {
+				if price.Type != "" && price.Type != "01" && price.Type != "02" {
+					continue
+				}
+				currency := strings.ToUpper(strings.TrimSpace(price.Currency))
+				if !services.IsSupportedCurrency(currency) {
+					continue
+				}
+				column := "price"
+				if currency != services.BaseCurrency {
+					column = priceColumn(currency)
+				}
+				if fields[column] == "" {
+					fields[column] = strings.TrimSpace(price.Amount)
+				}
+			}
+		}
+	}
+	if stockSeen {
+		fields["stock"] = strconv.Itoa(onHand)
+	}
+}
@@ -0,0 +1,39 @@
+package catalog
+
+import (
+	"log"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+)
+
+// publishInterval is how often scheduled products are checked, so one goes
+// live at most this long after its publish time.
+const publishInterval = time.Minute
+
+// StartPublisher starts the goroutine that publishes scheduled products,
+// catching up on any that came due while the server was down.
+func StartPublisher() {
+	go func() {
+		ticker := time.NewTicker(publishInterval)
+		defer ticker.Stop()
+
+		for {
+			publishDue()
+			<-ticker.C
+		}
+	}()
+}
+
+func publishDue() {
+	n, err := db.PublishScheduled()
+	if err != nil {
+		log.Printf("Failed to publish scheduled products: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Published %d scheduled products", n)
+		cache.UpdateCache()
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func GetAddressByID(id int) (models.Address, error) {
+	var a models.Address
+
+	err := db.QueryRow(ctx, `
+		SELECT id, name, line1, line2, city, state, postal_code, country, phone, created_at
+		FROM addresses
+		WHERE id = $1
+	`, id).Scan(&a.ID, &a.Name, &a.Line1, &a.Line2, &a.City, &a.State, &a.PostalCode, &a.Country, &a.Phone, &a.CreatedAt)
+	if err != nil {
+		return models.Address{}, fmt.Errorf("error fetching address: %v", err)
+	}
+
+	return a, nil
+}
+
+// insertAddress stores an address as part of an order transaction. An empty
+// address (no street line) is skipped and reported as ID 0.
+func insertAddress(tx pgx.Tx, a models.Address) (int, error) {
+	if a.Line1 == "" {
+		return 0, nil
+	}
+
+	var id int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO addresses (name, line1, line2, city, state, postal_code, country, phone)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, a.Name, a.Line1, a.Line2, a.City, a.State, a.PostalCode, a.Country, a.Phone).Scan(&id)
+	return id, err
+}
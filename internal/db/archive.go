@@ -0,0 +1,188 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+var (
+	// ErrNotArchived is returned when purging something that is still live.
+	ErrNotArchived = errors.New("only archived items can be purged")
+	// ErrInUse is returned when purging something an order refers to.
+	ErrInUse = errors.New("orders refer to this item, so it can only be archived")
+)
+
+// ArchiveProduct hides a product from the storefront, search and carts. Its
+// variants are left as they are, so restoring it brings them back too.
+func ArchiveProduct(id int) error {
+	return setArchived(`UPDATE products SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL`, id)
+}
+
+// RestoreProduct puts an archived product back on sale.
+func RestoreProduct(id int) error {
+	return setArchived(`UPDATE products SET archived_at = NULL WHERE id = $1`, id)
+}
+
+// ArchiveVariant withdraws one format of a product, keeping it for orders.
+func ArchiveVariant(id int) error {
+	return setArchived(`UPDATE variants SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL`, id)
+}
+
+// RestoreVariant puts an archived variant back on sale.
+func RestoreVariant(id int) error {
+	return setArchived(`UPDATE variants SET archived_at = NULL WHERE id = $1`, id)
+}
+
+func setArchived(sql string, id int) error {
+	if _, err := db.Exec(ctx, sql, id); err != nil {
+		log.Printf("Failed to archive or restore (id: %d): %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetArchivedProducts returns the archived products, and the live products
+// with archived variants, each with all of its variants.
+func GetArchivedProducts() ([]models.Product, error) {
+	rows, err := db.Query(ctx, `
+		SELECT b.id, b.title, b.author, b.archived_at,
+		       v.id, v.format, v.isbn, v.sku, v.stock, v.cents, v.archived_at
+		FROM products b
+		JOIN variants v ON v.product_id = b.id
+		WHERE b.archived_at IS NOT NULL
+		   OR EXISTS (SELECT 1 FROM variants a WHERE a.product_id = b.id AND a.archived_at IS NOT NULL)
+		ORDER BY COALESCE(b.archived_at, (
+			SELECT MAX(a.archived_at) FROM variants a WHERE a.product_id = b.id
+		)) DESC, b.id, v.format
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching archived products: %v", err)
+	}
+	defer rows.Close()
+
+	var products []models.Product
+	for rows.Next() {
+		var p models.Product
+		var v models.Variant
+		err := rows.Scan(&p.ID, &p.Title, &p.Author, &p.ArchivedAt,
+			&v.ID, &v.Format, &v.ISBN, &v.SKU, &v.Stock, &v.Cents, &v.ArchivedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning archived product: %v", err)
+		}
+		v.Product_ID = p.ID
+		if n := len(products); n == 0 || products[n-1].ID != p.ID {
+			products = append(products, p)
+		}
+		last := &products[len(products)-1]
+		last.Variants = append(last.Variants, v)
+	}
+	return products, rows.Err()
+}
+
+// PurgeProduct deletes an archived product for good, with its variants,
+// gallery and any carts holding it. It returns the product's image paths for
+// images.RemoveUnused.
+func PurgeProduct(id int) (imagePaths []string, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var archived, ordered bool
+	err = tx.QueryRow(ctx, `
+		SELECT archived_at IS NOT NULL,
+		       EXISTS (SELECT 1 FROM order_items oi JOIN variants v ON v.id = oi.variant_id WHERE v.product_id = p.id)
+		FROM products p
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&archived, &ordered)
+	if err != nil {
+		return nil, err
+	}
+	if err = purgeable(archived, ordered); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT image_path FROM variants WHERE product_id = $1 AND image_path <> ''
+		UNION
+		SELECT image_path FROM product_images WHERE product_id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	if imagePaths, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		DELETE FROM cart_items WHERE variant_id IN (SELECT id FROM variants WHERE product_id = $1)
+	`, id); err != nil {
+		return nil, err
+	}
+	// Variants, prices, contributors, categories and images cascade
+	if _, err = tx.Exec(ctx, `DELETE FROM products WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	return imagePaths, nil
+}
+
+// PurgeVariant deletes an archived variant for good, removing it from any
+// carts. It returns the variant's image path for images.RemoveUnused.
+func PurgeVariant(id int) (imagePath string, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var archived, ordered bool
+	err = tx.QueryRow(ctx, `
+		SELECT archived_at IS NOT NULL, image_path,
+		       EXISTS (SELECT 1 FROM order_items WHERE variant_id = v.id)
+		FROM variants v
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&archived, &imagePath, &ordered)
+	if err != nil {
+		return "", err
+	}
+	if err = purgeable(archived, ordered); err != nil {
+		return "", err
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM cart_items WHERE variant_id = $1`, id); err != nil {
+		return "", err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM variants WHERE id = $1`, id); err != nil {
+		return "", err
+	}
+	return imagePath, nil
+}
+
+func purgeable(archived, ordered bool) error {
+	switch {
+	case !archived:
+		return ErrNotArchived
+	case ordered:
+		return ErrInUse
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a name into a URL path segment, matching the slugs the
+// schema migration gave existing authors. Names with no ASCII letters or
+// digits get prefix and a short hash instead.
+func slugify(name, prefix string) string {
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		sum := md5.Sum([]byte(name))
+		slug = prefix + "-" + hex.EncodeToString(sum[:])[:8]
+	}
+	return slug
+}
+
+func GetAuthorBySlug(slug string) (models.Author, error) {
+	var a models.Author
+	err := db.QueryRow(ctx, `
+		SELECT id, name, slug, bio, created_at
+		FROM authors
+		WHERE slug = $1
+	`, slug).Scan(&a.ID, &a.Name, &a.Slug, &a.Bio, &a.CreatedAt)
+	if err != nil {
+		return models.Author{}, fmt.Errorf("error fetching author: %v", err)
+	}
+	return a, nil
+}
+
+func GetContributorsByProductID(product_id int) ([]models.Contributor, error) {
+	rows, err := db.Query(ctx, `
+		SELECT pc.product_id, pc.author_id, pc.role, pc.position, a.name, a.slug
+		FROM product_contributors pc
+		JOIN authors a ON a.id = pc.author_id
+		WHERE pc.product_id = $1
+		ORDER BY pc.role <> 'author', pc.position, a.name
+	`, product_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching contributors: %v", err)
+	}
+	defer rows.Close()
+
+	var contributors []models.Contributor
+	for rows.Next() {
+		var c models.Contributor
+		if err := rows.Scan(&c.Product_ID, &c.Author_ID, &c.Role, &c.Position, &c.Name, &c.Slug); err != nil {
+			return nil, fmt.Errorf("error scanning contributor: %v", err)
+		}
+		contributors = append(contributors, c)
+	}
+	return contributors, rows.Err()
+}
+
+// GetProductsByAuthorID returns every book the author contributed to in any
+// role, newest first.
+func GetProductsByAuthorID(author_id int) ([]models.Product, error) {
+	rows, err := db.Query(ctx, `
+		SELECT p.id
+		FROM products p
+		JOIN product_contributors pc ON pc.product_id = p.id
+		WHERE pc.author_id = $1 AND `+visibleProduct("p")+`
+		GROUP BY p.id
+		ORDER BY p.publication_date DESC NULLS LAST, p.created_at DESC, p.id
+	`, author_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching author's products: %v", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("error scanning author's products: %v", err)
+	}
+
+	return GetProductsByIDs(ids)
+}
+
+// SetProductContributors replaces a product's contributors, creating authors
+// that don't exist yet, and rewrites the product's byline from the authors.
+func SetProductContributors(product_id int, contributors []models.Contributor) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to save contributors: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	return setContributors(tx, product_id, contributors)
+}
+
+// setContributors does the work of SetProductContributors inside tx.
+func setContributors(tx pgx.Tx, product_id int, contributors []models.Contributor) error {
+	_, err := tx.Exec(ctx, `DELETE FROM product_contributors WHERE product_id = $1`, product_id)
+	if err != nil {
+		return err
+	}
+
+	var authors []string
+	for i, c := range contributors {
+		authorID, err := findOrCreateAuthor(tx, c.Name)
+		if err != nil {
+			log.Printf("Failed to save author %q: %v", c.Name, err)
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO product_contributors (product_id, author_id, role, position)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+		`, product_id, authorID, c.Role, i)
+		if err != nil {
+			log.Printf("Failed to insert contributor: %v", err)
+			return err
+		}
+
+		if c.Role == models.RoleAuthor {
+			authors = append(authors, strings.TrimSpace(c.Name))
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE products SET author = $1 WHERE id = $2`, byline(authors), product_id)
+	return err
+}
+
+func findOrCreateAuthor(tx pgx.Tx, name string) (int, error) {
+	name = strings.TrimSpace(name)
+
+	var id int
+	err := tx.QueryRow(ctx, `SELECT id FROM authors WHERE LOWER(name) = LOWER($1)`, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != pgx.ErrNoRows {
+		return 0, err
+	}
+
+	// Two different names can slugify the same way; the later one gets its
+	// ID appended
+	err = tx.QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('authors', 'id'))`).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	slug := slugify(name, "author")
+	var taken bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM authors WHERE slug = $1)`, slug).Scan(&taken); err != nil {
+		return 0, err
+	}
+	if taken {
+		slug = fmt.Sprintf("%s-%d", slug, id)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO authors (id, name, slug) VALUES ($1, $2, $3)`, id, name, slug)
+	return id, err
+}
+
+// byline joins author names the way they're printed on a cover:
+// "A", "A and B", "A, B and C".
+func byline(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,340 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// FindVariants returns the variants with the given ISBN, SKU or barcode,
+// such as to tell whether an imported row is new. Blank values match nothing.
+func FindVariants(isbn, sku, barcode string) ([]models.Variant, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, product_id, format, isbn, sku, barcode, stock, cents, image_path
+		FROM variants
+		WHERE ($1 <> '' AND isbn = $1) OR ($2 <> '' AND sku = $2) OR ($3 <> '' AND barcode = $3)
+		ORDER BY id
+	`, isbn, sku, barcode)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching variants: %v", err)
+	}
+	defer rows.Close()
+
+	var variants []models.Variant
+	for rows.Next() {
+		var v models.Variant
+		if err := rows.Scan(&v.ID, &v.Product_ID, &v.Format, &v.ISBN, &v.SKU, &v.Barcode, &v.Stock, &v.Cents, &v.ImagePath); err != nil {
+			return nil, fmt.Errorf("error scanning variant: %v", err)
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// SaveImportedVariant writes one imported row in a single transaction: the
+// product, its contributors when the row names any, the variant and the
+// variant's explicit prices. Products and variants with no ID are inserted
+// and get their new IDs set.
+func SaveImportedVariant(p *models.Product, v *models.Variant) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to save imported variant: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if p.ID == 0 {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO products (title, author, description, publisher, publication_date,
+			                      language, page_count, series, series_volume)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`, p.Title, p.Author, p.Description, p.Publisher, p.PublicationDate,
+			p.Language, p.PageCount, p.Series, p.SeriesVolume).Scan(&p.ID)
+	} else {
+		_, err = tx.Exec(ctx, `
+			UPDATE products
+			SET title = $1, description = $2, publisher = $3, publication_date = $4,
+			    language = $5, page_count = $6, series = $7, series_volume = $8,
+			    version = version + 1
+			WHERE id = $9
+		`, p.Title, p.Description, p.Publisher, p.PublicationDate,
+			p.Language, p.PageCount, p.Series, p.SeriesVolume, p.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to save imported product %q: %v", p.Title, err)
+		return err
+	}
+
+	if p.Contributors != nil {
+		if err = setContributors(tx, p.ID, p.Contributors); err != nil {
+			return err
+		}
+	}
+
+	v.Product_ID = p.ID
+	kind := models.MovementAdjustment
+	if v.ID == 0 {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO variants (product_id, format, isbn, sku, barcode, stock, cents, image_path)
+			VALUES ($1, $2, $3, $4, $5, 0, $6, $7)
+			RETURNING id
+		`, v.Product_ID, v.Format, v.ISBN, v.SKU, v.Barcode, v.Cents, v.ImagePath).Scan(&v.ID)
+		kind = models.MovementReceipt
+	} else {
+		_, err = tx.Exec(ctx, `
+			UPDATE variants
+			SET format = $1, isbn = $2, sku = $3, barcode = $4, cents = $5, image_path = $6
+			WHERE id = $7
+		`, v.Format, v.ISBN, v.SKU, v.Barcode, v.Cents, v.ImagePath, v.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to save imported variant %q: %v", v.ISBN+v.SKU, err)
+		return err
+	}
+	if err = setStock(tx, v.ID, v.Stock, kind, "Catalog import"); err != nil {
+		return err
+	}
+
+	for currency, cents := range v.Prices {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO variant_prices (variant_id, currency, cents)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (variant_id, currency) DO UPDATE SET cents = EXCLUDED.cents
+		`, v.ID, currency, cents)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCatalogExport returns every product that isn't archived with its
+// contributors and its variants with their explicit prices, ordered by
+// product and then variant.
+func GetCatalogExport() ([]models.Product, error) {
+	rows, err := db.Query(ctx, `
+		SELECT p.id, p.title, p.author, COALESCE(p.description, ''), p.product_type,
+		       p.publisher, p.publication_date, p.language, p.page_count, p.series, p.series_volume,
+		       v.id, v.format, v.isbn, v.sku, v.barcode, v.stock, v.cents, v.image_path
+		FROM products p
+		JOIN variants v ON v.product_id = p.id
+		WHERE `+liveProduct("p")+` AND `+visibleVariant("v")+`
+		ORDER BY p.id, v.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting catalog: %v", err)
+	}
+	defer rows.Close()
+
+	var products []models.Product
+	var variantIDs []int
+	for rows.Next() {
+		var p models.Product
+		var v models.Variant
+		err := rows.Scan(&p.ID, &p.Title, &p.Author, &p.Description, &p.ProductType,
+			&p.Publisher, &p.PublicationDate, &p.Language, &p.PageCount, &p.Series, &p.SeriesVolume,
+			&v.ID, &v.Format, &v.ISBN, &v.SKU, &v.Barcode, &v.Stock, &v.Cents, &v.ImagePath)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning catalog: %v", err)
+		}
+		v.Product_ID = p.ID
+		if n := len(products); n == 0 || products[n-1].ID != p.ID {
+			products = append(products, p)
+		}
+		last := &products[len(products)-1]
+		last.Variants = append(last.Variants, v)
+		variantIDs = append(variantIDs, v.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error exporting catalog: %v", err)
+	}
+
+	prices, err := GetVariantPriceLists(variantIDs)
+	if err != nil {
+		return nil, err
+	}
+	contributors, err := getAllContributors()
+	if err != nil {
+		return nil, err
+	}
+	for i := range products {
+		products[i].Contributors = contributors[products[i].ID]
+		for j := range products[i].Variants {
+			products[i].Variants[j].Prices = prices[products[i].Variants[j].ID]
+		}
+	}
+	return products, nil
+}
+
+// getAllContributors returns every product's contributors keyed by product
+// ID, in the order GetContributorsByProductID gives them.
+func getAllContributors() (map[int][]models.Contributor, error) {
+	rows, err := db.Query(ctx, `
+		SELECT pc.product_id, pc.author_id, pc.role, pc.position, a.name, a.slug
+		FROM product_contributors pc
+		JOIN authors a ON a.id = pc.author_id
+		ORDER BY pc.product_id, pc.role <> 'author', pc.position, a.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching contributors: %v", err)
+	}
+	defer rows.Close()
+
+	contributors := make(map[int][]models.Contributor)
+	for rows.Next() {
+		var c models.Contributor
+		if err := rows.Scan(&c.Product_ID, &c.Author_ID, &c.Role, &c.Position, &c.Name, &c.Slug); err != nil {
+			return nil, fmt.Errorf("error scanning contributor: %v", err)
+		}
+		contributors[c.Product_ID] = append(contributors[c.Product_ID], c)
+	}
+	return contributors, rows.Err()
+}
+
+const importJobColumns = `id, format, filename, dry_run, status, total, processed,
+	created, updated, failed, error, created_at, finished_at`
+
+func scanImportJob(row pgx.Row) (models.ImportJob, error) {
+	var j models.ImportJob
+	err := row.Scan(&j.ID, &j.Format, &j.Filename, &j.DryRun, &j.Status, &j.Total, &j.Processed,
+		&j.Created, &j.Updated, &j.Failed, &j.Error, &j.CreatedAt, &j.FinishedAt)
+	return j, err
+}
+
+// InsertImportJob queues an import of the job's file and returns its ID.
+func InsertImportJob(j models.ImportJob) (int, error) {
+	var id int
+	err := db.QueryRow(ctx, `
+		INSERT INTO import_jobs (format, filename, data, dry_run)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, j.Format, j.Filename, j.Data, j.DryRun).Scan(&id)
+	if err != nil {
+		log.Printf("Failed to queue import: %v", err)
+	}
+	return id, err
+}
+
+// GetImportJob returns an import's progress, without its file.
+func GetImportJob(id int) (models.ImportJob, error) {
+	j, err := scanImportJob(db.QueryRow(ctx, `
+		SELECT `+importJobColumns+` FROM import_jobs WHERE id = $1
+	`, id))
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("error fetching import: %v", err)
+	}
+	return j, nil
+}
+
+// GetImportJobData returns the file uploaded for an import.
+func GetImportJobData(id int) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow(ctx, `SELECT data FROM import_jobs WHERE id = $1`, id).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching import file: %v", err)
+	}
+	return data, nil
+}
+
+// GetRecentImportJobs returns the latest imports, newest first.
+func GetRecentImportJobs(limit int) ([]models.ImportJob, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+importJobColumns+` FROM import_jobs ORDER BY id DESC LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching imports: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.ImportJob
+	for rows.Next() {
+		j, err := scanImportJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning import: %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// UpdateImportProgress saves the job's status and counts, and writes the
+// outcomes of the rows processed since the last update.
+func UpdateImportProgress(j models.ImportJob, rows []models.ImportRow) error {
+	if len(rows) > 0 {
+		_, err := db.CopyFrom(ctx, pgx.Identifier{"import_job_rows"},
+			[]string{"job_id", "line", "action", "key", "title", "message"},
+			pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+				r := rows[i]
+				return []any{j.ID, r.Line, r.Action, r.Key, r.Title, r.Message}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("error saving import rows: %v", err)
+		}
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE import_jobs
+		SET status = $1, total = $2, processed = $3, created = $4, updated = $5,
+		    failed = $6, error = $7, finished_at = $8
+		WHERE id = $9
+	`, j.Status, j.Total, j.Processed, j.Created, j.Updated, j.Failed, j.Error, j.FinishedAt, j.ID)
+	if err != nil {
+		return fmt.Errorf("error saving import progress: %v", err)
+	}
+	return nil
+}
+
+// GetImportRows returns a page of an import's row outcomes, in file order,
+// optionally only those with the given action.
+func GetImportRows(job_id int, action string, page *models.Pagination) ([]models.ImportRow, error) {
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM import_job_rows
+		WHERE job_id = $1 AND ($2 = '' OR action = $2)
+	`, job_id, action).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("error counting import rows: %v", err)
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT job_id, line, action, key, title, message
+		FROM import_job_rows
+		WHERE job_id = $1 AND ($2 = '' OR action = $2)
+		ORDER BY line
+		LIMIT $3 OFFSET $4
+	`, job_id, action, page.PageSize, page.Offset())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching import rows: %v", err)
+	}
+	defer rows.Close()
+
+	var out []models.ImportRow
+	for rows.Next() {
+		var r models.ImportRow
+		if err := rows.Scan(&r.Job_ID, &r.Line, &r.Action, &r.Key, &r.Title, &r.Message); err != nil {
+			return nil, fmt.Errorf("error scanning import row: %v", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// FailInterruptedImports marks imports that were queued or running when the
+// server stopped as failed. Rows already saved stay saved.
+func FailInterruptedImports() error {
+	_, err := db.Exec(ctx, `
+		UPDATE import_jobs
+		SET status = 'failed', error = 'Interrupted by a server restart', finished_at = CURRENT_TIMESTAMP
+		WHERE status IN ('queued', 'running')
+	`)
+	return err
+}
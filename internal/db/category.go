@@ -0,0 +1,383 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const categoryColumns = `c.id, c.parent_id, c.name, c.slug, c.description, c.position, c.created_at`
+
+func scanCategory(row pgx.Row, extra ...any) (models.Category, error) {
+	var c models.Category
+	dest := append([]any{&c.ID, &c.Parent_ID, &c.Name, &c.Slug, &c.Description, &c.Position, &c.CreatedAt}, extra...)
+	err := row.Scan(dest...)
+	return c, err
+}
+
+// GetAllCategories returns every category as a flat list, siblings in display
+// order, with the number of products filed directly under each.
+func GetAllCategories() ([]models.Category, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+categoryColumns+`, COUNT(pc.product_id)
+		FROM categories c
+		LEFT JOIN product_categories pc ON pc.category_id = c.id
+		GROUP BY c.id
+		ORDER BY c.position, c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var count int
+		c, err := scanCategory(rows, &count)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning category: %v", err)
+		}
+		c.ProductCount = count
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func GetCategoryBySlug(slug string) (models.Category, error) {
+	c, err := scanCategory(db.QueryRow(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories c
+		WHERE c.slug = $1
+	`, slug))
+	if err != nil {
+		return models.Category{}, fmt.Errorf("error fetching category: %v", err)
+	}
+	return c, nil
+}
+
+func GetCategoriesByProductID(product_id int) ([]models.Category, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories c
+		JOIN product_categories pc ON pc.category_id = c.id
+		WHERE pc.product_id = $1
+		ORDER BY pc.position, c.name
+	`, product_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching product categories: %v", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning category: %v", err)
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func InsertCategory(c models.Category) (int, error) {
+	if c.Slug == "" {
+		c.Slug = slugify(c.Name, "category")
+	}
+
+	var id int
+	err := db.QueryRow(ctx, `
+		INSERT INTO categories (parent_id, name, slug, description, position)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`, c.Parent_ID, c.Name, c.Slug, c.Description, c.Position).Scan(&id)
+	if err != nil {
+		log.Printf("Failed to insert category: %v", err)
+	}
+	return id, err
+}
+
+// UpdateCategory saves a category, refusing to move it underneath itself.
+func UpdateCategory(c models.Category) error {
+	if c.Slug == "" {
+		c.Slug = slugify(c.Name, "category")
+	}
+
+	if c.Parent_ID != nil {
+		var cycle bool
+		err := db.QueryRow(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+		`, c.ID, *c.Parent_ID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return fmt.Errorf("a category can't be moved under itself")
+		}
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE categories
+		SET parent_id = $1, name = $2, slug = $3, description = $4, position = $5
+		WHERE id = $6
+	`, c.Parent_ID, c.Name, c.Slug, c.Description, c.Position, c.ID)
+	if err != nil {
+		log.Printf("Failed to update category (id: %d): %v\n", c.ID, err)
+	}
+	return err
+}
+
+// DeleteCategory removes a category and moves its subcategories up to its
+// parent. Products stay in the catalog; they just lose the category.
+func DeleteCategory(id int) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to delete category: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE categories
+		SET parent_id = (SELECT parent_id FROM categories WHERE id = $1)
+		WHERE parent_id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, id)
+	return err
+}
+
+// SetProductCategories replaces a product's categories. The first one is its
+// main category.
+func SetProductCategories(product_id int, categoryIDs []int) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to save product categories: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	return setCategories(tx, product_id, categoryIDs)
+}
+
+func setCategories(tx pgx.Tx, product_id int, categoryIDs []int) error {
+	_, err := tx.Exec(ctx, `DELETE FROM product_categories WHERE product_id = $1`, product_id)
+	if err != nil {
+		return err
+	}
+
+	for i, categoryID := range categoryIDs {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO product_categories (product_id, category_id, position)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, product_id, categoryID, i)
+		if err != nil {
+			log.Printf("Failed to insert product category: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetProductsInCategory returns a page of the products filed under the
+// category or any of its subcategories, by title, and fills in page.Total.
+func GetProductsInCategory(category_id int, page *models.Pagination) ([]models.Product, error) {
+	return pageOfProducts(`
+		FROM products p
+		JOIN product_categories pc ON pc.product_id = p.id
+		WHERE `+visibleProduct("p")+` AND pc.category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree
+		)
+	`, `p.title, p.id`, page, category_id)
+}
+
+// GetProductsByTag returns a page of the products with the tag, by title, and
+// fills in page.Total.
+func GetProductsByTag(tag_id int, page *models.Pagination) ([]models.Product, error) {
+	return pageOfProducts(`
+		FROM products p
+		JOIN product_tags pt ON pt.product_id = p.id
+		WHERE `+visibleProduct("p")+` AND pt.tag_id = $1
+	`, `p.title, p.id`, page, tag_id)
+}
+
+// pageOfProducts counts the products selected by from (a FROM ... WHERE
+// clause over products p) and loads the requested page of them, sorted by
+// order, which may use aggregates since rows are grouped by p.id.
+func pageOfProducts(from, order string, page *models.Pagination, args ...any) ([]models.Product, error) {
+	err := db.QueryRow(ctx, `SELECT COUNT(DISTINCT p.id) `+from, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("error counting products: %v", err)
+	}
+
+	n := len(args)
+	rows, err := db.Query(ctx, `
+		SELECT p.id `+from+`
+		GROUP BY p.id
+		ORDER BY `+order+`
+		LIMIT $`+strconv.Itoa(n+1)+` OFFSET $`+strconv.Itoa(n+2),
+		append(args, page.PageSize, page.Offset())...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching products: %v", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("error scanning products: %v", err)
+	}
+
+	return GetProductsByIDs(ids)
+}
+
+// GetAllTags returns every tag with how many products use it.
+func GetAllTags() ([]models.Tag, error) {
+	rows, err := db.Query(ctx, `
+		SELECT t.id, t.name, t.slug, t.created_at, COUNT(pt.product_id)
+		FROM tags t
+		LEFT JOIN product_tags pt ON pt.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY t.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.CreatedAt, &t.ProductCount); err != nil {
+			return nil, fmt.Errorf("error scanning tag: %v", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func GetTagBySlug(slug string) (models.Tag, error) {
+	var t models.Tag
+	err := db.QueryRow(ctx, `
+		SELECT id, name, slug, created_at FROM tags WHERE slug = $1
+	`, slug).Scan(&t.ID, &t.Name, &t.Slug, &t.CreatedAt)
+	if err != nil {
+		return models.Tag{}, fmt.Errorf("error fetching tag: %v", err)
+	}
+	return t, nil
+}
+
+func GetTagsByProductID(product_id int) ([]models.Tag, error) {
+	rows, err := db.Query(ctx, `
+		SELECT t.id, t.name, t.slug, t.created_at
+		FROM tags t
+		JOIN product_tags pt ON pt.tag_id = t.id
+		WHERE pt.product_id = $1
+		ORDER BY t.name
+	`, product_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching product tags: %v", err)
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning tag: %v", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// SetProductTags replaces a product's tags with names, creating any tags
+// that don't exist yet. Tags are matched by slug, so "Sci-Fi" and "sci fi"
+// are the same tag.
+func SetProductTags(product_id int, names []string) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to save product tags: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	return setTags(tx, product_id, names)
+}
+
+func setTags(tx pgx.Tx, product_id int, names []string) error {
+	_, err := tx.Exec(ctx, `DELETE FROM product_tags WHERE product_id = $1`, product_id)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var tagID int
+		err = tx.QueryRow(ctx, `
+			INSERT INTO tags (name, slug) VALUES ($1, $2)
+			ON CONFLICT (slug) DO UPDATE SET slug = EXCLUDED.slug
+			RETURNING id
+		`, name, slugify(name, "tag")).Scan(&tagID)
+		if err != nil {
+			log.Printf("Failed to save tag %q: %v", name, err)
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO product_tags (product_id, tag_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, product_id, tagID)
+		if err != nil {
+			log.Printf("Failed to insert product tag: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func DeleteTag(id int) error {
+	_, err := db.Exec(ctx, `DELETE FROM tags WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("Failed to delete tag (id: %d): %v\n", id, err)
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func GetExchangeRate(currency string) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+
+	err := db.QueryRow(ctx, `
+		SELECT currency, rate::float8, charm_pricing, updated_at
+		FROM exchange_rates
+		WHERE currency = $1
+	`, currency).Scan(&rate.Currency, &rate.Rate, &rate.CharmPricing, &rate.UpdatedAt)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("error fetching exchange rate: %v", err)
+	}
+
+	return rate, nil
+}
+
+func GetAllExchangeRates() ([]models.ExchangeRate, error) {
+	rows, err := db.Query(ctx, `
+		SELECT currency, rate::float8, charm_pricing, updated_at
+		FROM exchange_rates
+		ORDER BY currency
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []models.ExchangeRate
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.CharmPricing, &rate.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning exchange rate: %v", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func UpsertExchangeRate(currency string, rate float64, charmPricing bool) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO exchange_rates (currency, rate, charm_pricing, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (currency) DO UPDATE
+		SET rate = EXCLUDED.rate, charm_pricing = EXCLUDED.charm_pricing, updated_at = CURRENT_TIMESTAMP
+	`, currency, rate, charmPricing)
+	if err != nil {
+		log.Printf("Failed to update exchange rate (%s): %v\n", currency, err)
+	}
+	return err
+}
+
+// GetVariantPrices returns the explicit prices for the given variants in one
+// currency, keyed by variant ID. Variants without a price list entry are absent.
+func GetVariantPrices(variantIDs []int, currency string) (map[int]int64, error) {
+	rows, err := db.Query(ctx, `
+		SELECT variant_id, cents
+		FROM variant_prices
+		WHERE variant_id = ANY($1) AND currency = $2
+	`, variantIDs, currency)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching variant prices: %v", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[int]int64)
+	for rows.Next() {
+		var variantID int
+		var cents int64
+		if err := rows.Scan(&variantID, &cents); err != nil {
+			return nil, fmt.Errorf("error scanning variant price: %v", err)
+		}
+		prices[variantID] = cents
+	}
+
+	return prices, rows.Err()
+}
+
+// GetVariantPriceLists returns every explicit price for the given variants,
+// keyed by variant ID and then currency.
+func GetVariantPriceLists(variantIDs []int) (map[int]map[string]int64, error) {
+	rows, err := db.Query(ctx, `
+		SELECT variant_id, currency, cents
+		FROM variant_prices
+		WHERE variant_id = ANY($1)
+	`, variantIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching variant prices: %v", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[int]map[string]int64)
+	for rows.Next() {
+		var p models.VariantPrice
+		if err := rows.Scan(&p.Variant_ID, &p.Currency, &p.Cents); err != nil {
+			return nil, fmt.Errorf("error scanning variant price: %v", err)
+		}
+		if prices[p.Variant_ID] == nil {
+			prices[p.Variant_ID] = make(map[string]int64)
+		}
+		prices[p.Variant_ID][p.Currency] = p.Cents
+	}
+
+	return prices, rows.Err()
+}
@@ -23,21 +23,28 @@ func InitDB() *pgxpool.Pool {
 	return db
 }
 
-func GetCache() ([]string, error) {
+// GetCache returns every author credited as an author (rather than only as
+// an editor, translator or illustrator) on at least one book, by name.
+func GetCache() ([]models.Author, error) {
 	rows, err := db.Query(ctx, `
-        SELECT DISTINCT author
-        FROM products
-        ORDER BY author ASC
+        SELECT a.id, a.name, a.slug, a.bio, a.created_at
+        FROM authors a
+        WHERE EXISTS (
+            SELECT 1 FROM product_contributors pc
+            JOIN products p ON p.id = pc.product_id
+            WHERE pc.author_id = a.id AND pc.role = 'author' AND `+visibleProduct("p")+`
+        )
+        ORDER BY a.name ASC
     `)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var authors []string
+	var authors []models.Author
 	for rows.Next() {
-		var author string
-		if err := rows.Scan(&author); err != nil {
+		var author models.Author
+		if err := rows.Scan(&author.ID, &author.Name, &author.Slug, &author.Bio, &author.CreatedAt); err != nil {
 			log.Println("Error scanning author:", err)
 			continue
 		}
@@ -50,26 +57,3 @@ func GetCache() ([]string, error) {
 
 	return authors, nil
 }
-
-func UpdateProductAndVariants(id int, title, author, desc string, variants []models.Variant) error {
-	// Update the product information
-	queryProductID := `
-		UPDATE products 
-		SET title=$1, author=$2, description=$3
-		WHERE id=$4
-	`
-	_, err := db.Exec(ctx, queryProductID, title, author, desc, id)
-	if err != nil {
-		log.Printf("Failed to update product info: %v\n", err)
-		return err
-	}
-
-	// Delegate variant update to separate function
-	err = UpdateProductVariants(id, variants)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Updated product %d with %d variants\n", id, len(variants))
-	return nil
-}
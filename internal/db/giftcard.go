@@ -0,0 +1,292 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+var (
+	ErrGiftCardVoided       = errors.New("that gift card has been voided")
+	ErrGiftCardInsufficient = errors.New("that gift card does not have enough balance left")
+	ErrStoreCreditVoided    = errors.New("the customer's store credit account has been voided, so refund the return instead")
+)
+
+const giftCardColumns = `
+	g.id, g.code, g.kind, g.currency, g.email, g.order_id, g.note, g.voided_at, g.created_at,
+	COALESCE((SELECT SUM(e.cents) FROM gift_card_entries e WHERE e.gift_card_id = g.id), 0)`
+
+func scanGiftCard(row pgx.Row) (models.GiftCard, error) {
+	var g models.GiftCard
+	err := row.Scan(&g.ID, &g.Code, &g.Kind, &g.Currency, &g.Email, &g.Order_ID, &g.Note,
+		&g.VoidedAt, &g.CreatedAt, &g.BalanceCents)
+	return g, err
+}
+
+func GetGiftCardByCode(code string) (models.GiftCard, error) {
+	g, err := scanGiftCard(db.QueryRow(ctx, `
+		SELECT `+giftCardColumns+`
+		FROM gift_cards g
+		WHERE UPPER(g.code) = UPPER($1)
+	`, strings.TrimSpace(code)))
+	if err != nil {
+		return models.GiftCard{}, fmt.Errorf("error fetching gift card: %v", err)
+	}
+	return g, nil
+}
+
+// GetGiftCardByID returns the card along with its full ledger.
+func GetGiftCardByID(id int) (models.GiftCard, error) {
+	g, err := scanGiftCard(db.QueryRow(ctx, `
+		SELECT `+giftCardColumns+`
+		FROM gift_cards g
+		WHERE g.id = $1
+	`, id))
+	if err != nil {
+		return models.GiftCard{}, fmt.Errorf("error fetching gift card: %v", err)
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, gift_card_id, entry_type, cents, order_id, return_id, hold_reference, note, created_at
+		FROM gift_card_entries
+		WHERE gift_card_id = $1
+		ORDER BY created_at, id
+	`, id)
+	if err != nil {
+		return models.GiftCard{}, fmt.Errorf("error fetching gift card entries: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.GiftCardEntry
+		err := rows.Scan(&e.ID, &e.GiftCard_ID, &e.EntryType, &e.Cents, &e.Order_ID, &e.Return_ID,
+			&e.HoldReference, &e.Note, &e.CreatedAt)
+		if err != nil {
+			return models.GiftCard{}, fmt.Errorf("error scanning gift card entry: %v", err)
+		}
+		g.Entries = append(g.Entries, e)
+	}
+
+	return g, rows.Err()
+}
+
+func GetAllGiftCards() ([]models.GiftCard, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+giftCardColumns+`
+		FROM gift_cards g
+		ORDER BY g.created_at DESC, g.id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []models.GiftCard
+	for rows.Next() {
+		g, err := scanGiftCard(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift card: %v", err)
+		}
+		cards = append(cards, g)
+	}
+	return cards, rows.Err()
+}
+
+// InsertGiftCard creates a card and the ledger entry that loads it with cents.
+func InsertGiftCard(g models.GiftCard, cents int64) (giftCardID int, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to create gift card: %v", err)
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO gift_cards (code, kind, currency, email, order_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+	`, g.Code, g.Kind, g.Currency, g.Email, g.Order_ID, g.Note).Scan(&giftCardID)
+	if err != nil {
+		log.Printf("Failed to insert gift card: %v", err)
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO gift_card_entries (gift_card_id, entry_type, cents, order_id, note)
+		VALUES ($1, $2, $3, $4, $5)
+	`, giftCardID, models.GiftCardEntryIssue, cents, g.Order_ID, g.Note)
+	if err != nil {
+		log.Printf("Failed to insert gift card entry: %v", err)
+		return 0, err
+	}
+
+	return giftCardID, nil
+}
+
+// lockGiftCard locks the card row so balance checks and the entries written
+// after them can't interleave with another checkout.
+func lockGiftCard(tx pgx.Tx, id int) (voided bool, balance int64, err error) {
+	err = tx.QueryRow(ctx, `SELECT voided_at IS NOT NULL FROM gift_cards WHERE id = $1 FOR UPDATE`, id).Scan(&voided)
+	if err != nil {
+		return false, 0, err
+	}
+	err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(cents), 0) FROM gift_card_entries WHERE gift_card_id = $1`, id).Scan(&balance)
+	return voided, balance, err
+}
+
+// VoidGiftCard writes off whatever is left on the card and stops it being used.
+func VoidGiftCard(id int, note string) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to void gift card: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	voided, balance, err := lockGiftCard(tx, id)
+	if err != nil {
+		return err
+	}
+	if voided {
+		err = ErrGiftCardVoided
+		return err
+	}
+
+	if balance != 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO gift_card_entries (gift_card_id, entry_type, cents, note)
+			VALUES ($1, $2, $3, $4)
+		`, id, models.GiftCardEntryVoid, -balance, note)
+		if err != nil {
+			log.Printf("Failed to insert gift card entry: %v", err)
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE gift_cards SET voided_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	return err
+}
+
+// HoldGiftCard takes cents off the card for a checkout that hasn't completed
+// yet. The hold is claimed by the order when payment succeeds, or released if
+// the checkout expires.
+func HoldGiftCard(id int, cents int64, reference string) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to hold gift card: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	voided, balance, err := lockGiftCard(tx, id)
+	if err != nil {
+		return err
+	}
+	if voided {
+		err = ErrGiftCardVoided
+		return err
+	}
+	if cents <= 0 || cents > balance {
+		err = ErrGiftCardInsufficient
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO gift_card_entries (gift_card_id, entry_type, cents, hold_reference)
+		VALUES ($1, $2, $3, $4)
+	`, id, models.GiftCardEntryRedeem, -cents, reference)
+	if err != nil {
+		log.Printf("Failed to insert gift card entry: %v", err)
+	}
+	return err
+}
+
+// ReleaseGiftCardHold gives back a hold whose checkout was abandoned. It is
+// safe to call more than once for the same hold, even at the same time: the
+// release entry is unique per hold.
+func ReleaseGiftCardHold(reference string) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO gift_card_entries (gift_card_id, entry_type, cents, hold_reference)
+		SELECT e.gift_card_id, $2, -e.cents, e.hold_reference
+		FROM gift_card_entries e
+		WHERE e.hold_reference = $1 AND e.entry_type = $3 AND e.order_id IS NULL
+		ON CONFLICT (hold_reference) WHERE entry_type = 'release' DO NOTHING
+	`, reference, models.GiftCardEntryRelease, models.GiftCardEntryRedeem)
+	if err != nil {
+		log.Printf("Failed to release gift card hold %s: %v", reference, err)
+	}
+	return err
+}
+
+// claimGiftCardHold attaches a checkout's redemption to the order it paid for.
+// A hold can only be claimed once.
+func claimGiftCardHold(tx pgx.Tx, reference string, orderID int) error {
+	tag, err := tx.Exec(ctx, `
+		UPDATE gift_card_entries SET order_id = $1
+		WHERE hold_reference = $2 AND entry_type = $3 AND order_id IS NULL
+	`, orderID, reference, models.GiftCardEntryRedeem)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("gift card hold %s was already claimed", reference)
+	}
+	return nil
+}
+
+// creditStoreCredit adds cents to the customer's store credit account,
+// opening one under code if they don't have one in this currency yet. An
+// account an admin voided stays voided and returns ErrStoreCreditVoided.
+func creditStoreCredit(tx pgx.Tx, email, currency, code string, cents int64, returnID int) (giftCardID int, err error) {
+	_, err = tx.Exec(ctx, `
+		INSERT INTO gift_cards (code, kind, currency, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (LOWER(email), currency) WHERE kind = 'store_credit' DO NOTHING
+	`, code, models.GiftCardKindStoreCredit, currency, email)
+	if err != nil {
+		return 0, err
+	}
+
+	var voided bool
+	err = tx.QueryRow(ctx, `
+		SELECT id, voided_at IS NOT NULL FROM gift_cards
+		WHERE LOWER(email) = LOWER($1) AND currency = $2 AND kind = $3
+		FOR UPDATE
+	`, email, currency, models.GiftCardKindStoreCredit).Scan(&giftCardID, &voided)
+	if err != nil {
+		return 0, err
+	}
+	if voided {
+		return 0, ErrStoreCreditVoided
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO gift_card_entries (gift_card_id, entry_type, cents, return_id)
+		VALUES ($1, $2, $3, $4)
+	`, giftCardID, models.GiftCardEntryCredit, cents, returnID)
+	return giftCardID, err
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const productImageColumns = `id, product_id, variant_id, image_path, alt_text, position, is_primary, created_at`
+
+func scanProductImage(row pgx.Row) (models.ProductImage, error) {
+	var img models.ProductImage
+	err := row.Scan(&img.ID, &img.Product_ID, &img.Variant_ID, &img.ImagePath, &img.AltText,
+		&img.Position, &img.IsPrimary, &img.CreatedAt)
+	return img, err
+}
+
+// GetImagesByProductID returns the product's gallery in display order.
+func GetImagesByProductID(product_id int) ([]models.ProductImage, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+productImageColumns+`
+		FROM product_images
+		WHERE product_id = $1
+		ORDER BY position, id
+	`, product_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching product images: %v", err)
+	}
+	defer rows.Close()
+
+	var images []models.ProductImage
+	for rows.Next() {
+		img, err := scanProductImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning product image: %v", err)
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+func GetProductImageByID(id int) (models.ProductImage, error) {
+	img, err := scanProductImage(db.QueryRow(ctx, `
+		SELECT `+productImageColumns+` FROM product_images WHERE id = $1
+	`, id))
+	if err != nil {
+		return models.ProductImage{}, fmt.Errorf("error fetching product image: %v", err)
+	}
+	return img, nil
+}
+
+// attachPrimaryImages sets each product's PrimaryImage, for listings.
+func attachPrimaryImages(products []models.Product) error {
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT `+productImageColumns+`
+		FROM product_images
+		WHERE product_id = ANY($1) AND is_primary
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("error fetching primary images: %v", err)
+	}
+	defer rows.Close()
+
+	primary := make(map[int]models.ProductImage)
+	for rows.Next() {
+		img, err := scanProductImage(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning product image: %v", err)
+		}
+		primary[img.Product_ID] = img
+	}
+	for i := range products {
+		products[i].PrimaryImage = primary[products[i].ID]
+	}
+	return rows.Err()
+}
+
+// InsertProductImage adds an image to the end of the product's gallery. The
+// first image a product gets becomes its primary one.
+func InsertProductImage(img models.ProductImage) (int, error) {
+	var id int
+	err := db.QueryRow(ctx, `
+		INSERT INTO product_images (product_id, variant_id, image_path, alt_text, position, is_primary)
+		SELECT $1, $2, $3, $4,
+		       COALESCE(MAX(position) + 1, 0),
+		       NOT EXISTS (SELECT 1 FROM product_images WHERE product_id = $1 AND is_primary)
+		FROM product_images WHERE product_id = $1
+		RETURNING id
+	`, img.Product_ID, img.Variant_ID, img.ImagePath, img.AltText).Scan(&id)
+	if err != nil {
+		log.Printf("Failed to insert product image: %v", err)
+	}
+	return id, err
+}
+
+// UpdateProductImage saves an image's alt text and variant.
+func UpdateProductImage(img models.ProductImage) error {
+	_, err := db.Exec(ctx, `
+		UPDATE product_images SET alt_text = $1, variant_id = $2
+		WHERE id = $3
+	`, img.AltText, img.Variant_ID, img.ID)
+	if err != nil {
+		log.Printf("Failed to update product image (id: %d): %v", img.ID, err)
+	}
+	return err
+}
+
+// ReorderProductImages sets the gallery order to that of ids. Images of the
+// product left out of ids keep their place after the listed ones.
+func ReorderProductImages(product_id int, ids []int) error {
+	_, err := db.Exec(ctx, `
+		UPDATE product_images pi
+		SET position = COALESCE(
+			(SELECT o.ord - 1 FROM unnest($2::int[]) WITH ORDINALITY AS o(id, ord) WHERE o.id = pi.id),
+			cardinality($2::int[]) + pi.position)
+		WHERE pi.product_id = $1
+	`, product_id, ids)
+	if err != nil {
+		log.Printf("Failed to reorder images of product %d: %v", product_id, err)
+	}
+	return err
+}
+
+// SetPrimaryImage makes the image the product's primary one.
+func SetPrimaryImage(product_id, image_id int) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `UPDATE product_images SET is_primary = FALSE WHERE product_id = $1 AND is_primary`, product_id)
+	if err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `UPDATE product_images SET is_primary = TRUE WHERE id = $1 AND product_id = $2`, image_id, product_id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		err = fmt.Errorf("image %d is not part of product %d", image_id, product_id)
+	}
+	return err
+}
+
+// DeleteProductImage removes an image from its gallery, passing the primary
+// flag on to the next image, and returns the removed image's path.
+func DeleteProductImage(id int) (imagePath string, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var product_id int
+	var wasPrimary bool
+	err = tx.QueryRow(ctx, `
+		DELETE FROM product_images WHERE id = $1
+		RETURNING product_id, image_path, is_primary
+	`, id).Scan(&product_id, &imagePath, &wasPrimary)
+	if err != nil {
+		return "", err
+	}
+
+	if wasPrimary {
+		_, err = tx.Exec(ctx, `
+			UPDATE product_images SET is_primary = TRUE
+			WHERE id = (SELECT id FROM product_images WHERE product_id = $1 ORDER BY position, id LIMIT 1)
+		`, product_id)
+		if err != nil {
+			return "", err
+		}
+	}
+	return imagePath, nil
+}
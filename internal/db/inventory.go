@@ -0,0 +1,499 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// Stock is kept as a ledger of movements. Every change to a variant's stock
+// goes through recordMovement, which also keeps variants.stock, the sellable
+// figure the storefront reads, in step with the ledger.
+
+// recordMovement adds an entry to the stock ledger and brings the variant's
+// stock up to date.
+func recordMovement(tx pgx.Tx, m models.StockMovement) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO stock_movements (variant_id, location_id, kind, quantity, order_id, return_id, transfer_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, m.Variant_ID, m.Location_ID, m.Kind, m.Quantity, m.Order_ID, m.Return_ID, m.Transfer_ID, m.Note)
+	if err != nil {
+		log.Printf("Failed to record stock movement (variant: %d): %v", m.Variant_ID, err)
+		return err
+	}
+
+	// Oversold stock shows in the ledger, but the storefront sees none left
+	_, err = tx.Exec(ctx, `
+		UPDATE variants
+		SET stock = GREATEST((`+sellableStock+`), 0)
+		WHERE id = $1
+	`, m.Variant_ID)
+	return err
+}
+
+// sellableStock sums the ledger of variant $1 at sellable locations.
+const sellableStock = `
+	SELECT COALESCE(SUM(m.quantity), 0)
+	FROM stock_movements m
+	JOIN locations l ON l.id = m.location_id
+	WHERE m.variant_id = $1 AND l.sellable`
+
+// lockVariantStock holds the variant's row until the transaction ends, so
+// two transactions can't both take the same stock.
+func lockVariantStock(tx pgx.Tx, variant_id int) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM variants WHERE id = $1 FOR UPDATE`, variant_id)
+	return err
+}
+
+// defaultLocation is where stock goes when no location is given: the first
+// sellable location, or the first location when none is sellable.
+func defaultLocation(tx pgx.Tx) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, `SELECT id FROM locations ORDER BY sellable DESC, id LIMIT 1`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error finding the default stock location: %v", err)
+	}
+	return id, nil
+}
+
+// setStock records the movement that brings a variant's sellable stock to
+// quantity, at the default location. It is for the product form and imports,
+// which only know a single figure.
+func setStock(tx pgx.Tx, variant_id, quantity int, kind, note string) error {
+	if err := lockVariantStock(tx, variant_id); err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRow(ctx, sellableStock, variant_id).Scan(&current); err != nil {
+		return err
+	}
+	if quantity == max(current, 0) {
+		return nil
+	}
+
+	location, err := defaultLocation(tx)
+	if err != nil {
+		return err
+	}
+	return recordMovement(tx, models.StockMovement{
+		Variant_ID:  variant_id,
+		Location_ID: location,
+		Kind:        kind,
+		Quantity:    quantity - current,
+		Note:        note,
+	})
+}
+
+// adjustStock records a change of quantity to a variant's stock at the
+// default location.
+func adjustStock(tx pgx.Tx, variant_id, quantity int, kind, note string) error {
+	if err := lockVariantStock(tx, variant_id); err != nil {
+		return err
+	}
+	location, err := defaultLocation(tx)
+	if err != nil {
+		return err
+	}
+	return recordMovement(tx, models.StockMovement{
+		Variant_ID:  variant_id,
+		Location_ID: location,
+		Kind:        kind,
+		Quantity:    quantity,
+		Note:        note,
+	})
+}
+
+// recordSales takes the order's stocked items off the shelf, from the
+// sellable locations in order. What can't be covered is taken from the
+// default location, leaving it short, since the order is already paid for.
+func recordSales(tx pgx.Tx, order_id int) error {
+	sales, err := stockItems(tx, `
+		SELECT oi.variant_id, v.format, oi.quantity
+		FROM order_items oi
+		JOIN variants v ON v.id = oi.variant_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.variant_id
+	`, order_id)
+	if err != nil {
+		return err
+	}
+
+	location, err := defaultLocation(tx)
+	if err != nil {
+		return err
+	}
+	for _, s := range sales {
+		if !models.Stocked(s.format) {
+			continue
+		}
+		if err := lockVariantStock(tx, s.variantID); err != nil {
+			return err
+		}
+		levels, err := stockLevels(tx, s.variantID)
+		if err != nil {
+			return err
+		}
+
+		taken := make(map[int]int)
+		remaining := s.quantity
+		for _, level := range levels {
+			if !level.Location.Sellable || level.Quantity <= 0 || remaining == 0 {
+				continue
+			}
+			n := min(level.Quantity, remaining)
+			taken[level.Location.ID] += n
+			remaining -= n
+		}
+		taken[location] += remaining
+
+		for locationID, n := range taken {
+			if n == 0 {
+				continue
+			}
+			err := recordMovement(tx, models.StockMovement{
+				Variant_ID:  s.variantID,
+				Location_ID: locationID,
+				Kind:        models.MovementSale,
+				Quantity:    -n,
+				Order_ID:    &order_id,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restockReturn puts a received return's resellable, stocked items back at
+// the default location.
+func restockReturn(tx pgx.Tx, return_id int) error {
+	items, err := stockItems(tx, `
+		SELECT oi.variant_id, v.format, ri.quantity
+		FROM return_items ri
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		JOIN variants v ON v.id = oi.variant_id
+		WHERE ri.return_id = $1 AND ri.resellable
+	`, return_id)
+	if err != nil {
+		return err
+	}
+
+	location, err := defaultLocation(tx)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if !models.Stocked(item.format) {
+			continue
+		}
+		err := recordMovement(tx, models.StockMovement{
+			Variant_ID:  item.variantID,
+			Location_ID: location,
+			Kind:        models.MovementReturn,
+			Quantity:    item.quantity,
+			Return_ID:   &return_id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stockItem is a quantity of a variant on an order or a return.
+type stockItem struct {
+	variantID int
+	format    string
+	quantity  int
+}
+
+// stockItems reads the variant ID, format and quantity of each row.
+func stockItems(tx pgx.Tx, sql string, args ...any) ([]stockItem, error) {
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (stockItem, error) {
+		var item stockItem
+		err := row.Scan(&item.variantID, &item.format, &item.quantity)
+		return item, err
+	})
+}
+
+// querier is a transaction or the pool.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// stockLevels returns the variant's quantity at every location, in location
+// order.
+func stockLevels(q querier, variant_id int) ([]models.StockLevel, error) {
+	rows, err := q.Query(ctx, `
+		SELECT l.id, l.name, l.kind, l.sellable, l.created_at, COALESCE(SUM(m.quantity), 0)
+		FROM locations l
+		LEFT JOIN stock_movements m ON m.location_id = l.id AND m.variant_id = $1
+		GROUP BY l.id
+		ORDER BY l.id
+	`, variant_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stock levels: %v", err)
+	}
+	defer rows.Close()
+
+	var levels []models.StockLevel
+	for rows.Next() {
+		var s models.StockLevel
+		l := &s.Location
+		if err := rows.Scan(&l.ID, &l.Name, &l.Kind, &l.Sellable, &l.CreatedAt, &s.Quantity); err != nil {
+			return nil, fmt.Errorf("error scanning stock level: %v", err)
+		}
+		levels = append(levels, s)
+	}
+	return levels, rows.Err()
+}
+
+// GetStockLevels returns the variant's quantity at every location.
+func GetStockLevels(variant_id int) ([]models.StockLevel, error) {
+	return stockLevels(db, variant_id)
+}
+
+// GetStockMovements returns a page of the variant's ledger, newest first.
+func GetStockMovements(variant_id int, page *models.Pagination) ([]models.StockMovement, error) {
+	err := db.QueryRow(ctx, `SELECT COUNT(*) FROM stock_movements WHERE variant_id = $1`, variant_id).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("error counting stock movements: %v", err)
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT m.id, m.variant_id, m.location_id, m.kind, m.quantity, m.order_id, m.return_id,
+		       m.transfer_id, m.note, m.created_at, l.name
+		FROM stock_movements m
+		JOIN locations l ON l.id = m.location_id
+		WHERE m.variant_id = $1
+		ORDER BY m.id DESC
+		LIMIT $2 OFFSET $3
+	`, variant_id, page.PageSize, page.Offset())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stock movements: %v", err)
+	}
+	defer rows.Close()
+
+	var movements []models.StockMovement
+	for rows.Next() {
+		var m models.StockMovement
+		err := rows.Scan(&m.ID, &m.Variant_ID, &m.Location_ID, &m.Kind, &m.Quantity, &m.Order_ID, &m.Return_ID,
+			&m.Transfer_ID, &m.Note, &m.CreatedAt, &m.LocationName)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning stock movement: %v", err)
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// ReceiveStock records stock arriving at a location.
+func ReceiveStock(variant_id, location_id, quantity int, note string) error {
+	if quantity <= 0 {
+		return fmt.Errorf("received quantity must be positive")
+	}
+	return inStockTx(variant_id, func(tx pgx.Tx) error {
+		return recordMovement(tx, models.StockMovement{
+			Variant_ID:  variant_id,
+			Location_ID: location_id,
+			Kind:        models.MovementReceipt,
+			Quantity:    quantity,
+			Note:        note,
+		})
+	})
+}
+
+// CountStock records the adjustment that brings a variant's quantity at a
+// location to what was counted there.
+func CountStock(variant_id, location_id, counted int, note string) error {
+	return inStockTx(variant_id, func(tx pgx.Tx) error {
+		var current int
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(SUM(quantity), 0) FROM stock_movements
+			WHERE variant_id = $1 AND location_id = $2
+		`, variant_id, location_id).Scan(&current)
+		if err != nil || counted == current {
+			return err
+		}
+		return recordMovement(tx, models.StockMovement{
+			Variant_ID:  variant_id,
+			Location_ID: location_id,
+			Kind:        models.MovementAdjustment,
+			Quantity:    counted - current,
+			Note:        note,
+		})
+	})
+}
+
+// TransferStock moves stock between two locations. It is refused when the
+// first location doesn't hold that much.
+func TransferStock(variant_id, from, to, quantity int, note string) error {
+	if quantity <= 0 || from == to {
+		return fmt.Errorf("choose two different locations and a positive quantity")
+	}
+	return inStockTx(variant_id, func(tx pgx.Tx) error {
+		var available int
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(SUM(quantity), 0) FROM stock_movements
+			WHERE variant_id = $1 AND location_id = $2
+		`, variant_id, from).Scan(&available)
+		if err != nil {
+			return err
+		}
+		if available < quantity {
+			return fmt.Errorf("only %d are at that location", max(available, 0))
+		}
+
+		var transferID int
+		err = tx.QueryRow(ctx, `
+			INSERT INTO stock_transfers (variant_id, from_location_id, to_location_id, quantity, note)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, variant_id, from, to, quantity, note).Scan(&transferID)
+		if err != nil {
+			return err
+		}
+
+		for _, leg := range []struct{ location, quantity int }{{from, -quantity}, {to, quantity}} {
+			err = recordMovement(tx, models.StockMovement{
+				Variant_ID:  variant_id,
+				Location_ID: leg.location,
+				Kind:        models.MovementTransfer,
+				Quantity:    leg.quantity,
+				Transfer_ID: &transferID,
+				Note:        note,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inStockTx runs fn in a transaction holding the variant's stock lock.
+func inStockTx(variant_id int, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if err = lockVariantStock(tx, variant_id); err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// GetStockDiscrepancies returns the variants whose stored stock doesn't
+// match the sum of their ledger at sellable locations.
+func GetStockDiscrepancies() ([]models.StockDiscrepancy, error) {
+	rows, err := db.Query(ctx, `
+		SELECT v.id, p.title, v.format, v.stock, COALESCE(s.quantity, 0)
+		FROM variants v
+		JOIN products p ON p.id = v.product_id
+		LEFT JOIN (
+			SELECT m.variant_id, SUM(m.quantity) AS quantity
+			FROM stock_movements m
+			JOIN locations l ON l.id = m.location_id
+			WHERE l.sellable
+			GROUP BY m.variant_id
+		) s ON s.variant_id = v.id
+		WHERE v.stock <> GREATEST(COALESCE(s.quantity, 0), 0)
+		ORDER BY p.title, v.format
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error auditing stock: %v", err)
+	}
+	defer rows.Close()
+
+	var out []models.StockDiscrepancy
+	for rows.Next() {
+		var d models.StockDiscrepancy
+		if err := rows.Scan(&d.Variant_ID, &d.Title, &d.Format, &d.Stock, &d.Ledger); err != nil {
+			return nil, fmt.Errorf("error scanning stock audit: %v", err)
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func GetLocations() ([]models.Location, error) {
+	rows, err := db.Query(ctx, `SELECT id, name, kind, sellable, created_at FROM locations ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching locations: %v", err)
+	}
+	defer rows.Close()
+
+	var locations []models.Location
+	for rows.Next() {
+		var l models.Location
+		if err := rows.Scan(&l.ID, &l.Name, &l.Kind, &l.Sellable, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning location: %v", err)
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+func InsertLocation(l models.Location) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO locations (name, kind, sellable) VALUES ($1, $2, $3)
+	`, l.Name, l.Kind, l.Sellable)
+	if err != nil {
+		log.Printf("Failed to insert location %q: %v", l.Name, err)
+	}
+	return err
+}
+
+// UpdateLocation renames a location or changes its kind or whether its stock
+// is sellable, recounting the stock of every variant held there.
+func UpdateLocation(l models.Location) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE locations SET name = $1, kind = $2, sellable = $3 WHERE id = $4
+	`, l.Name, l.Kind, l.Sellable, l.ID)
+	if err != nil {
+		log.Printf("Failed to update location (id: %d): %v", l.ID, err)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE variants v
+		SET stock = GREATEST((
+			SELECT COALESCE(SUM(m.quantity), 0)
+			FROM stock_movements m
+			JOIN locations l ON l.id = m.location_id
+			WHERE m.variant_id = v.id AND l.sellable
+		), 0)
+		WHERE v.id IN (SELECT variant_id FROM stock_movements WHERE location_id = $1)
+	`, l.ID)
+	return err
+}
@@ -1,68 +1,217 @@
 package db
 
 import (
+	"errors"
+	"fmt"
 	"log"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
-func SearchOrders(email string, orderNumber string) (models.Order, error) {
-	// TODO:
-	// Check order number for ORD- prepend
+// ErrOrderExists is returned when the checkout session already made an order.
+var ErrOrderExists = errors.New("an order already exists for this checkout session")
 
-	var order models.Order
-
-	row := db.QueryRow(ctx, `
-        SELECT id, order_number, email, address, city, postal_code, country, created_at
-        FROM orders
-    	WHERE email = $1 AND order_id = $2
-        LIMIT 1
-    `, email, orderNumber)
+const orderColumns = `
+	id, order_number, status, payment_intent_id, COALESCE(checkout_session_id, ''), email, address, city, postal_code, country, phone,
+	COALESCE(shipping_address_id, 0), COALESCE(billing_address_id, 0),
+	COALESCE(promotion_code, ''), discount_cents, shipping_cents, tax_cents, total_cents, gift_card_cents, created_at`
 
+func scanOrder(row pgx.Row) (models.Order, error) {
+	var order models.Order
 	err := row.Scan(
 		&order.ID,
 		&order.OrderNumber,
+		&order.Status,
+		&order.PaymentIntent_ID,
+		&order.CheckoutSession_ID,
 		&order.Email,
 		&order.Address,
 		&order.City,
 		&order.PostalCode,
 		&order.Country,
+		&order.Phone,
+		&order.ShippingAddress_ID,
+		&order.BillingAddress_ID,
+		&order.PromotionCode,
+		&order.DiscountCents,
+		&order.ShippingCents,
+		&order.TaxCents,
+		&order.TotalCents,
+		&order.GiftCardCents,
 		&order.CreatedAt,
 	)
-	if err != nil {
-		return models.Order{}, err
+	order.Discount = float64(order.DiscountCents) / 100.0
+	return order, err
+}
+
+// loadOrderDetails fills in the order's addresses, items, shipments and returns.
+func loadOrderDetails(order *models.Order) error {
+	var err error
+	if order.ShippingAddress_ID != 0 {
+		order.ShippingAddress, err = GetAddressByID(order.ShippingAddress_ID)
+		if err != nil {
+			return err
+		}
 	}
+	if order.BillingAddress_ID != 0 {
+		order.BillingAddress, err = GetAddressByID(order.BillingAddress_ID)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Get the order items
 	rows, err := db.Query(ctx, `
-        SELECT variant_id, quantity, price, product_title, variant_color 
+        SELECT id, variant_id, quantity, cents, currency, product_title, variant_format
         FROM order_items
     	WHERE order_id = $1
+    	ORDER BY id
     `, order.ID)
 	if err != nil {
-		return models.Order{}, err
+		return err
 	}
 	defer rows.Close()
 
+	order.Products = nil
 	for rows.Next() {
 		var item models.OrderItem
 		err := rows.Scan(
+			&item.ID,
 			&item.Variant_ID,
 			&item.Quantity,
 			&item.Cents,
+			&item.Currency,
 			&item.ProductTitle,
-			&item.VariantColor,
+			&item.VariantFormat,
 		)
 		if err != nil {
-			return models.Order{}, err
+			return err
 		}
+		item.Order_ID = order.ID
 		item.Price = float64(item.Cents) / 100.0
 		order.Products = append(order.Products, item)
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	order.Shipments, err = GetShipmentsByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+	shipped := make(map[int]int)
+	for _, s := range order.Shipments {
+		for _, item := range s.Items {
+			shipped[item.OrderItem_ID] += item.Quantity
+		}
+	}
+	order.Returns, err = GetReturnsByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+	returned := make(map[int]int)
+	for _, ret := range order.Returns {
+		if ret.Status == models.ReturnStatusRejected {
+			continue
+		}
+		for _, item := range ret.Items {
+			returned[item.OrderItem_ID] += item.Quantity
+		}
+	}
+
+	for i := range order.Products {
+		order.Products[i].ShippedQuantity = shipped[order.Products[i].ID]
+		order.Products[i].ReturnedQuantity = returned[order.Products[i].ID]
+	}
+
+	return nil
+}
+
+func SearchOrders(email string, orderNumber string) (models.Order, error) {
+	// TODO:
+	// Check order number for ORD- prepend
+
+	order, err := scanOrder(db.QueryRow(ctx, `
+        SELECT `+orderColumns+`
+        FROM orders
+    	WHERE email = $1 AND order_number = $2
+        LIMIT 1
+    `, email, orderNumber))
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if err := loadOrderDetails(&order); err != nil {
+		return models.Order{}, err
+	}
 
 	return order, nil
 }
 
-func InsertOrder(orderNumber, email, address, city, postalCode, country string, items []models.OrderItem) (orderID int, err error) {
+func GetOrderByID(id int) (models.Order, error) {
+	order, err := scanOrder(db.QueryRow(ctx, `
+        SELECT `+orderColumns+`
+        FROM orders
+    	WHERE id = $1
+    `, id))
+	if err != nil {
+		return models.Order{}, fmt.Errorf("error fetching order: %v", err)
+	}
+
+	if err := loadOrderDetails(&order); err != nil {
+		return models.Order{}, err
+	}
+
+	return order, nil
+}
+
+// GetOrdersByStatus returns orders with the given status, or every order when
+// status is empty, oldest first so they can be worked through in order.
+func GetOrdersByStatus(status string) ([]models.Order, error) {
+	rows, err := db.Query(ctx, `
+        SELECT `+orderColumns+`
+        FROM orders
+    	WHERE $1 = '' OR status = $1
+    	ORDER BY created_at, id
+    `, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning order: %v", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		if err := loadOrderDetails(&orders[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return orders, nil
+}
+
+func UpdateOrderStatus(id int, status string) error {
+	_, err := db.Exec(ctx, `UPDATE orders SET status = $1 WHERE id = $2`, status, id)
+	if err != nil {
+		log.Printf("Failed to update order status (id: %d): %v\n", id, err)
+	}
+	return err
+}
+
+// InsertOrder stores the order, its addresses and its items (order.Products)
+// in a single transaction.
+func InsertOrder(order models.Order) (orderID int, err error) {
 	tx, err := db.Begin(ctx)
 	if err != nil {
 		log.Printf("1Failed to create order: %v", err)
@@ -77,19 +226,67 @@ func InsertOrder(orderNumber, email, address, city, postalCode, country string,
 		}
 	}()
 
+	shippingID, err := insertAddress(tx, order.ShippingAddress)
+	if err != nil {
+		log.Printf("Failed to save shipping address: %v", err)
+		return 0, err
+	}
+	billingID, err := insertAddress(tx, order.BillingAddress)
+	if err != nil {
+		log.Printf("Failed to save billing address: %v", err)
+		return 0, err
+	}
+
+	shipping := order.ShippingAddress
+	address := shipping.Line1
+	if shipping.Line2 != "" {
+		address += ", " + shipping.Line2
+	}
+
 	err = tx.QueryRow(ctx,
-		`INSERT INTO orders (order_id, email, address, city, postal_code, country) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
-		orderNumber, email, address, city, postalCode, country,
+		`INSERT INTO orders (order_number, payment_intent_id, email, address, city, postal_code, country, phone, shipping_address_id, billing_address_id, promotion_code, discount_cents, shipping_cents, tax_cents, total_cents, gift_card_cents, visitor_id, checkout_session_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0), NULLIF($10, 0), NULLIF($11, ''), $12, $13, $14, $15, $16, $17, NULLIF($18, ''))
+		 ON CONFLICT (checkout_session_id) DO NOTHING
+		 RETURNING id`,
+		order.OrderNumber, order.PaymentIntent_ID, order.Email, address, shipping.City, shipping.PostalCode, shipping.Country, order.Phone,
+		shippingID, billingID, order.PromotionCode, order.DiscountCents, order.ShippingCents, order.TaxCents, order.TotalCents, order.GiftCardCents,
+		order.Visitor_ID, order.CheckoutSession_ID,
 	).Scan(&orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Stripe redelivered the event; the addresses roll back with the rest
+		return 0, ErrOrderExists
+	}
 	if err != nil {
 		log.Printf("2Failed to create order: %v", err)
 		return 0, err
 	}
 
-	for _, item := range items {
+	if order.PromotionHold != "" {
+		err = claimPromotionHold(tx, order.PromotionHold, orderID)
+		if err != nil {
+			log.Printf("Failed to claim promotion hold %s: %v", order.PromotionHold, err)
+			return 0, err
+		}
+	} else if order.PromotionCode != "" {
+		err = redeemPromotion(tx, order.PromotionCode)
+		if err != nil {
+			log.Printf("Failed to redeem promotion %s: %v", order.PromotionCode, err)
+			return 0, err
+		}
+	}
+
+	if order.GiftCardHold != "" {
+		err = claimGiftCardHold(tx, order.GiftCardHold, orderID)
+		if err != nil {
+			log.Printf("Failed to claim gift card hold %s: %v", order.GiftCardHold, err)
+			return 0, err
+		}
+	}
+
+	for _, item := range order.Products {
 		_, err = tx.Exec(ctx,
-			`INSERT INTO order_items (order_id, variant_id, quantity, price, product_title, variant_color) VALUES ($1, $2, $3, $4, $5, $6)`,
-			orderID, item.Variant_ID, item.Quantity, item.Cents, item.ProductTitle, item.VariantColor,
+			`INSERT INTO order_items (order_id, variant_id, quantity, cents, currency, product_title, variant_format) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			orderID, item.Variant_ID, item.Quantity, item.Cents, item.Currency, item.ProductTitle, item.VariantFormat,
 		)
 		if err != nil {
 			log.Printf("3Failed to create order: %v", err)
@@ -97,6 +294,12 @@ func InsertOrder(orderNumber, email, address, city, postalCode, country string,
 		}
 	}
 
+	err = recordSales(tx, orderID)
+	if err != nil {
+		log.Printf("Failed to take order %d out of stock: %v", orderID, err)
+		return 0, err
+	}
+
 	return orderID, nil
 }
 
@@ -2,121 +2,30 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
-// InsertProduct inserts a new product row into the products table.
-func InsertProduct(title, author, description string, variants []models.Variant) error {
-	// First, insert into the products table
-	sql := `
-		INSERT INTO products (title, author, description)
-		VALUES ($1, $2, $3) RETURNING id
-	`
-	var productID int
-	err := db.QueryRow(ctx, sql, title, author, description).Scan(&productID)
-	if err != nil {
-		log.Printf("Failed to insert product: %v\n", err)
-		return err
-	}
-
-	// Then insert the variants into the variants table
-	for _, v := range variants {
-		sqlVariant := `
-			INSERT INTO variants (product_id, color, stock, cents, image_path)
-			VALUES ($1, $2, $3, $4, $5)
-		`
-		_, err := db.Exec(ctx, sqlVariant, productID, v.Color, v.Stock, v.Cents, v.ImagePath)
-		if err != nil {
-			log.Printf("Failed to insert variant: %v\n", err)
-			return err
-		}
-	}
-	log.Printf("Inserted product: %s by %s with %d variants\n", title, author, len(variants))
-	return nil
-}
-
-func SearchProducts(query string) ([]models.Product, error) {
-	rows, err := db.Query(ctx, `
-		SELECT b.id, b.title, b.author, b.description,
-		       v.color, v.stock, v.cents, v.image_path
-		FROM products b
-		LEFT JOIN variants v ON b.id = v.product_id
-		WHERE b.title % $1 OR b.author % $1
-		ORDER BY GREATEST(similarity(b.title, $1), similarity(b.author, $1)) DESC,
-		         b.id, v.color
-		LIMIT 20
-	`, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var products []models.Product
-	var currentProduct *models.Product
-
-	for rows.Next() {
-		var b models.Product
-		var v models.Variant
-
-		var color *string
-		var stock *int
-		var price *int64
-		var imagePath *string
-
-		err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Description,
-			&color, &stock, &price, &imagePath)
-		if err != nil {
-			log.Println("Error scanning row:", err)
-			return nil, err
-		}
-
-		if currentProduct == nil || currentProduct.ID != b.ID {
-			if currentProduct != nil {
-				products = append(products, *currentProduct)
-			}
-			currentProduct = &b
-			currentProduct.Variants = []models.Variant{}
-		}
-
-		if color != nil {
-			v.Color = *color
-		}
-		if stock != nil {
-			v.Stock = *stock
-		}
-		if price != nil {
-			v.Cents = *price
-			v.Price = float64(*price) / 100.0
-		}
-		if imagePath != nil {
-			v.ImagePath = *imagePath
-		}
-
-		if v.Color != "" {
-			currentProduct.Variants = append(currentProduct.Variants, v)
-		}
-	}
-
-	if currentProduct != nil {
-		products = append(products, *currentProduct)
-	}
-
-	return products, rows.Err()
-}
-
 func GetProductByID(id int) (*models.Product, error) {
 	// Initialize product
 	var b models.Product
 
 	// Query for product details
 	err := db.QueryRow(context.Background(), `
-		SELECT id, title, author, description
+		SELECT id, title, author, description, product_type,
+		       publisher, publication_date, language, page_count, series, series_volume, version,
+		       status, publish_at, archived_at
 		FROM products
 		WHERE id = $1
-	`, id).Scan(&b.ID, &b.Title, &b.Author, &b.Description)
+	`, id).Scan(&b.ID, &b.Title, &b.Author, &b.Description, &b.ProductType,
+		&b.Publisher, &b.PublicationDate, &b.Language, &b.PageCount, &b.Series, &b.SeriesVolume, &b.Version,
+		&b.Status, &b.PublishAt, &b.ArchivedAt)
 	if err != nil {
 		// Handle error if product is not found
 		return nil, fmt.Errorf("error fetching product: %v", err)
@@ -131,77 +40,349 @@ func GetProductByID(id int) (*models.Product, error) {
 	// Assign the variants to the product
 	b.Variants = variants
 
+	b.Contributors, err = GetContributorsByProductID(id)
+	if err != nil {
+		return nil, err
+	}
+	b.Categories, err = GetCategoriesByProductID(id)
+	if err != nil {
+		return nil, err
+	}
+	b.Tags, err = GetTagsByProductID(id)
+	if err != nil {
+		return nil, err
+	}
+	b.Images, err = GetImagesByProductID(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range b.Images {
+		if img.IsPrimary {
+			b.PrimaryImage = img
+		}
+	}
+
 	// Return the product with variants
 	return &b, nil
 }
 
-func UpdateProductByID(id int, title, author, desc string) error {
-	// Update the product information
-	queryProduct := `
-		UPDATE products 
-		SET title=$1, author=$2, description=$3
-		WHERE id=$4
-	`
-	_, err := db.Exec(ctx, queryProduct, title, author, desc, id)
+// ErrVersionConflict is returned by SaveProduct when someone else saved the
+// product after the version being saved was loaded.
+var ErrVersionConflict = errors.New("product was changed by someone else")
+
+// SaveProduct writes a product from the admin form in one transaction: its
+// details, contributors, categories, tags and variants with their price
+// lists, and a revision of it noted with note. A new product is inserted; an
+// existing one is only updated while its version is still p.Version. New IDs
+// and the new version are set on p.
+func SaveProduct(p *models.Product, note string) (err error) {
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		log.Printf("Failed to update product info: %v\n", err)
+		log.Printf("Failed to save product: %v", err)
 		return err
 	}
 
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if p.ID == 0 {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO products (title, author, description, product_type, publisher,
+			                      publication_date, language, page_count, series, series_volume,
+			                      status, publish_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING id, version
+		`, p.Title, p.Author, p.Description, p.ProductType, p.Publisher,
+			p.PublicationDate, p.Language, p.PageCount, p.Series, p.SeriesVolume,
+			p.Status, p.PublishAt).Scan(&p.ID, &p.Version)
+	} else {
+		err = tx.QueryRow(ctx, `
+			UPDATE products
+			SET title = $1, description = $2, product_type = $3, publisher = $4,
+			    publication_date = $5, language = $6, page_count = $7, series = $8,
+			    series_volume = $9, status = $10, publish_at = $11, version = version + 1
+			WHERE id = $12 AND version = $13
+			RETURNING version
+		`, p.Title, p.Description, p.ProductType, p.Publisher,
+			p.PublicationDate, p.Language, p.PageCount, p.Series,
+			p.SeriesVolume, p.Status, p.PublishAt, p.ID, p.Version).Scan(&p.Version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrVersionConflict
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to save product %q: %v", p.Title, err)
+		return err
+	}
+
+	if err = setContributors(tx, p.ID, p.Contributors); err != nil {
+		return err
+	}
+	categoryIDs := make([]int, len(p.Categories))
+	for i, c := range p.Categories {
+		categoryIDs[i] = c.ID
+	}
+	if err = setCategories(tx, p.ID, categoryIDs); err != nil {
+		return err
+	}
+	tags := make([]string, len(p.Tags))
+	for i, t := range p.Tags {
+		tags[i] = t.Name
+	}
+	if err = setTags(tx, p.ID, tags); err != nil {
+		return err
+	}
+
+	for i := range p.Variants {
+		if err = saveVariant(tx, p.ID, &p.Variants[i]); err != nil {
+			return err
+		}
+	}
+	return insertRevision(tx, p, note)
+}
+
+// saveVariant inserts or updates a variant of the product and replaces its
+// explicit price list with v.Prices.
+func saveVariant(tx pgx.Tx, product_id int, v *models.Variant) error {
+	v.Product_ID = product_id
+	kind, note := models.MovementAdjustment, "Changed on the product form"
+	if v.ID == 0 {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO variants (product_id, format, isbn, sku, barcode, stock, cents, image_path)
+			VALUES ($1, $2, $3, $4, $5, 0, $6, $7)
+			RETURNING id
+		`, product_id, v.Format, v.ISBN, v.SKU, v.Barcode, v.Cents, v.ImagePath).Scan(&v.ID)
+		if err != nil {
+			log.Printf("Failed to insert variant (format: %s): %v", v.Format, err)
+			return err
+		}
+		kind, note = models.MovementReceipt, "Entered with the new variant"
+	} else {
+		tag, err := tx.Exec(ctx, `
+			UPDATE variants
+			SET format = $1, isbn = $2, sku = $3, barcode = $4, cents = $5, image_path = $6
+			WHERE id = $7 AND product_id = $8
+		`, v.Format, v.ISBN, v.SKU, v.Barcode, v.Cents, v.ImagePath, v.ID, product_id)
+		if err != nil {
+			log.Printf("Failed to update variant (id: %d): %v", v.ID, err)
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			// Removed by someone else, or not this product's
+			return ErrVersionConflict
+		}
+	}
+	switch {
+	case kind == models.MovementReceipt:
+		if err := setStock(tx, v.ID, v.Stock, kind, note); err != nil {
+			return err
+		}
+	case v.StockShown != nil && v.Stock != *v.StockShown:
+		// Only what the editor changed, so sales since the form loaded stay
+		if err := adjustStock(tx, v.ID, v.Stock-*v.StockShown, kind, note); err != nil {
+			return err
+		}
+	}
+	// The revision records the stock as it now is
+	if err := tx.QueryRow(ctx, `SELECT stock FROM variants WHERE id = $1`, v.ID).Scan(&v.Stock); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `DELETE FROM variant_prices WHERE variant_id = $1`, v.ID)
+	if err != nil {
+		return err
+	}
+	for currency, cents := range v.Prices {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO variant_prices (variant_id, currency, cents)
+			VALUES ($1, $2, $3)
+		`, v.ID, currency, cents)
+		if err != nil {
+			log.Printf("Failed to set variant price (id: %d, %s): %v", v.ID, currency, err)
+			return err
+		}
+	}
 	return nil
 }
 
 func GetAllProducts() ([]models.Product, error) {
 	// Query to join product with variants
 	rows, err := db.Query(context.Background(), `
-		SELECT b.id, b.title, b.author, b.description, 
-		       v.color, v.stock, v.cents, v.image_path
+		SELECT `+productColumns+`
 		FROM products b
-		LEFT JOIN variants v ON b.id = v.product_id
-		ORDER BY b.id, v.color
+		LEFT JOIN variants v ON b.id = v.product_id AND `+visibleVariant("v")+`
+		WHERE `+liveProduct("b")+`
+		ORDER BY b.id, v.format
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	products, err := collectProducts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachPrimaryImages(products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// productSorts maps listing sort orders to ORDER BY clauses over the rows
+// grouped by pageOfProducts.
+var productSorts = map[string]string{
+	models.SortTitle:     `p.title, p.id`,
+	models.SortAuthor:    `p.author, p.title, p.id`,
+	models.SortNewest:    `p.created_at DESC, p.id DESC`,
+	models.SortPriceLow:  `MIN(v.cents) NULLS LAST, p.title, p.id`,
+	models.SortPriceHigh: `MIN(v.cents) DESC NULLS LAST, p.title, p.id`,
+}
+
+// GetProductListing returns a page of the products matching the filter and
+// fills in page.Total. A product matches when one of its variants passes all
+// the variant filters, and sorts by the lowest price among those variants.
+func GetProductListing(f models.ProductFilter, page *models.Pagination) ([]models.Product, error) {
+	var args []any
+	join, conds := productFilterSQL(f, "", &args)
+
+	from := `
+		FROM products p
+		` + join
+	if len(conds) > 0 {
+		from += "\n\t\tWHERE " + strings.Join(conds, " AND ")
+	}
+
+	order, ok := productSorts[f.Sort]
+	if !ok {
+		order = productSorts[models.SortTitle]
+	}
+	return pageOfProducts(from, order, page, args...)
+}
+
+// Filters productFilterSQL can be told to skip, so a facet can count every
+// option rather than only the one already chosen.
+const (
+	filterAuthor = "author"
+	filterFormat = "format"
+	filterPrice  = "price"
+	filterStock  = "stock"
+)
+
+// productFilterSQL turns the filter into a join of products p onto their
+// matching variants v and the WHERE conditions to go with it, appending the
+// values to args. The filter named by skip is left out.
+func productFilterSQL(f models.ProductFilter, skip string, args *[]any) (join string, conds []string) {
+	arg := func(v any) string {
+		*args = append(*args, v)
+		return "$" + strconv.Itoa(len(*args))
+	}
+
+	join = `LEFT JOIN variants v ON v.product_id = p.id AND ` + visibleVariant("v")
+	conds = append(conds, visibleProduct("p"))
+	variantFiltered := false
+	if f.Format != "" && skip != filterFormat {
+		join += " AND v.format = " + arg(f.Format)
+		variantFiltered = true
+	}
+	if f.InStock && skip != filterStock {
+		join += " AND v.stock > 0"
+		variantFiltered = true
+	}
+	if f.MinCents > 0 && skip != filterPrice {
+		join += " AND v.cents >= " + arg(f.MinCents)
+		variantFiltered = true
+	}
+	if f.MaxCents > 0 && skip != filterPrice {
+		join += " AND v.cents <= " + arg(f.MaxCents)
+		variantFiltered = true
+	}
+	if variantFiltered {
+		conds = append(conds, "v.id IS NOT NULL")
+	}
+
+	if f.Author != "" && skip != filterAuthor {
+		conds = append(conds, `p.id IN (
+			SELECT pc.product_id FROM product_contributors pc
+			JOIN authors a ON a.id = pc.author_id
+			WHERE a.slug = `+arg(f.Author)+`)`)
+	}
+	return join, conds
+}
+
+// liveProduct is the condition for the product with the given table alias
+// not to be archived. Admin lists show live products whatever their status.
+func liveProduct(alias string) string {
+	return alias + ".archived_at IS NULL"
+}
+
+// visibleProduct is the condition for the product with the given table alias
+// to be shown in the storefront.
+func visibleProduct(alias string) string {
+	return liveProduct(alias) + " AND " + alias + ".status = '" + models.StatusPublished + "'"
+}
+
+// visibleVariant is the condition for the variant with the given table alias
+// to be offered in the storefront.
+func visibleVariant(alias string) string {
+	return alias + ".archived_at IS NULL"
+}
+
+// productColumns are the product and variant columns read by collectProducts.
+const productColumns = `
+	b.id, b.title, b.author, b.description,
+	b.publisher, b.publication_date, b.language, b.series, b.series_volume,
+	b.status, b.publish_at,
+	v.id, v.format, v.isbn, v.stock, v.cents, v.image_path`
+
+// collectProducts groups rows of products LEFT JOINed with their variants,
+// ordered by product, into products with their variants.
+func collectProducts(rows pgx.Rows) ([]models.Product, error) {
 	var products []models.Product
 	var currentProduct *models.Product
 
-	// Iterate through query results
 	for rows.Next() {
 		var b models.Product
 		var v models.Variant
 
-		// Use pointers for nullable fields
-		var color *string
+		var variantID *int
+		var format *string
+		var isbn *string
 		var stock *int
 		var price *int64
 		var imagePath *string
 
-		// Scan the values into the appropriate variables, including pointers
 		err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Description,
-			&color, &stock, &price, &imagePath)
+			&b.Publisher, &b.PublicationDate, &b.Language, &b.Series, &b.SeriesVolume,
+			&b.Status, &b.PublishAt,
+			&variantID, &format, &isbn, &stock, &price, &imagePath)
 		if err != nil {
 			log.Println("Error scanning row:", err)
 			return nil, err
 		}
 
-		// Check if we need to create a new product or if we're still processing the same product
 		if currentProduct == nil || currentProduct.ID != b.ID {
-			// Add the previous product to the list, if any
 			if currentProduct != nil {
 				products = append(products, *currentProduct)
 			}
-
-			// Create a new product and set it as current
 			currentProduct = &b
-			currentProduct.Variants = []models.Variant{} // Initialize the variants array
+			currentProduct.Variants = []models.Variant{}
 		}
 
-		// Only append the variant if it's not NULL (i.e., a valid variant)
-		if color != nil {
-			v.Color = *color
+		if variantID != nil {
+			v.ID = *variantID
+			v.Product_ID = b.ID
+		}
+		if format != nil {
+			v.Format = *format
+		}
+		if isbn != nil {
+			v.ISBN = *isbn
 		}
 		if stock != nil {
 			v.Stock = *stock
@@ -214,52 +395,53 @@ func GetAllProducts() ([]models.Product, error) {
 			v.ImagePath = *imagePath
 		}
 
-		// Append the variant to the product's variants array if it's valid
-		if v.Color != "" {
+		if v.Format != "" {
 			currentProduct.Variants = append(currentProduct.Variants, v)
 		}
 	}
 
-	// Add the last product to the list
 	if currentProduct != nil {
 		products = append(products, *currentProduct)
 	}
 
-	// for i := 0; i < len(products); i++ {
-	// 	println(products[i].Title)
-	// }
-
 	return products, rows.Err()
 }
 
-func DeleteProduct(id int) {
-	// Before deleting the product:
-	// product, err := db.GetProductByID(productID)
-	// if err == nil && product.ImagePath != "" {
-	// 	os.Remove("static/img/" + product.ImagePath)
-	// }
-	DeleteProductEntry(id)
-	DeleteVariantEntries(id)
-}
+// GetProductsByIDs loads the products with the given IDs, in the same order.
+func GetProductsByIDs(ids []int) ([]models.Product, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+productColumns+`
+		FROM products b
+		LEFT JOIN variants v ON b.id = v.product_id AND `+visibleVariant("v")+`
+		WHERE b.id = ANY($1)
+		ORDER BY array_position($1, b.id), v.format
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-func InsertProductReturningID(title, author, description string) (int, error) {
-	var id int
-	sql := `
-		INSERT INTO products (title, author, description)
-		VALUES ($1, $2, $3)
-		RETURNING id
-	`
-	err := db.QueryRow(ctx, sql, title, author, description).Scan(&id)
+	products, err := collectProducts(rows)
 	if err != nil {
-		log.Printf("InsertProduct error: %v\n", err)
-		return 0, err
+		return nil, err
+	}
+	if err := attachPrimaryImages(products); err != nil {
+		return nil, err
 	}
-	return id, nil
+	return products, nil
 }
 
-func DeleteProductEntry(id int) {
-	_, err := db.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+// PublishScheduled publishes the scheduled products whose time has come and
+// returns how many there were. Their version is bumped so an edit form
+// opened while they were scheduled can't put them back.
+func PublishScheduled() (int, error) {
+	tag, err := db.Exec(ctx, `
+		UPDATE products
+		SET status = $1, version = version + 1
+		WHERE status = $2 AND publish_at <= NOW()
+	`, models.StatusPublished, models.StatusScheduled)
 	if err != nil {
-		log.Printf("error deleting product: %v\n", err)
+		return 0, fmt.Errorf("error publishing scheduled products: %v", err)
 	}
+	return int(tag.RowsAffected()), nil
 }
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func GetPromotionByCode(code string) (models.Promotion, error) {
+	var p models.Promotion
+
+	err := db.QueryRow(ctx, `
+		SELECT id, code, discount_type, percent_off, cents, starts_at, ends_at,
+		       usage_limit, times_used, active, created_at
+		FROM promotions
+		WHERE UPPER(code) = UPPER($1)
+	`, strings.TrimSpace(code)).Scan(&p.ID, &p.Code, &p.DiscountType, &p.PercentOff, &p.Cents,
+		&p.StartsAt, &p.EndsAt, &p.UsageLimit, &p.TimesUsed, &p.Active, &p.CreatedAt)
+	if err != nil {
+		return models.Promotion{}, fmt.Errorf("error fetching promotion: %v", err)
+	}
+
+	if err := loadPromotionEligibility(&p); err != nil {
+		return models.Promotion{}, err
+	}
+
+	return p, nil
+}
+
+func GetAllPromotions() ([]models.Promotion, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, code, discount_type, percent_off, cents, starts_at, ends_at,
+		       usage_limit, times_used, active, created_at
+		FROM promotions
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []models.Promotion
+	for rows.Next() {
+		var p models.Promotion
+		err := rows.Scan(&p.ID, &p.Code, &p.DiscountType, &p.PercentOff, &p.Cents,
+			&p.StartsAt, &p.EndsAt, &p.UsageLimit, &p.TimesUsed, &p.Active, &p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning promotion: %v", err)
+		}
+		promotions = append(promotions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range promotions {
+		if err := loadPromotionEligibility(&promotions[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return promotions, nil
+}
+
+func loadPromotionEligibility(p *models.Promotion) error {
+	rows, err := db.Query(ctx, `SELECT product_id FROM promotion_products WHERE promotion_id = $1`, p.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching promotion products: %v", err)
+	}
+	p.ProductIDs, err = pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("error scanning promotion products: %v", err)
+	}
+
+	rows, err = db.Query(ctx, `SELECT author_id FROM promotion_authors WHERE promotion_id = $1`, p.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching promotion authors: %v", err)
+	}
+	p.AuthorIDs, err = pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("error scanning promotion authors: %v", err)
+	}
+
+	return nil
+}
+
+func InsertPromotion(p models.Promotion) (promotionID int, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to create promotion: %v", err)
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO promotions (code, discount_type, percent_off, cents, starts_at, ends_at, usage_limit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`, strings.TrimSpace(p.Code), p.DiscountType, p.PercentOff, p.Cents, p.StartsAt, p.EndsAt, p.UsageLimit,
+	).Scan(&promotionID)
+	if err != nil {
+		log.Printf("Failed to insert promotion: %v", err)
+		return 0, err
+	}
+
+	for _, productID := range p.ProductIDs {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO promotion_products (promotion_id, product_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			promotionID, productID,
+		)
+		if err != nil {
+			log.Printf("Failed to insert promotion product: %v", err)
+			return 0, err
+		}
+	}
+
+	for _, authorID := range p.AuthorIDs {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO promotion_authors (promotion_id, author_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			promotionID, authorID,
+		)
+		if err != nil {
+			log.Printf("Failed to insert promotion author: %v", err)
+			return 0, err
+		}
+	}
+
+	return promotionID, nil
+}
+
+func SetPromotionActive(id int, active bool) error {
+	_, err := db.Exec(ctx, `UPDATE promotions SET active = $1 WHERE id = $2`, active, id)
+	if err != nil {
+		log.Printf("Failed to update promotion (id: %d): %v\n", id, err)
+	}
+	return err
+}
+
+// HoldPromotion reserves one use of a promotion code for a checkout under
+// reference. It reports false, holding nothing, when the code is inactive or
+// its usage limit is reached; the check and the count are one statement, so
+// two checkouts can't both take the last use.
+func HoldPromotion(code, reference string) (held bool, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to hold promotion: %v", err)
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var promotionID int
+	err = tx.QueryRow(ctx, `
+		UPDATE promotions
+		SET times_used = times_used + 1
+		WHERE UPPER(code) = UPPER($1) AND active
+		  AND (usage_limit IS NULL OR times_used < usage_limit)
+		RETURNING id
+	`, strings.TrimSpace(code)).Scan(&promotionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO promotion_holds (reference, promotion_id) VALUES ($1, $2)
+	`, reference, promotionID)
+	if err != nil {
+		log.Printf("Failed to insert promotion hold: %v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleasePromotionHold gives back the use held for a checkout that was never
+// paid. It is safe to call more than once for the same hold.
+func ReleasePromotionHold(reference string) error {
+	_, err := db.Exec(ctx, `
+		WITH released AS (
+			DELETE FROM promotion_holds
+			WHERE reference = $1 AND order_id IS NULL
+			RETURNING promotion_id
+		)
+		UPDATE promotions p
+		SET times_used = GREATEST(p.times_used - 1, 0)
+		FROM released r
+		WHERE p.id = r.promotion_id
+	`, reference)
+	if err != nil {
+		log.Printf("Failed to release promotion hold %s: %v", reference, err)
+	}
+	return err
+}
+
+// claimPromotionHold attaches a checkout's held use to the order it paid for.
+func claimPromotionHold(tx pgx.Tx, reference string, orderID int) error {
+	tag, err := tx.Exec(ctx, `
+		UPDATE promotion_holds SET order_id = $1
+		WHERE reference = $2 AND order_id IS NULL
+	`, orderID, reference)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("promotion hold %s was already claimed or released", reference)
+	}
+	return nil
+}
+
+// redeemPromotion counts one use of a promotion code for an order whose
+// checkout held none. The customer has already paid, so the use is always
+// recorded.
+func redeemPromotion(tx pgx.Tx, code string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE promotions
+		SET times_used = times_used + 1
+		WHERE UPPER(code) = UPPER($1)
+	`, code)
+	return err
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// lowStock matches the live, stocked variants v below their reorder
+// threshold.
+const lowStock = `
+	v.reorder_threshold > 0 AND v.stock < v.reorder_threshold
+	AND v.archived_at IS NULL AND p.archived_at IS NULL
+	AND v.format IN ('` + models.FormatHardcover + `', '` + models.FormatPaperback + `')`
+
+// SetReorderThreshold sets the stock below which a variant is reordered;
+// zero turns reordering off. A changed threshold may alert again.
+func SetReorderThreshold(variant_id, threshold int) error {
+	_, err := db.Exec(ctx, `
+		UPDATE variants SET reorder_threshold = $1, low_stock_alerted_at = NULL WHERE id = $2
+	`, threshold, variant_id)
+	if err != nil {
+		log.Printf("Failed to set reorder threshold (variant: %d): %v", variant_id, err)
+	}
+	return err
+}
+
+// ClearRestockedAlerts forgets the alerts of variants back at or above their
+// threshold, so the next dip alerts again.
+func ClearRestockedAlerts() error {
+	_, err := db.Exec(ctx, `
+		UPDATE variants SET low_stock_alerted_at = NULL
+		WHERE low_stock_alerted_at IS NOT NULL AND stock >= reorder_threshold
+	`)
+	return err
+}
+
+// GetUnalertedLowStock returns the variants below their reorder threshold
+// that no alert has been sent for.
+func GetUnalertedLowStock() ([]models.ReorderItem, error) {
+	return reorderItems(`
+		SELECT v.id, p.id, p.title, v.format, v.isbn, v.sku, v.stock, v.reorder_threshold, 0, v.low_stock_alerted_at
+		FROM variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE ` + lowStock + ` AND v.low_stock_alerted_at IS NULL
+		ORDER BY p.title, v.format
+	`)
+}
+
+// MarkLowStockAlerted records that an alert was sent for the variants.
+func MarkLowStockAlerted(variant_ids []int) error {
+	_, err := db.Exec(ctx, `UPDATE variants SET low_stock_alerted_at = NOW() WHERE id = ANY($1)`, variant_ids)
+	return err
+}
+
+// CountLowStock returns how many variants are below their reorder threshold.
+func CountLowStock() (int, error) {
+	var n int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM variants v JOIN products p ON p.id = v.product_id WHERE `+lowStock,
+	).Scan(&n)
+	return n, err
+}
+
+// GetReorderReport returns the variants below their reorder threshold with
+// the units sold in the last days, fastest selling first. Cancelled orders
+// don't count.
+func GetReorderReport(days int) ([]models.ReorderItem, error) {
+	items, err := reorderItems(`
+		SELECT v.id, p.id, p.title, v.format, v.isbn, v.sku, v.stock, v.reorder_threshold,
+		       COALESCE(s.sold, 0), v.low_stock_alerted_at
+		FROM variants v
+		JOIN products p ON p.id = v.product_id
+		LEFT JOIN (
+			SELECT oi.variant_id, SUM(oi.quantity) AS sold
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.order_id
+			WHERE o.status <> $1 AND o.created_at >= NOW() - make_interval(days => $2)
+			GROUP BY oi.variant_id
+		) s ON s.variant_id = v.id
+		WHERE `+lowStock+`
+		ORDER BY COALESCE(s.sold, 0) DESC, v.stock - v.reorder_threshold, p.title, v.format
+	`, models.OrderStatusCancelled, days)
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range items {
+		i := &items[n]
+		i.PerDay = float64(i.Sold) / float64(days)
+		i.DaysLeft = -1
+		if i.Sold > 0 {
+			i.DaysLeft = float64(i.Stock) / i.PerDay
+		}
+		// Enough to reach the threshold, or to sell for another window
+		i.Suggested = max(i.Threshold, i.Sold) - i.Stock
+	}
+	return items, nil
+}
+
+func reorderItems(sql string, args ...any) ([]models.ReorderItem, error) {
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching low stock: %v", err)
+	}
+	defer rows.Close()
+
+	var items []models.ReorderItem
+	for rows.Next() {
+		var i models.ReorderItem
+		err := rows.Scan(&i.Variant_ID, &i.Product_ID, &i.Title, &i.Format, &i.ISBN, &i.SKU,
+			&i.Stock, &i.Threshold, &i.Sold, &i.AlertedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning low stock: %v", err)
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,371 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const returnColumns = `
+	r.id, r.order_id, r.rma_number, r.status, r.reason, r.admin_note, r.refund_cents,
+	r.stripe_refund_id, r.created_at, r.updated_at, o.order_number, o.email`
+
+func scanReturn(row pgx.Row) (models.Return, error) {
+	var ret models.Return
+	err := row.Scan(&ret.ID, &ret.Order_ID, &ret.RMANumber, &ret.Status, &ret.Reason, &ret.AdminNote,
+		&ret.RefundCents, &ret.StripeRefund_ID, &ret.CreatedAt, &ret.UpdatedAt, &ret.OrderNumber, &ret.Email)
+	return ret, err
+}
+
+func loadReturnItems(ret *models.Return) error {
+	rows, err := db.Query(ctx, `
+		SELECT ri.id, ri.order_item_id, ri.quantity, ri.resellable,
+		       oi.variant_id, oi.cents, oi.product_title, oi.variant_format
+		FROM return_items ri
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE ri.return_id = $1
+		ORDER BY ri.id
+	`, ret.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching return items: %v", err)
+	}
+	defer rows.Close()
+
+	ret.Items = nil
+	for rows.Next() {
+		var item models.ReturnItem
+		err := rows.Scan(&item.ID, &item.OrderItem_ID, &item.Quantity, &item.Resellable,
+			&item.Variant_ID, &item.Cents, &item.ProductTitle, &item.VariantFormat)
+		if err != nil {
+			return fmt.Errorf("error scanning return item: %v", err)
+		}
+		item.Return_ID = ret.ID
+		ret.Items = append(ret.Items, item)
+	}
+
+	return rows.Err()
+}
+
+func GetReturnByID(id int) (models.Return, error) {
+	ret, err := scanReturn(db.QueryRow(ctx, `
+		SELECT `+returnColumns+`
+		FROM returns r
+		JOIN orders o ON o.id = r.order_id
+		WHERE r.id = $1
+	`, id))
+	if err != nil {
+		return models.Return{}, fmt.Errorf("error fetching return: %v", err)
+	}
+
+	if err := loadReturnItems(&ret); err != nil {
+		return models.Return{}, err
+	}
+	return ret, nil
+}
+
+// GetReturns returns every return with the given status, or all of them when
+// status is empty, oldest first.
+func GetReturns(status string) ([]models.Return, error) {
+	return queryReturns(`WHERE $1 = '' OR r.status = $1`, status)
+}
+
+func GetReturnsByOrderID(order_id int) ([]models.Return, error) {
+	return queryReturns(`WHERE r.order_id = $1`, order_id)
+}
+
+func queryReturns(where string, arg any) ([]models.Return, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+returnColumns+`
+		FROM returns r
+		JOIN orders o ON o.id = r.order_id
+		`+where+`
+		ORDER BY r.created_at, r.id
+	`, arg)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching returns: %v", err)
+	}
+	defer rows.Close()
+
+	var returns []models.Return
+	for rows.Next() {
+		ret, err := scanReturn(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning return: %v", err)
+		}
+		returns = append(returns, ret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range returns {
+		if err := loadReturnItems(&returns[i]); err != nil {
+			return nil, err
+		}
+	}
+	return returns, nil
+}
+
+// InsertReturn stores a return request. Quantities are checked against what
+// was ordered less anything already on an open or completed return.
+func InsertReturn(ret models.Return) (returnID int, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to create return: %v", err)
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `SELECT id FROM orders WHERE id = $1 FOR UPDATE`, ret.Order_ID)
+	if err != nil {
+		return 0, err
+	}
+
+	returnable := make(map[int]int)
+	rows, err := tx.Query(ctx, `
+		SELECT oi.id, oi.quantity - COALESCE(SUM(ri.quantity) FILTER (WHERE r.status <> 'rejected'), 0)
+		FROM order_items oi
+		LEFT JOIN return_items ri ON ri.order_item_id = oi.id
+		LEFT JOIN returns r ON r.id = ri.return_id
+		WHERE oi.order_id = $1
+		GROUP BY oi.id, oi.quantity
+	`, ret.Order_ID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var itemID, left int
+		if err = rows.Scan(&itemID, &left); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		returnable[itemID] = left
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, item := range ret.Items {
+		left, ok := returnable[item.OrderItem_ID]
+		if !ok {
+			err = fmt.Errorf("item %d is not part of this order", item.OrderItem_ID)
+			return 0, err
+		}
+		if item.Quantity <= 0 || item.Quantity > left {
+			err = fmt.Errorf("only %d of %s can be returned", left, item.ProductTitle)
+			return 0, err
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO returns (order_id, rma_number, reason)
+		VALUES ($1, $2, $3) RETURNING id
+	`, ret.Order_ID, ret.RMANumber, ret.Reason).Scan(&returnID)
+	if err != nil {
+		log.Printf("Failed to insert return: %v", err)
+		return 0, err
+	}
+
+	for _, item := range ret.Items {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO return_items (return_id, order_item_id, quantity)
+			VALUES ($1, $2, $3)
+		`, returnID, item.OrderItem_ID, item.Quantity)
+		if err != nil {
+			log.Printf("Failed to insert return item: %v", err)
+			return 0, err
+		}
+	}
+
+	return returnID, nil
+}
+
+// UpdateReturnStatus moves a return from one status to another, failing if
+// it is no longer in the expected status.
+func UpdateReturnStatus(id int, from, to, note string) error {
+	tag, err := db.Exec(ctx, `
+		UPDATE returns
+		SET status = $1, admin_note = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = $4
+	`, to, note, id, from)
+	if err != nil {
+		log.Printf("Failed to update return (id: %d): %v\n", id, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("return %d is not %s", id, from)
+	}
+	return nil
+}
+
+// ReceiveReturn marks an approved return as received and puts the items
+// flagged as resellable back into stock.
+func ReceiveReturn(id int, resellable map[int]bool) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to receive return: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE returns
+		SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+	`, models.ReturnStatusReceived, id, models.ReturnStatusApproved)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		err = fmt.Errorf("return %d is not %s", id, models.ReturnStatusApproved)
+		return err
+	}
+
+	for itemID, ok := range resellable {
+		if !ok {
+			continue
+		}
+		tag, err = tx.Exec(ctx, `
+			UPDATE return_items SET resellable = TRUE
+			WHERE id = $1 AND return_id = $2
+		`, itemID, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			err = fmt.Errorf("item %d is not part of return %d", itemID, id)
+			return err
+		}
+	}
+
+	err = restockReturn(tx, id)
+	if err != nil {
+		log.Printf("Failed to restock return %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// ClaimReturnRefund marks a received return as refunding, so only one refund
+// of it can be under way.
+func ClaimReturnRefund(id int) error {
+	return moveReturn(id, models.ReturnStatusReceived, models.ReturnStatusRefunding)
+}
+
+// ReleaseReturnRefund puts a return back to received after its refund failed.
+func ReleaseReturnRefund(id int) error {
+	return moveReturn(id, models.ReturnStatusRefunding, models.ReturnStatusReceived)
+}
+
+func moveReturn(id int, from, to string) error {
+	tag, err := db.Exec(ctx, `
+		UPDATE returns SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+	`, to, id, from)
+	if err != nil {
+		log.Printf("Failed to update return (id: %d): %v\n", id, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("return %d is not %s", id, from)
+	}
+	return nil
+}
+
+// CompleteReturn records a claimed return as refunded. refundCents is the
+// whole refund; giftCardCents of it, the share paid by gift card, goes to the
+// customer's store credit account, whose ID is returned when it is credited.
+func CompleteReturn(id int, refundCents int64, stripeRefundID, email, currency, code string, giftCardCents int64) (giftCardID int, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to complete return: %v", err)
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE returns
+		SET status = $1, refund_cents = $2, stripe_refund_id = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND status = $5
+	`, models.ReturnStatusRefunded, refundCents, stripeRefundID, id, models.ReturnStatusRefunding)
+	if err != nil {
+		log.Printf("Failed to complete return (id: %d): %v\n", id, err)
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		err = fmt.Errorf("return %d is not %s", id, models.ReturnStatusRefunding)
+		return 0, err
+	}
+
+	if giftCardCents > 0 {
+		giftCardID, err = creditStoreCredit(tx, email, currency, code, giftCardCents, id)
+		if err != nil {
+			log.Printf("Failed to credit store credit for return %d: %v", id, err)
+			return 0, err
+		}
+	}
+	return giftCardID, nil
+}
+
+// CreditReturn settles a received return as store credit on the customer's
+// account, returning the account's ID.
+func CreditReturn(id int, email, currency, code string, cents int64) (giftCardID int, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to credit return: %v", err)
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE returns
+		SET status = $1, refund_cents = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = $4
+	`, models.ReturnStatusCredited, cents, id, models.ReturnStatusReceived)
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		err = fmt.Errorf("return %d is not %s", id, models.ReturnStatusReceived)
+		return 0, err
+	}
+
+	giftCardID, err = creditStoreCredit(tx, email, currency, code, cents, id)
+	if err != nil {
+		log.Printf("Failed to credit store credit for return %d: %v", id, err)
+		return 0, err
+	}
+	return giftCardID, nil
+}
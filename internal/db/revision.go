@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// insertRevision records the product as just saved, under its new version.
+func insertRevision(tx pgx.Tx, p *models.Product, note string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO product_revisions (product_id, version, note, snapshot)
+		VALUES ($1, $2, $3, $4)
+	`, p.ID, p.Version, note, models.SnapshotOf(*p))
+	if err != nil {
+		return fmt.Errorf("error saving revision: %v", err)
+	}
+	return nil
+}
+
+const revisionColumns = `id, product_id, version, note, snapshot, created_at`
+
+func scanRevision(row pgx.Row) (models.ProductRevision, error) {
+	var rev models.ProductRevision
+	err := row.Scan(&rev.ID, &rev.Product_ID, &rev.Version, &rev.Note, &rev.Snapshot, &rev.CreatedAt)
+	return rev, err
+}
+
+// GetProductRevisions returns the product's revisions, newest first.
+func GetProductRevisions(product_id int) ([]models.ProductRevision, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+revisionColumns+`
+		FROM product_revisions
+		WHERE product_id = $1
+		ORDER BY version DESC
+	`, product_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.ProductRevision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning revision: %v", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func GetProductRevision(id int) (models.ProductRevision, error) {
+	rev, err := scanRevision(db.QueryRow(ctx, `
+		SELECT `+revisionColumns+` FROM product_revisions WHERE id = $1
+	`, id))
+	if err != nil {
+		return rev, fmt.Errorf("error fetching revision: %v", err)
+	}
+	return rev, nil
+}
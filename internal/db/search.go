@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/isbn"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// Search conditions over products p. $1 is the query text and $2 the query
+// normalised as an ISBN, or empty when it isn't one.
+const (
+	searchFullText = `p.search @@ websearch_to_tsquery('english', $1)`
+	searchFuzzy    = `(p.title % $1 OR p.author % $1 OR p.publisher % $1 OR p.series % $1)`
+
+	rankFullText = `ts_rank_cd(p.search, websearch_to_tsquery('english', $1)) DESC, p.id`
+	rankFuzzy    = `GREATEST(similarity(p.title, $1), similarity(p.author, $1)) DESC, p.id`
+)
+
+var searchISBN = `($2 <> '' AND p.id IN (
+	SELECT v.product_id FROM variants v WHERE v.isbn = $2 AND ` + visibleVariant("v") + `))`
+
+const snippetOptions = `StartSel="` + models.SnippetStart + `", StopSel="` + models.SnippetStop + `", ` +
+	`MaxWords=35, MinWords=15, MaxFragments=2`
+
+// SearchProducts runs a full-text search of titles, authors and descriptions,
+// falling back to trigram matching of titles, authors, publishers and series
+// when nothing matches. An ISBN finds its book either way. It returns the
+// requested page of results with facet counts for narrowing them down.
+func SearchProducts(query string, f models.ProductFilter, buckets []models.PriceBucket, page *models.Pagination) (models.SearchResult, error) {
+	number, _ := isbn.Normalize(query)
+	result := models.SearchResult{Query: query}
+
+	var matches int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM products p
+		WHERE (`+searchFullText+` OR `+searchISBN+`) AND `+visibleProduct("p"),
+		query, number).Scan(&matches)
+	if err != nil {
+		return result, fmt.Errorf("error searching products: %v", err)
+	}
+
+	match, rank := searchFullText, rankFullText
+	if matches == 0 {
+		match, rank = searchFuzzy, rankFuzzy
+		result.Fuzzy = true
+	}
+	match = "(" + match + " OR " + searchISBN + ")"
+
+	from, args := searchFrom(match, query, number, f, "")
+	order, ok := productSorts[f.Sort]
+	if !ok {
+		order = rank
+	}
+	result.Products, err = pageOfProducts(from, order, page, args...)
+	if err != nil {
+		return result, err
+	}
+	result.Page = *page
+
+	if result.Facets, err = searchFacets(match, query, number, f, buckets); err != nil {
+		return result, err
+	}
+	if result.Snippets, err = searchSnippets(query, result.Products); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// searchFrom is the FROM ... WHERE clause for pageOfProducts selecting the
+// search matches that pass the filter, less the filter named by skip.
+func searchFrom(match, query, number string, f models.ProductFilter, skip string) (string, []any) {
+	args := []any{query, number}
+	join, conds := productFilterSQL(f, skip, &args)
+	return `
+		FROM products p
+		` + join + `
+		WHERE ` + strings.Join(append([]string{match}, conds...), " AND "), args
+}
+
+// searchFacets counts the results under each facet option. Each facet is
+// counted with the other filters applied but not its own, so choosing one
+// option still shows how many results the others would give.
+func searchFacets(match, query, number string, f models.ProductFilter, buckets []models.PriceBucket) (models.SearchFacets, error) {
+	var facets models.SearchFacets
+
+	from, args := searchFrom(match, query, number, f, filterAuthor)
+	rows, err := db.Query(ctx, `
+		SELECT a.slug, a.name, COUNT(DISTINCT pc.product_id)
+		FROM product_contributors pc
+		JOIN authors a ON a.id = pc.author_id
+		WHERE pc.role = 'author' AND pc.product_id IN (SELECT p.id `+from+`)
+		GROUP BY a.id
+		ORDER BY 3 DESC, a.name
+		LIMIT 10
+	`, args...)
+	if err != nil {
+		return facets, fmt.Errorf("error counting authors: %v", err)
+	}
+	facets.Authors, err = collectFacets(rows, f.Author)
+	if err != nil {
+		return facets, err
+	}
+
+	from, args = searchFrom(match, query, number, f, filterFormat)
+	rows, err = db.Query(ctx, `
+		SELECT v.format, v.format, COUNT(DISTINCT p.id) `+from+` AND v.format IS NOT NULL
+		GROUP BY v.format
+		ORDER BY v.format
+	`, args...)
+	if err != nil {
+		return facets, fmt.Errorf("error counting formats: %v", err)
+	}
+	facets.Formats, err = collectFacets(rows, f.Format)
+	if err != nil {
+		return facets, err
+	}
+
+	if len(buckets) > 0 {
+		from, args = searchFrom(match, query, number, f, filterPrice)
+		counts := make([]string, len(buckets))
+		for i, b := range buckets {
+			cond := "v.cents >= $" + strconv.Itoa(len(args)+1)
+			args = append(args, b.MinCents)
+			if b.MaxCents > 0 {
+				cond += " AND v.cents <= $" + strconv.Itoa(len(args)+1)
+				args = append(args, b.MaxCents)
+			}
+			counts[i] = "COUNT(DISTINCT p.id) FILTER (WHERE " + cond + ")"
+		}
+
+		dest := make([]any, len(buckets))
+		facets.Prices = make([]models.Facet, len(buckets))
+		for i, b := range buckets {
+			facets.Prices[i] = models.Facet{
+				Value:    b.Value,
+				Label:    b.Label,
+				Selected: f.MinCents == b.MinCents && f.MaxCents == b.MaxCents,
+			}
+			dest[i] = &facets.Prices[i].Count
+		}
+		err = db.QueryRow(ctx, `SELECT `+strings.Join(counts, ", ")+` `+from, args...).Scan(dest...)
+		if err != nil {
+			return facets, fmt.Errorf("error counting prices: %v", err)
+		}
+	}
+
+	from, args = searchFrom(match, query, number, f, filterStock)
+	inStock := models.Facet{Value: "1", Label: "In stock", Selected: f.InStock}
+	all := models.Facet{Value: "", Label: "Include out of stock", Selected: !f.InStock}
+	err = db.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT p.id) FILTER (WHERE v.stock > 0), COUNT(DISTINCT p.id) `+from,
+		args...).Scan(&inStock.Count, &all.Count)
+	if err != nil {
+		return facets, fmt.Errorf("error counting availability: %v", err)
+	}
+	facets.Availability = []models.Facet{inStock, all}
+
+	return facets, nil
+}
+
+// collectFacets reads rows of value, label and count, marking the row whose
+// value is selected.
+func collectFacets(rows pgx.Rows, selected string) ([]models.Facet, error) {
+	defer rows.Close()
+
+	var facets []models.Facet
+	for rows.Next() {
+		var facet models.Facet
+		if err := rows.Scan(&facet.Value, &facet.Label, &facet.Count); err != nil {
+			return nil, fmt.Errorf("error scanning facet: %v", err)
+		}
+		facet.Selected = facet.Value == selected
+		facets = append(facets, facet)
+	}
+	return facets, rows.Err()
+}
+
+// searchSnippets returns an excerpt of each product's description around the
+// words that matched.
+func searchSnippets(query string, products []models.Product) (map[int]string, error) {
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, ts_headline('english', COALESCE(description, ''), websearch_to_tsquery('english', $1), $2)
+		FROM products
+		WHERE id = ANY($3)
+	`, query, snippetOptions, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error highlighting results: %v", err)
+	}
+	defer rows.Close()
+
+	snippets := make(map[int]string, len(ids))
+	for rows.Next() {
+		var id int
+		var snippet string
+		if err := rows.Scan(&id, &snippet); err != nil {
+			return nil, fmt.Errorf("error scanning snippet: %v", err)
+		}
+		snippets[id] = snippet
+	}
+	return snippets, rows.Err()
+}
+
+// suggestTimeout bounds the trigram lookup so autocomplete stays responsive;
+// the prefix index answers on its own when the database is slow.
+const suggestTimeout = 150 * time.Millisecond
+
+// GetProductTitles returns the ID and title of every product, for the
+// autocomplete prefix index.
+func GetProductTitles() ([]models.Product, error) {
+	rows, err := db.Query(ctx, `SELECT id, title FROM products p WHERE `+visibleProduct("p")+` ORDER BY title`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.Product
+	for rows.Next() {
+		var p models.Product
+		if err := rows.Scan(&p.ID, &p.Title); err != nil {
+			return nil, fmt.Errorf("error scanning product title: %v", err)
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// SuggestFuzzy returns titles and authors similar to a partly typed query
+// using the trigram indexes, for typos the prefix index can't match.
+func SuggestFuzzy(query string, limit int) ([]models.Suggestion, error) {
+	qctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+
+	rows, err := db.Query(qctx, `
+		(SELECT 'title', title, '/product/' || id, similarity(title, $1) AS score
+		 FROM products p WHERE title % $1 AND `+visibleProduct("p")+`
+		 ORDER BY score DESC LIMIT $2)
+		UNION ALL
+		(SELECT 'author', name, '/author/' || slug, similarity(name, $1) AS score
+		 FROM authors WHERE name % $1
+		 ORDER BY score DESC LIMIT $2)
+		ORDER BY score DESC
+		LIMIT $2
+	`, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching suggestions: %v", err)
+	}
+	defer rows.Close()
+
+	var suggestions []models.Suggestion
+	for rows.Next() {
+		var s models.Suggestion
+		var score float32
+		if err := rows.Scan(&s.Type, &s.Label, &s.URL, &score); err != nil {
+			return nil, fmt.Errorf("error scanning suggestion: %v", err)
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// InsertSearchLogs writes a batch of searches and clicks in one round trip.
+// Searches go first so a click is never written before its search.
+func InsertSearchLogs(searches []models.SearchLog, clicks []models.SearchClick) error {
+	batch := &pgx.Batch{}
+	for _, s := range searches {
+		batch.Queue(`
+			INSERT INTO search_logs (id, query, result_count, fuzzy, visitor_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (id) DO NOTHING
+		`, s.ID, s.Query, s.ResultCount, s.Fuzzy, s.Visitor_ID, s.CreatedAt)
+	}
+	for _, c := range clicks {
+		batch.Queue(`
+			INSERT INTO search_clicks (search_id, product_id, created_at)
+			VALUES ($1, $2, $3)
+		`, c.Search_ID, c.Product_ID, c.CreatedAt)
+	}
+
+	if err := db.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("error writing search logs: %v", err)
+	}
+	return nil
+}
+
+// searchPurchased is true when the visitor who searched placed an order in
+// the week after.
+const searchPurchased = `EXISTS (
+	SELECT 1 FROM orders o
+	WHERE s.visitor_id <> '' AND o.visitor_id = s.visitor_id
+	  AND o.created_at BETWEEN s.created_at AND s.created_at + INTERVAL '7 days')`
+
+const searchClicked = `EXISTS (SELECT 1 FROM search_clicks c WHERE c.search_id = s.id)`
+
+// GetSearchReport sums up the searches made since the given time: how many
+// led to a click or an order, the most searched queries and the most searched
+// queries that found nothing, limit of each.
+func GetSearchReport(since time.Time, limit int) (models.SearchReport, error) {
+	report := models.SearchReport{Since: since}
+
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE `+searchClicked+`),
+		       COUNT(*) FILTER (WHERE `+searchPurchased+`)
+		FROM search_logs s
+		WHERE s.created_at >= $1
+	`, since).Scan(&report.Searches, &report.Clicked, &report.Purchased)
+	if err != nil {
+		return report, fmt.Errorf("error summing searches: %v", err)
+	}
+
+	if report.TopQueries, err = queryStats(since, false, limit); err != nil {
+		return report, err
+	}
+	if report.NoResults, err = queryStats(since, true, limit); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func queryStats(since time.Time, noResults bool, limit int) ([]models.QueryStat, error) {
+	rows, err := db.Query(ctx, `
+		SELECT s.query, COUNT(*), AVG(s.result_count)::float8,
+		       COUNT(*) FILTER (WHERE `+searchClicked+`),
+		       COUNT(*) FILTER (WHERE `+searchPurchased+`)
+		FROM search_logs s
+		WHERE s.created_at >= $1 AND (NOT $2 OR s.result_count = 0)
+		GROUP BY s.query
+		ORDER BY 2 DESC, s.query
+		LIMIT $3
+	`, since, noResults, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching query stats: %v", err)
+	}
+	defer rows.Close()
+
+	var stats []models.QueryStat
+	for rows.Next() {
+		var q models.QueryStat
+		if err := rows.Scan(&q.Query, &q.Searches, &q.AvgResults, &q.Clicks, &q.Purchases); err != nil {
+			return nil, fmt.Errorf("error scanning query stats: %v", err)
+		}
+		stats = append(stats, q)
+	}
+	return stats, rows.Err()
+}
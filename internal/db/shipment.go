@@ -0,0 +1,168 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// InsertShipment records a shipment and the order items in it, then moves the
+// order to shipped or partially shipped. Quantities are checked against what
+// is still left to ship inside the same transaction.
+func InsertShipment(s models.Shipment) (shipmentID int, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to create shipment: %v", err)
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// Lock the order so two shipments can't both claim the same items
+	var status string
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, s.Order_ID).Scan(&status)
+	if err != nil {
+		return 0, err
+	}
+	// Only paid orders ship, never cancelled or finished ones
+	if status != models.OrderStatusPaid && status != models.OrderStatusPartiallyShipped {
+		err = fmt.Errorf("an order that is %s can't be shipped", strings.ReplaceAll(status, "_", " "))
+		return 0, err
+	}
+
+	// Ebooks and gift cards are never shipped, so they don't count towards
+	// what is left or the order's new status
+	remaining := make(map[int]int)
+	unstocked := make(map[int]bool)
+	rows, err := tx.Query(ctx, `
+		SELECT oi.id, oi.variant_format, oi.quantity - COALESCE(SUM(si.quantity), 0)
+		FROM order_items oi
+		LEFT JOIN shipment_items si ON si.order_item_id = oi.id
+		WHERE oi.order_id = $1
+		GROUP BY oi.id, oi.variant_format, oi.quantity
+	`, s.Order_ID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var itemID, left int
+		var format string
+		if err = rows.Scan(&itemID, &format, &left); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !models.Stocked(format) {
+			unstocked[itemID] = true
+			continue
+		}
+		remaining[itemID] = left
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, item := range s.Items {
+		if unstocked[item.OrderItem_ID] {
+			err = fmt.Errorf("item %d is not a physical item and can't be shipped", item.OrderItem_ID)
+			return 0, err
+		}
+		left, ok := remaining[item.OrderItem_ID]
+		if !ok {
+			err = fmt.Errorf("item %d is not part of order %d", item.OrderItem_ID, s.Order_ID)
+			return 0, err
+		}
+		if item.Quantity <= 0 || item.Quantity > left {
+			err = fmt.Errorf("only %d of item %d left to ship", left, item.OrderItem_ID)
+			return 0, err
+		}
+		remaining[item.OrderItem_ID] = left - item.Quantity
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO shipments (order_id, carrier, tracking_number)
+		VALUES ($1, $2, $3) RETURNING id
+	`, s.Order_ID, s.Carrier, s.TrackingNumber).Scan(&shipmentID)
+	if err != nil {
+		log.Printf("Failed to insert shipment: %v", err)
+		return 0, err
+	}
+
+	for _, item := range s.Items {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO shipment_items (shipment_id, order_item_id, quantity)
+			VALUES ($1, $2, $3)
+		`, shipmentID, item.OrderItem_ID, item.Quantity)
+		if err != nil {
+			log.Printf("Failed to insert shipment item: %v", err)
+			return 0, err
+		}
+	}
+
+	status = models.OrderStatusShipped
+	for _, left := range remaining {
+		if left > 0 {
+			status = models.OrderStatusPartiallyShipped
+			break
+		}
+	}
+	_, err = tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE id = $2`, status, s.Order_ID)
+	if err != nil {
+		log.Printf("Failed to update order status: %v", err)
+		return 0, err
+	}
+
+	return shipmentID, nil
+}
+
+func GetShipmentsByOrderID(order_id int) ([]models.Shipment, error) {
+	rows, err := db.Query(ctx, `
+		SELECT s.id, s.order_id, s.carrier, s.tracking_number, s.shipped_at, s.created_at,
+		       si.order_item_id, si.quantity, oi.product_title, oi.variant_format
+		FROM shipments s
+		JOIN shipment_items si ON si.shipment_id = s.id
+		JOIN order_items oi ON oi.id = si.order_item_id
+		WHERE s.order_id = $1
+		ORDER BY s.shipped_at, s.id, oi.id
+	`, order_id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shipments: %v", err)
+	}
+	defer rows.Close()
+
+	var shipments []models.Shipment
+	var current *models.Shipment
+
+	for rows.Next() {
+		var s models.Shipment
+		var item models.ShipmentItem
+		err := rows.Scan(&s.ID, &s.Order_ID, &s.Carrier, &s.TrackingNumber, &s.ShippedAt, &s.CreatedAt,
+			&item.OrderItem_ID, &item.Quantity, &item.ProductTitle, &item.VariantFormat)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning shipment: %v", err)
+		}
+
+		if current == nil || current.ID != s.ID {
+			if current != nil {
+				shipments = append(shipments, *current)
+			}
+			current = &s
+		}
+		item.Shipment_ID = s.ID
+		current.Items = append(current.Items, item)
+	}
+
+	if current != nil {
+		shipments = append(shipments, *current)
+	}
+
+	return shipments, rows.Err()
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func GetAllSynonyms() ([]models.Synonym, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, term, expansion, created_at
+		FROM search_synonyms
+		ORDER BY LOWER(term)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var synonyms []models.Synonym
+	for rows.Next() {
+		var s models.Synonym
+		if err := rows.Scan(&s.ID, &s.Term, &s.Expansion, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning synonym: %v", err)
+		}
+		synonyms = append(synonyms, s)
+	}
+	return synonyms, rows.Err()
+}
+
+// InsertSynonym adds a synonym, or replaces the expansion of an existing term.
+func InsertSynonym(term, expansion string) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO search_synonyms (term, expansion)
+		VALUES ($1, $2)
+		ON CONFLICT (LOWER(term)) DO UPDATE SET expansion = EXCLUDED.expansion
+	`, strings.ToLower(term), expansion)
+	if err != nil {
+		log.Printf("Failed to save synonym %q: %v", term, err)
+	}
+	return err
+}
+
+func DeleteSynonym(id int) error {
+	_, err := db.Exec(ctx, `DELETE FROM search_synonyms WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("Failed to delete synonym (id: %d): %v", id, err)
+	}
+	return err
+}
+
+// DidYouMean returns the title or author closest to query by trigram
+// similarity, or "" when nothing is close enough to be worth offering.
+func DidYouMean(query string) (string, error) {
+	var suggestion string
+	err := db.QueryRow(ctx, `
+		SELECT COALESCE((
+			SELECT match FROM (
+				SELECT title AS match, similarity(title, $1) AS score FROM products p
+				WHERE title % $1 AND `+visibleProduct("p")+`
+				UNION ALL
+				SELECT name, similarity(name, $1) FROM authors WHERE name % $1
+			) m
+			WHERE LOWER(match) <> LOWER($1)
+			ORDER BY score DESC, match
+			LIMIT 1
+		), '')
+	`, query).Scan(&suggestion)
+	if err != nil {
+		return "", fmt.Errorf("error finding spelling suggestion: %v", err)
+	}
+	return suggestion, nil
+}
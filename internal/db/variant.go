@@ -3,7 +3,6 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/nathanialw/ecommerce/pkg/models"
 )
@@ -12,10 +11,12 @@ func GetVariantByID(variant_id int) (models.Variant, error) {
 	var v models.Variant
 
 	err := db.QueryRow(context.Background(), `
-		SELECT id, color, stock, cents, image_path
+		SELECT id, product_id, format, isbn, sku, barcode, stock, cents, image_path,
+		       reorder_threshold, low_stock_alerted_at, archived_at
 		FROM variants
 		WHERE id = $1
-	`, variant_id).Scan(&v.ID, &v.Color, &v.Stock, &v.Cents, &v.ImagePath)
+	`, variant_id).Scan(&v.ID, &v.Product_ID, &v.Format, &v.ISBN, &v.SKU, &v.Barcode, &v.Stock, &v.Cents, &v.ImagePath,
+		&v.ReorderThreshold, &v.LowStockAlertedAt, &v.ArchivedAt)
 	v.Price = float64(v.Cents) / 100.0
 
 	if err != nil {
@@ -25,15 +26,15 @@ func GetVariantByID(variant_id int) (models.Variant, error) {
 	return v, nil
 }
 
-// Function to get variants by product ID
+// GetVariantsByProductID returns the product's variants that aren't archived.
 func GetVariantsByProductID(product_id int) ([]models.Variant, error) {
 	var variants []models.Variant
 
 	// Query for variants associated with the product
 	rows, err := db.Query(context.Background(), `
-		SELECT id, color, stock, cents, image_path
+		SELECT id, format, isbn, sku, barcode, stock, cents, image_path
 		FROM variants
-		WHERE product_id = $1
+		WHERE product_id = $1 AND archived_at IS NULL
 	`, product_id)
 	if err != nil {
 		// Handle error if variants can't be fetched
@@ -44,7 +45,8 @@ func GetVariantsByProductID(product_id int) ([]models.Variant, error) {
 	// Scan each variant and append to the variants slice
 	for rows.Next() {
 		var v models.Variant
-		err := rows.Scan(&v.ID, &v.Color, &v.Stock, &v.Cents, &v.ImagePath)
+		err := rows.Scan(&v.ID, &v.Format, &v.ISBN, &v.SKU, &v.Barcode, &v.Stock, &v.Cents, &v.ImagePath)
+		v.Product_ID = product_id
 		v.Price = float64(v.Cents) / 100.0
 		if err != nil {
 			// Handle scanning error for variants
@@ -56,57 +58,13 @@ func GetVariantsByProductID(product_id int) ([]models.Variant, error) {
 	return variants, nil
 }
 
-func UpdateProductVariants(product_id int, variants []models.Variant) error {
-	for _, variant := range variants {
-		queryVariant := `
-			UPDATE variants
-			SET color=$1, stock=$2, cents=$3, image_path=$4
-			WHERE product_id=$5 AND color=$1
-		`
-		_, err := db.Exec(ctx, queryVariant, variant.Color, variant.Stock, variant.Cents, variant.ImagePath, product_id)
-		if err != nil {
-			log.Printf("Failed to update variant (color: %s): %v\n", variant.Color, err)
-			return err
-		}
-	}
-	return nil
-}
-
-func UpdateProductVariantByID(variant models.Variant) error {
-	query := `
-		UPDATE variants
-		SET color = $1, stock = $2, cents = $3, image_path = $4
-		WHERE id = $5
-	`
-	_, err := db.Exec(ctx, query, variant.Color, variant.Stock, variant.Cents, variant.ImagePath, variant.ID)
-	if err != nil {
-		log.Printf("Failed to update variant (id: %d): %v\n", variant.ID, err)
-		return err
-	}
-	return nil
-}
-
-func InsertVariant(product_id int, color string, stock int, cents int64, imagePath string) error {
-	_, err := db.Exec(ctx, `
-		INSERT INTO variants (product_id, color, stock, cents, image_path)
-		VALUES ($1, $2, $3, $4, $5)
-	`, product_id, color, stock, cents, imagePath)
-	if err != nil {
-		log.Printf("InsertVariant error: %v\n", err)
-	}
-	return err
-}
-
-func DeleteVariantEntries(product_id int) {
-	_, err := db.Exec(ctx, `DELETE FROM variants WHERE product_id = $1`, product_id)
-	if err != nil {
-		log.Printf("error deleting variants: %v\n", err)
-	}
-}
-
-func DeleteVariantEntry(variant_id int) {
-	_, err := db.Exec(ctx, `DELETE FROM variants WHERE id = $1`, variant_id)
-	if err != nil {
-		log.Printf("error deleting variants: %v\n", err)
-	}
+// ImageInUse reports whether any variant or product gallery still shows the
+// image.
+func ImageInUse(imagePath string) (bool, error) {
+	var inUse bool
+	err := db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM variants WHERE image_path = $1)
+		    OR EXISTS (SELECT 1 FROM product_images WHERE image_path = $1)
+	`, imagePath).Scan(&inUse)
+	return inUse, err
 }
@@ -1,18 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
-	"io"
 	"log"
-	"math"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/nathanialw/ecommerce/internal/admin"
 	"github.com/nathanialw/ecommerce/internal/cache"
 	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
 	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
@@ -72,10 +71,17 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 		"templates/admin/admin.html",
 	))
 
+	lowStock, err := db.CountLowStock()
+	if err != nil {
+		log.Printf("Failed to count low stock: %v", err)
+	}
+
 	d := struct {
 		LoggedIn bool
+		LowStock int
 	}{
 		LoggedIn: true,
+		LowStock: lowStock,
 	}
 
 	tmpl.Execute(w, d)
@@ -114,18 +120,40 @@ func AdminVideosHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func AddProductForm(w http.ResponseWriter, r *http.Request) {
+	renderProductForm(w, "templates/admin/add-product.html", models.Product{Status: models.StatusDraft}, nil, http.StatusOK)
+}
+
+// renderProductForm shows the add or edit product page for the product, with
+// errs marked against the fields they concern.
+func renderProductForm(w http.ResponseWriter, page string, product models.Product, errs models.FieldErrors, status int) {
 	tmpl := template.Must(template.ParseFiles(
 		"templates/layout.html",
 		"templates/admin/header.html",
 		"templates/partials/footer.html",
-		"templates/admin/add-product.html",
+		page,
 	))
 
 	d := struct {
-		LoggedIn bool
+		LoggedIn   bool
+		Product    models.Product
+		Errors     models.FieldErrors
+		Currencies []string
+		Formats    []string
+		Roles      []string
+		Statuses   []string
+		Categories []models.Category
 	}{
-		LoggedIn: true,
+		LoggedIn:   true,
+		Product:    product,
+		Errors:     errs,
+		Currencies: services.SupportedCurrencies,
+		Formats:    models.Formats,
+		Roles:      models.ContributorRoles,
+		Statuses:   models.PublicationStatuses,
+		Categories: cache.GetCategories(),
 	}
+
+	w.WriteHeader(status)
 	tmpl.Execute(w, d)
 }
 
@@ -141,76 +169,23 @@ func AddProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get form values for the product
-	title := r.FormValue("title")
-	author := r.FormValue("author")
-	description := r.FormValue("description")
-
-	// Insert the product into the products table (no variants yet)
-	productID, err := db.InsertProductReturningID(title, author, description)
-	if err != nil {
-		http.Error(w, "Failed to insert product", http.StatusInternalServerError)
+	form := admin.BindProductForm(r)
+	if form.Product.ID != 0 {
+		http.Error(w, "Edit existing products from their edit page", http.StatusBadRequest)
 		return
 	}
+	err = admin.SaveProduct(form)
 
-	// Now process the variants
-	colors := r.Form["color"] // Array of colors
-	stocks := r.Form["stock"] // Array of stock values
-	prices := r.Form["price"]
-	imageFiles := r.MultipartForm.File["variant_image"] // Array of variant images
-
-	// We need to ensure all arrays have the same length
-	if len(colors) != len(stocks) || len(colors) != len(imageFiles) {
-		println("Mismatch in variant data")
-	} else {
-		// Insert each variant using the InsertVariant function
-		for i := range colors {
-			color := colors[i]
-			stock, _ := strconv.Atoi(stocks[i])
-			imagePath := ""
-
-			price, err := strconv.ParseFloat(prices[i], 64)
-			cents := int64(math.Round(price * 100))
-
-			if err != nil {
-				http.Error(w, "Invalid price", http.StatusBadRequest)
-				return
-			}
-
-			// Override only if a new file was uploaded
-			if i < len(imageFiles) {
-				file, err := imageFiles[i].Open()
-				if err != nil {
-					log.Printf("Failed to open file %d: %v", i, err)
-				} else {
-					defer file.Close()
-					imagePath = imageFiles[i].Filename
-					savePath := "static/img/" + imagePath
-
-					dst, err := os.Create(savePath)
-					if err != nil {
-						log.Printf("Failed to create file %d: %v", i, err)
-					} else {
-						defer dst.Close()
-						_, err = io.Copy(dst, file)
-						if err != nil {
-							log.Printf("Failed to write file %d: %v", i, err)
-						}
-					}
-				}
-			}
-
-			// Insert the variant into the book_variants table
-			err = db.InsertVariant(productID, color, stock, cents, imagePath)
-			if err != nil {
-				http.Error(w, "Failed to insert variant", http.StatusInternalServerError)
-				return
-			}
-		}
-
+	var invalid models.FieldErrors
+	if errors.As(err, &invalid) {
+		renderProductForm(w, "templates/admin/add-product.html", form.Product, invalid, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to add product: %v", err)
+		http.Error(w, "Failed to save product", http.StatusInternalServerError)
+		return
 	}
-
-	cache.UpdateCache()
 
 	// Redirect back to the admin page after successful product and variant creation
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
@@ -231,22 +206,20 @@ func EditProductFormHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl := template.Must(template.ParseFiles(
-		"templates/layout.html",
-		"templates/admin/header.html",
-		"templates/partials/footer.html",
-		"templates/admin/edit-product.html",
-	))
-
-	d := struct {
-		LoggedIn bool
-		Product  models.Product
-	}{
-		LoggedIn: true,
-		Product:  *product,
+	variantIDs := make([]int, len(product.Variants))
+	for i, v := range product.Variants {
+		variantIDs[i] = v.ID
+	}
+	priceLists, err := db.GetVariantPriceLists(variantIDs)
+	if err != nil {
+		http.Error(w, "Failed to fetch prices", http.StatusInternalServerError)
+		return
+	}
+	for i := range product.Variants {
+		product.Variants[i].Prices = priceLists[product.Variants[i].ID]
 	}
 
-	tmpl.Execute(w, d)
+	renderProductForm(w, "templates/admin/edit-product.html", *product, nil, http.StatusOK)
 }
 
 func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -255,11 +228,8 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch {
 	case action == "update":
-		println("update...")
-		admin.UpdateProduct(w, r)
-		http.Redirect(w, r, "/admin/edit-products", http.StatusSeeOther)
+		updateProduct(w, r)
 	case strings.HasPrefix(action, "remove_variant-"):
-		println("remove variant...")
 		variantIDStr := strings.TrimPrefix(action, "remove_variant-")
 		DeleteVariantFormHandler(w, r, variantIDStr)
 		http.Redirect(w, r, "/admin/edit-product/"+idStr, http.StatusSeeOther)
@@ -268,6 +238,45 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// updateProduct saves the edit product form, showing it again with the
+// problems marked when it can't be saved.
+func updateProduct(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20) // 10 MB
+	if err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := admin.BindProductForm(r)
+	if form.Product.ID == 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	err = admin.SaveProduct(form)
+
+	var invalid models.FieldErrors
+	if errors.As(err, &invalid) {
+		status := http.StatusUnprocessableEntity
+		if invalid.Has("version") {
+			status = http.StatusConflict
+		}
+		// The gallery isn't part of the form
+		if stored, err := db.GetProductByID(form.Product.ID); err == nil {
+			form.Product.Images = stored.Images
+			form.Product.PrimaryImage = stored.PrimaryImage
+		}
+		renderProductForm(w, "templates/admin/edit-product.html", form.Product, invalid, status)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update product %d: %v", form.Product.ID, err)
+		http.Error(w, "Failed to update", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/edit-products", http.StatusSeeOther)
+}
+
 func EditAllProductssHandler(w http.ResponseWriter, r *http.Request) {
 	products, err := db.GetAllProducts()
 
@@ -293,6 +302,8 @@ func EditAllProductssHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, d)
 }
 
+// DeleteProductFormHandler archives the product rather than deleting it, as
+// orders may refer to its variants. It can be purged from the archived view.
 func DeleteProductFormHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/admin/delete-product/")
 	productID, err := strconv.Atoi(idStr)
@@ -301,13 +312,17 @@ func DeleteProductFormHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db.DeleteProduct(productID)
+	if err := db.ArchiveProduct(productID); err != nil {
+		http.Error(w, "Failed to archive product", http.StatusInternalServerError)
+		return
+	}
 
-	log.Printf("Deleted product with ID %d", productID)
+	log.Printf("Archived product with ID %d", productID)
 	cache.UpdateCache()
 	http.Redirect(w, r, "/admin/edit-products", http.StatusSeeOther)
 }
 
+// DeleteVariantFormHandler archives a variant removed on the edit form.
 func DeleteVariantFormHandler(w http.ResponseWriter, r *http.Request, variantIDStr string) {
 	variantID, err := strconv.Atoi(variantIDStr)
 	if err != nil {
@@ -315,6 +330,7 @@ func DeleteVariantFormHandler(w http.ResponseWriter, r *http.Request, variantIDS
 		return
 	}
 
-	println("deleting variant")
-	db.DeleteVariantEntry(variantID)
+	if err := db.ArchiveVariant(variantID); err == nil {
+		cache.UpdateCache()
+	}
 }
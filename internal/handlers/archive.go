@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/images"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// AdminArchivedHandler lists archived products, and live products with
+// archived variants, for restoring or purging.
+func AdminArchivedHandler(w http.ResponseWriter, r *http.Request) {
+	products, err := db.GetArchivedProducts()
+	if err != nil {
+		http.Error(w, "Failed to fetch archived products", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/archived.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Products []models.Product
+	}{
+		LoggedIn: true,
+		Products: products,
+	}
+	tmpl.Execute(w, d)
+}
+
+// ArchiveProductHandler hides a product from the storefront.
+func ArchiveProductHandler(w http.ResponseWriter, r *http.Request) {
+	archiveAction(w, r, db.ArchiveProduct, "/admin/edit-products")
+}
+
+// RestoreProductHandler puts an archived product back on sale.
+func RestoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	archiveAction(w, r, db.RestoreProduct, "/admin/archived")
+}
+
+// ArchiveVariantHandler withdraws one variant from sale.
+func ArchiveVariantHandler(w http.ResponseWriter, r *http.Request) {
+	archiveAction(w, r, db.ArchiveVariant, "/admin/archived")
+}
+
+// RestoreVariantHandler puts an archived variant back on sale.
+func RestoreVariantHandler(w http.ResponseWriter, r *http.Request) {
+	archiveAction(w, r, db.RestoreVariant, "/admin/archived")
+}
+
+// PurgeProductHandler deletes an archived product no order refers to.
+func PurgeProductHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	imagePaths, err := db.PurgeProduct(id)
+	if !purged(w, err) {
+		return
+	}
+	images.RemoveUnused(imagePaths...)
+
+	log.Printf("Purged product with ID %d", id)
+	cache.UpdateCache()
+	http.Redirect(w, r, "/admin/archived", http.StatusSeeOther)
+}
+
+// PurgeVariantHandler deletes an archived variant no order refers to.
+func PurgeVariantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	imagePath, err := db.PurgeVariant(id)
+	if !purged(w, err) {
+		return
+	}
+	images.RemoveUnused(imagePath)
+
+	log.Printf("Purged variant with ID %d", id)
+	cache.UpdateCache()
+	http.Redirect(w, r, "/admin/archived", http.StatusSeeOther)
+}
+
+func archiveAction(w http.ResponseWriter, r *http.Request, apply func(int) error, next string) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if err := apply(id); err != nil {
+		http.Error(w, "Failed to update", http.StatusInternalServerError)
+		return
+	}
+
+	cache.UpdateCache()
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// purged reports whether a purge succeeded, writing the error response when
+// it didn't.
+func purged(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, db.ErrNotArchived), errors.Is(err, db.ErrInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		log.Printf("Failed to purge: %v", err)
+		http.Error(w, "Failed to purge", http.StatusInternalServerError)
+	}
+	return false
+}
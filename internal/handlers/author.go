@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func AuthorHandler(w http.ResponseWriter, r *http.Request) {
+	author, err := db.GetAuthorBySlug(mux.Vars(r)["slug"])
+	if err != nil {
+		http.Error(w, "Author not found", http.StatusNotFound)
+		return
+	}
+
+	products, err := db.GetProductsByAuthorID(author.ID)
+	if err != nil {
+		http.Error(w, "Failed to load products", http.StatusInternalServerError)
+		return
+	}
+
+	if err := services.ApplyCurrencyToProducts(products, services.GetCurrency(r)); err != nil {
+		http.Error(w, "Failed to price products", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/partials/header.html",
+		"templates/partials/search.html",
+		"templates/partials/footer.html",
+		"templates/product/product-grid.html",
+		"templates/product/author.html",
+	))
+
+	d := struct {
+		Author   models.Author
+		Products []models.Product
+	}{
+		Author:   author,
+		Products: products,
+	}
+
+	if err := tmpl.Execute(w, d); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"html/template"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/nathanialw/ecommerce/internal/db"
 	"github.com/nathanialw/ecommerce/internal/services"
@@ -53,8 +54,7 @@ func AddToCartHandler(w http.ResponseWriter, r *http.Request) {
 
 func CartHandler(w http.ResponseWriter, r *http.Request) {
 
-	products, total := services.GetCartItems(r)
-	subtotal, tax := services.CalcTax(total)
+	data := services.CheckoutHandler(w, r)
 
 	tmpl := template.Must(template.ParseFiles(
 		"templates/layout.html",
@@ -63,18 +63,57 @@ func CartHandler(w http.ResponseWriter, r *http.Request) {
 		"templates/product/cart.html",
 	))
 
-	data := models.Cart{
-		Products: products,
-		Subtotal: subtotal,
-		Tax:      tax,
-		Total:    total,
-	}
-
 	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
 	}
 }
 
+func ApplyPromoHandler(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimSpace(r.FormValue("code"))
+	if code == "" {
+		http.Error(w, "Promotion code is required", http.StatusBadRequest)
+		return
+	}
+
+	// Invalid codes are kept so the cart page can explain why they don't apply
+	session, _ := db.Store.Get(r, "session")
+	session.Values["promo"] = code
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+func RemovePromoHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := db.Store.Get(r, "session")
+	delete(session.Values, "promo")
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+func ApplyGiftCardHandler(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.TrimSpace(r.FormValue("code")))
+	if code == "" {
+		http.Error(w, "Gift card code is required", http.StatusBadRequest)
+		return
+	}
+
+	// Like promotions, bad codes are kept so the cart page can say what's wrong
+	session, _ := db.Store.Get(r, "session")
+	session.Values["gift_card"] = code
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+func RemoveGiftCardHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := db.Store.Get(r, "session")
+	delete(session.Values, "gift_card")
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
 func IncrementItemHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.FormValue("increment")
 	id, err := strconv.Atoi(idStr)
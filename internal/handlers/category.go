@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const browsePageSize = 24
+
+// pageFromRequest reads the page query parameter, defaulting to the first page.
+func pageFromRequest(r *http.Request, size int) models.Pagination {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return models.Pagination{Page: page, PageSize: size}
+}
+
+func CategoryHandler(w http.ResponseWriter, r *http.Request) {
+	category, err := db.GetCategoryBySlug(mux.Vars(r)["slug"])
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	page := pageFromRequest(r, browsePageSize)
+	products, err := db.GetProductsInCategory(category.ID, &page)
+	if err != nil {
+		http.Error(w, "Failed to load products", http.StatusInternalServerError)
+		return
+	}
+
+	if err := services.ApplyCurrencyToProducts(products, services.GetCurrency(r)); err != nil {
+		http.Error(w, "Failed to price products", http.StatusInternalServerError)
+		return
+	}
+
+	// Subcategories come from the cached tree so the page can link to them
+	categories := cache.GetCategories()
+	for _, c := range services.CategoryTree(categories) {
+		if sub, ok := findCategory(c, category.ID); ok {
+			category.Children = sub.Children
+			break
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/partials/header.html",
+		"templates/partials/search.html",
+		"templates/partials/footer.html",
+		"templates/product/product-grid.html",
+		"templates/product/category.html",
+	))
+
+	d := struct {
+		Category    models.Category
+		Breadcrumbs []models.Category
+		Products    []models.Product
+		Page        models.Pagination
+	}{
+		Category:    category,
+		Breadcrumbs: services.Breadcrumbs(categories, category.ID),
+		Products:    products,
+		Page:        page,
+	}
+
+	if err := tmpl.Execute(w, d); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
+
+func findCategory(c models.Category, id int) (models.Category, bool) {
+	if c.ID == id {
+		return c, true
+	}
+	for _, child := range c.Children {
+		if found, ok := findCategory(child, id); ok {
+			return found, true
+		}
+	}
+	return models.Category{}, false
+}
+
+func TagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := db.GetTagBySlug(mux.Vars(r)["slug"])
+	if err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	page := pageFromRequest(r, browsePageSize)
+	products, err := db.GetProductsByTag(tag.ID, &page)
+	if err != nil {
+		http.Error(w, "Failed to load products", http.StatusInternalServerError)
+		return
+	}
+
+	if err := services.ApplyCurrencyToProducts(products, services.GetCurrency(r)); err != nil {
+		http.Error(w, "Failed to price products", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/partials/header.html",
+		"templates/partials/search.html",
+		"templates/partials/footer.html",
+		"templates/product/product-grid.html",
+		"templates/product/tag.html",
+	))
+
+	d := struct {
+		Tag      models.Tag
+		Products []models.Product
+		Page     models.Pagination
+	}{
+		Tag:      tag,
+		Products: products,
+		Page:     page,
+	}
+
+	if err := tmpl.Execute(w, d); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
+
+func AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := db.GetAllCategories()
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/categories.html",
+	))
+
+	d := struct {
+		LoggedIn   bool
+		Tree       []models.Category
+		Categories []models.Category
+	}{
+		LoggedIn:   true,
+		Tree:       services.CategoryTree(categories),
+		Categories: categories,
+	}
+	tmpl.Execute(w, d)
+}
+
+// categoryFromForm reads the fields shared by the add and edit category forms.
+func categoryFromForm(r *http.Request) (models.Category, bool) {
+	c := models.Category{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Slug:        strings.ToLower(strings.TrimSpace(r.FormValue("slug"))),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+	if c.Name == "" {
+		return c, false
+	}
+	if v := r.FormValue("parent_id"); v != "" {
+		parentID, err := strconv.Atoi(v)
+		if err != nil {
+			return c, false
+		}
+		c.Parent_ID = &parentID
+	}
+	if v := r.FormValue("position"); v != "" {
+		position, err := strconv.Atoi(v)
+		if err != nil {
+			return c, false
+		}
+		c.Position = position
+	}
+	return c, true
+}
+
+func AddCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := categoryFromForm(r)
+	if !ok {
+		http.Error(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.InsertCategory(c); err != nil {
+		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Created category %s", c.Name)
+	cache.UpdateCache()
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+func UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "update":
+		c, ok := categoryFromForm(r)
+		if !ok {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			return
+		}
+		c.ID = categoryID
+		err = db.UpdateCategory(c)
+	case "delete":
+		err = db.DeleteCategory(categoryID)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cache.UpdateCache()
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+func AdminTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := db.GetAllTags()
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/tags.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Tags     []models.Tag
+	}{
+		LoggedIn: true,
+		Tags:     tags,
+	}
+	tmpl.Execute(w, d)
+}
+
+func DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteTag(tagID); err != nil {
+		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func SetCurrencyHandler(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(r.FormValue("currency"))
+	if !services.IsSupportedCurrency(currency) {
+		http.Error(w, "Unsupported currency", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := db.Store.Get(r, "session")
+	session.Values["currency"] = currency
+	session.Save(r, w)
+
+	http.Redirect(w, r, localPath(r.Referer()), http.StatusSeeOther)
+}
+
+// localPath keeps only the path and query of ref, so a redirect to it stays
+// on this site. Anything that isn't a plain local path becomes "/".
+func localPath(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil || !strings.HasPrefix(u.Path, "/") ||
+		strings.HasPrefix(u.Path, "//") || strings.HasPrefix(u.Path, "/\\") {
+		return "/"
+	}
+	local := url.URL{Path: u.Path, RawQuery: u.RawQuery}
+	return local.String()
+}
+
+func AdminExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := db.GetAllExchangeRates()
+	if err != nil {
+		http.Error(w, "Failed to fetch exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/exchange-rates.html",
+	))
+
+	d := struct {
+		LoggedIn     bool
+		BaseCurrency string
+		Rates        []models.ExchangeRate
+	}{
+		LoggedIn:     true,
+		BaseCurrency: services.BaseCurrency,
+		Rates:        rates,
+	}
+	tmpl.Execute(w, d)
+}
+
+func UpdateExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(r.FormValue("currency"))
+	if !services.IsSupportedCurrency(currency) || currency == services.BaseCurrency {
+		http.Error(w, "Unsupported currency", http.StatusBadRequest)
+		return
+	}
+
+	rate, err := strconv.ParseFloat(r.FormValue("rate"), 64)
+	if err != nil || rate <= 0 {
+		http.Error(w, "Invalid rate", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.UpsertExchangeRate(currency, rate, r.FormValue("charm_pricing") == "on"); err != nil {
+		http.Error(w, "Failed to update exchange rate", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
 )
 
 func SearchOrdersHandler(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +35,8 @@ func SearchOrdersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	services.SetTrackingURLs(&results)
+
 	tmpl := template.Must(template.ParseFiles(
 		"templates/layout.html",
 		"templates/partials/header.html",
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func AdminGiftCardsHandler(w http.ResponseWriter, r *http.Request) {
+	cards, err := db.GetAllGiftCards()
+	if err != nil {
+		http.Error(w, "Failed to fetch gift cards", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/gift-cards.html",
+	))
+
+	d := struct {
+		LoggedIn   bool
+		GiftCards  []models.GiftCard
+		Currencies []string
+	}{
+		LoggedIn:   true,
+		GiftCards:  cards,
+		Currencies: services.SupportedCurrencies,
+	}
+	tmpl.Execute(w, d)
+}
+
+func AdminGiftCardHandler(w http.ResponseWriter, r *http.Request) {
+	giftCardID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	card, err := db.GetGiftCardByID(giftCardID)
+	if err != nil {
+		http.Error(w, "Gift card not found", http.StatusNotFound)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/gift-card.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		GiftCard models.GiftCard
+	}{
+		LoggedIn: true,
+		GiftCard: card,
+	}
+	tmpl.Execute(w, d)
+}
+
+func IssueGiftCardHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil || amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	currency := strings.ToUpper(r.FormValue("currency"))
+	if currency == "" {
+		currency = services.BaseCurrency
+	}
+	if !slices.Contains(services.SupportedCurrencies, currency) {
+		http.Error(w, "Unsupported currency", http.StatusBadRequest)
+		return
+	}
+
+	card, err := services.IssueGiftCard(int64(math.Round(amount*100)), currency, r.FormValue("email"), r.FormValue("note"), nil)
+	if card.ID == 0 {
+		http.Error(w, "Failed to issue gift card", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Println("Gift card error:", err)
+	}
+
+	log.Printf("Issued gift card %d", card.ID)
+	http.Redirect(w, r, "/admin/gift-card/"+strconv.Itoa(card.ID), http.StatusSeeOther)
+}
+
+func VoidGiftCardHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	giftCardID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.VoidGiftCard(giftCardID, r.FormValue("note")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/gift-card/"+idStr, http.StatusSeeOther)
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
 func loggedIn(r *http.Request) bool {
@@ -26,15 +28,17 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		"templates/home.html",
 	))
 
-	authors := cache.GetCache() // This should return []string or []Author
+	authors := cache.GetCache()
 	loggedIn := loggedIn(r)
 
 	data := struct {
-		Authors  []string
-		LoggedIn bool
+		Authors    []models.Author
+		Categories []models.Category
+		LoggedIn   bool
 	}{
-		Authors:  authors,
-		LoggedIn: loggedIn,
+		Authors:    authors,
+		Categories: services.CategoryTree(cache.GetCategories()),
+		LoggedIn:   loggedIn,
 	}
 
 	tmpl.Execute(w, data)
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/admin"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/images"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// imageVariant reads the variant an image is for, checking it belongs to the
+// product. An empty value means the image is shown for every variant.
+func imageVariant(r *http.Request, productID int) (*int, error) {
+	v := r.FormValue("variant_id")
+	if v == "" {
+		return nil, nil
+	}
+	variantID, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid variant")
+	}
+	variant, err := db.GetVariantByID(variantID)
+	if err != nil || variant.Product_ID != productID {
+		return nil, fmt.Errorf("variant %d is not part of this product", variantID)
+	}
+	return &variantID, nil
+}
+
+// AddProductImagesHandler adds the uploaded images to the end of the
+// product's gallery.
+func AddProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	variantID, err := imageVariant(r, productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		http.Error(w, "Choose at least one image", http.StatusBadRequest)
+		return
+	}
+
+	for _, fh := range files {
+		imagePath, err := admin.SaveImage(fh)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", fh.Filename, err), http.StatusBadRequest)
+			return
+		}
+		_, err = db.InsertProductImage(models.ProductImage{
+			Product_ID: productID,
+			Variant_ID: variantID,
+			ImagePath:  imagePath,
+			AltText:    strings.TrimSpace(r.FormValue("alt_text")),
+		})
+		if err != nil {
+			http.Error(w, "Failed to save image", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/edit-product/%d", productID), http.StatusSeeOther)
+}
+
+// ReorderProductImagesHandler saves the gallery order after the images are
+// dragged into place, from image_id values in their new order.
+func ReorderProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	r.ParseForm()
+
+	var ids []int
+	for _, v := range r.Form["image_id"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid image ID", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if err := db.ReorderProductImages(productID, ids); err != nil {
+		http.Error(w, "Failed to reorder images", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ProductImageHandler updates, promotes to primary or deletes one image.
+func ProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return
+	}
+	img, err := db.GetProductImageByID(imageID)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "update":
+		img.Variant_ID, err = imageVariant(r, img.Product_ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		img.AltText = strings.TrimSpace(r.FormValue("alt_text"))
+		err = db.UpdateProductImage(img)
+	case "primary":
+		err = db.SetPrimaryImage(img.Product_ID, img.ID)
+	case "delete":
+		var imagePath string
+		imagePath, err = db.DeleteProductImage(img.ID)
+		if err == nil {
+			images.RemoveUnused(imagePath)
+		}
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Failed to update image", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/edit-product/%d", img.Product_ID), http.StatusSeeOther)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/catalog"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const (
+	maxImportSize  = 50 << 20
+	importPageSize = 100
+)
+
+// AdminImportsHandler shows the import form and the latest imports.
+func AdminImportsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, err := db.GetRecentImportJobs(20)
+	if err != nil {
+		http.Error(w, "Failed to fetch imports", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/imports.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Jobs     []models.ImportJob
+		Columns  []string
+	}{
+		LoggedIn: true,
+		Jobs:     jobs,
+		Columns:  catalog.Columns(),
+	}
+	tmpl.Execute(w, d)
+}
+
+// StartImportHandler queues an uploaded CSV or ONIX file for import and
+// sends the admin to its progress page. The format comes from the form, or
+// failing that the file extension.
+func StartImportHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "The file is too large or the form is invalid", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Choose a file to import", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format := r.FormValue("format")
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".csv":
+			format = models.ImportCSV
+		case ".xml", ".onix":
+			format = models.ImportONIX
+		}
+	}
+	if !slices.Contains([]string{models.ImportCSV, models.ImportONIX}, format) {
+		http.Error(w, "Choose CSV or ONIX", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+
+	id, err := catalog.Queue(models.ImportJob{
+		Format:   format,
+		Filename: header.Filename,
+		Data:     data,
+		DryRun:   r.FormValue("dry_run") != "",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/imports/%d", id), http.StatusSeeOther)
+}
+
+// ImportJobHandler shows an import's progress and a page of its row
+// outcomes, only those with ?action= when given.
+func ImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := importJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	page := pageFromRequest(r, importPageSize)
+	rows, err := db.GetImportRows(job.ID, action, &page)
+	if err != nil {
+		http.Error(w, "Failed to fetch import rows", http.StatusInternalServerError)
+		return
+	}
+	job.Rows = rows
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/import.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Job      models.ImportJob
+		Action   string
+		Page     models.Pagination
+	}{
+		LoggedIn: true,
+		Job:      job,
+		Action:   action,
+		Page:     page,
+	}
+	tmpl.Execute(w, d)
+}
+
+// ImportStatusHandler returns an import's progress as JSON, for the progress
+// page to poll.
+func ImportStatusHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := importJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status    string `json:"status"`
+		Total     int    `json:"total"`
+		Processed int    `json:"processed"`
+		Percent   int    `json:"percent"`
+		Created   int    `json:"created"`
+		Updated   int    `json:"updated"`
+		Failed    int    `json:"failed"`
+		Error     string `json:"error,omitempty"`
+	}{job.Status, job.Total, job.Processed, job.Percent(), job.Created, job.Updated, job.Failed, job.Error})
+}
+
+// ApplyImportHandler runs a finished dry run's file for real.
+func ApplyImportHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := importJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !job.DryRun || job.Status != models.JobDone {
+		http.Error(w, "Only a finished dry run can be applied", http.StatusBadRequest)
+		return
+	}
+
+	data, err := db.GetImportJobData(job.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch import file", http.StatusInternalServerError)
+		return
+	}
+	id, err := catalog.Queue(models.ImportJob{
+		Format:   job.Format,
+		Filename: job.Filename,
+		Data:     data,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/imports/%d", id), http.StatusSeeOther)
+}
+
+// ExportCatalogHandler downloads the whole catalog as CSV, one row per
+// variant, in the format the import reads.
+func ExportCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	products, err := db.GetCatalogExport()
+	if err != nil {
+		http.Error(w, "Failed to export catalog", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="catalog-%s.csv"`, time.Now().Format("2006-01-02")))
+	catalog.WriteCSV(w, products)
+}
+
+func importJobFromRequest(w http.ResponseWriter, r *http.Request) (models.ImportJob, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid import ID", http.StatusBadRequest)
+		return models.ImportJob{}, false
+	}
+	job, err := db.GetImportJob(id)
+	if err != nil {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return models.ImportJob{}, false
+	}
+	return job, true
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/barcode"
+	"github.com/nathanialw/ecommerce/pkg/isbn"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const (
+	stockPageSize = 50
+	// reorderDays is the default window sales velocity is measured over
+	reorderDays = 30
+)
+
+// AdminLocationsHandler lists the stock locations with a form to add one.
+func AdminLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	locations, err := db.GetLocations()
+	if err != nil {
+		http.Error(w, "Failed to fetch locations", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/locations.html",
+	))
+
+	d := struct {
+		LoggedIn  bool
+		Locations []models.Location
+		Kinds     []string
+	}{
+		LoggedIn:  true,
+		Locations: locations,
+		Kinds:     models.LocationKinds,
+	}
+	tmpl.Execute(w, d)
+}
+
+func AddLocationHandler(w http.ResponseWriter, r *http.Request) {
+	l, ok := locationFromForm(w, r)
+	if !ok {
+		return
+	}
+	if err := db.InsertLocation(l); err != nil {
+		http.Error(w, "Failed to add location; the name may already be in use", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin/locations", http.StatusSeeOther)
+}
+
+func UpdateLocationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid location ID", http.StatusBadRequest)
+		return
+	}
+	l, ok := locationFromForm(w, r)
+	if !ok {
+		return
+	}
+	l.ID = id
+	if err := db.UpdateLocation(l); err != nil {
+		http.Error(w, "Failed to update location", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/locations", http.StatusSeeOther)
+}
+
+func locationFromForm(w http.ResponseWriter, r *http.Request) (models.Location, bool) {
+	l := models.Location{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Kind:     r.FormValue("kind"),
+		Sellable: r.FormValue("sellable") != "",
+	}
+	if l.Name == "" || !slices.Contains(models.LocationKinds, l.Kind) {
+		http.Error(w, "Enter a name and choose a kind", http.StatusBadRequest)
+		return l, false
+	}
+	return l, true
+}
+
+// VariantStockHandler shows a variant's stock at each location and a page of
+// its stock ledger, with forms to receive, count and transfer stock.
+func VariantStockHandler(w http.ResponseWriter, r *http.Request) {
+	variant, ok := variantFromRequest(w, r)
+	if !ok {
+		return
+	}
+	product, err := db.GetProductByID(variant.Product_ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		return
+	}
+	variant.Levels, err = db.GetStockLevels(variant.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock levels", http.StatusInternalServerError)
+		return
+	}
+	page := pageFromRequest(r, stockPageSize)
+	movements, err := db.GetStockMovements(variant.ID, &page)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/stock.html",
+	))
+
+	d := struct {
+		LoggedIn  bool
+		Product   *models.Product
+		Variant   models.Variant
+		Movements []models.StockMovement
+		Page      models.Pagination
+	}{
+		LoggedIn:  true,
+		Product:   product,
+		Variant:   variant,
+		Movements: movements,
+		Page:      page,
+	}
+	tmpl.Execute(w, d)
+}
+
+// StockMovementHandler receives stock at a location, records a count of
+// one, or transfers stock between two, as the action field says.
+func StockMovementHandler(w http.ResponseWriter, r *http.Request) {
+	variant, ok := variantFromRequest(w, r)
+	if !ok {
+		return
+	}
+	location, err := strconv.Atoi(r.FormValue("location_id"))
+	if err != nil {
+		http.Error(w, "Choose a location", http.StatusBadRequest)
+		return
+	}
+	quantity, err := strconv.Atoi(strings.TrimSpace(r.FormValue("quantity")))
+	if err != nil || quantity < 0 {
+		http.Error(w, "Enter a quantity", http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(r.FormValue("note"))
+
+	switch r.FormValue("action") {
+	case "receive":
+		err = db.ReceiveStock(variant.ID, location, quantity, note)
+	case "count":
+		err = db.CountStock(variant.ID, location, quantity, note)
+	case "transfer":
+		var to int
+		if to, err = strconv.Atoi(r.FormValue("to_location_id")); err != nil {
+			http.Error(w, "Choose a location to transfer to", http.StatusBadRequest)
+			return
+		}
+		err = db.TransferStock(variant.ID, location, to, quantity, note)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Failed to record stock: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	services.CheckStockSoon()
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock/%d", variant.ID), http.StatusSeeOther)
+}
+
+// ReorderThresholdHandler sets the stock below which a variant is reordered.
+func ReorderThresholdHandler(w http.ResponseWriter, r *http.Request) {
+	variant, ok := variantFromRequest(w, r)
+	if !ok {
+		return
+	}
+	threshold, err := strconv.Atoi(strings.TrimSpace(r.FormValue("reorder_threshold")))
+	if err != nil || threshold < 0 {
+		http.Error(w, "Enter a reorder threshold, or 0 to never reorder", http.StatusBadRequest)
+		return
+	}
+	if err := db.SetReorderThreshold(variant.ID, threshold); err != nil {
+		http.Error(w, "Failed to set reorder threshold", http.StatusInternalServerError)
+		return
+	}
+	services.CheckStockSoon()
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock/%d", variant.ID), http.StatusSeeOther)
+}
+
+// ReorderReportHandler lists the variants below their reorder threshold,
+// fastest selling over the last ?days= (30 by default) first.
+func ReorderReportHandler(w http.ResponseWriter, r *http.Request) {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = reorderDays
+	}
+	items, err := db.GetReorderReport(days)
+	if err != nil {
+		http.Error(w, "Failed to fetch reorder report", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/reorder.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Items    []models.ReorderItem
+		Days     int
+	}{
+		LoggedIn: true,
+		Items:    items,
+		Days:     days,
+	}
+	tmpl.Execute(w, d)
+}
+
+// StockLookupHandler finds a variant by a scanned barcode, ISBN or SKU and
+// opens its stock page.
+func StockLookupHandler(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	if code == "" {
+		http.Error(w, "Enter a barcode, ISBN or SKU", http.StatusBadRequest)
+		return
+	}
+	ean, _ := barcode.Normalize(code)
+	number, _ := isbn.Normalize(code)
+
+	variants, err := db.FindVariants(number, code, ean)
+	if err != nil {
+		http.Error(w, "Failed to look up code", http.StatusInternalServerError)
+		return
+	}
+	if len(variants) == 0 {
+		http.Error(w, "Nothing has the code "+code, http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock/%d", variants[0].ID), http.StatusSeeOther)
+}
+
+// StockAuditHandler lists variants whose stock doesn't match their ledger.
+func StockAuditHandler(w http.ResponseWriter, r *http.Request) {
+	discrepancies, err := db.GetStockDiscrepancies()
+	if err != nil {
+		http.Error(w, "Failed to audit stock", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/stock-audit.html",
+	))
+
+	d := struct {
+		LoggedIn      bool
+		Discrepancies []models.StockDiscrepancy
+	}{
+		LoggedIn:      true,
+		Discrepancies: discrepancies,
+	}
+	tmpl.Execute(w, d)
+}
+
+func variantFromRequest(w http.ResponseWriter, r *http.Request) (models.Variant, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return models.Variant{}, false
+	}
+	variant, err := db.GetVariantByID(id)
+	if err != nil {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return models.Variant{}, false
+	}
+	return variant, true
+}
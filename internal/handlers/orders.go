@@ -2,7 +2,16 @@ package handlers
 
 import (
 	"html/template"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
 func OrdersHandler(w http.ResponseWriter, r *http.Request) {
@@ -20,3 +29,213 @@ func OrdersHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
 	}
 }
+
+func AdminOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	orders, err := db.GetOrdersByStatus(status)
+	if err != nil {
+		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/orders.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Status   string
+		Orders   []models.Order
+	}{
+		LoggedIn: true,
+		Status:   status,
+		Orders:   orders,
+	}
+	tmpl.Execute(w, d)
+}
+
+func AdminOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/order.html",
+	))
+
+	services.SetTrackingURLs(&order)
+
+	d := struct {
+		LoggedIn bool
+		Order    models.Order
+		Totals   services.OrderTotals
+		Carriers map[string]string
+	}{
+		LoggedIn: true,
+		Order:    order,
+		Totals:   services.CalcOrderTotals(order),
+		Carriers: services.Carriers,
+	}
+	tmpl.Execute(w, d)
+}
+
+func InvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="invoice-`+order.OrderNumber+`.pdf"`)
+	if err := services.WriteInvoice(w, order); err != nil {
+		log.Println("Invoice error:", err)
+		http.Error(w, "Failed to generate invoice", http.StatusInternalServerError)
+	}
+}
+
+func PackingSlipHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="packing-slip-`+order.OrderNumber+`.pdf"`)
+	if err := services.WritePackingSlips(w, []models.Order{order}); err != nil {
+		log.Println("Packing slip error:", err)
+		http.Error(w, "Failed to generate packing slip", http.StatusInternalServerError)
+	}
+}
+
+// BatchPackingSlipsHandler prints a packing slip for every order that has
+// been paid for and still has items left to ship.
+func BatchPackingSlipsHandler(w http.ResponseWriter, r *http.Request) {
+	var orders []models.Order
+	for _, status := range []string{models.OrderStatusPaid, models.OrderStatusPartiallyShipped} {
+		found, err := db.GetOrdersByStatus(status)
+		if err != nil {
+			http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+			return
+		}
+		orders = append(orders, found...)
+	}
+	// Oldest orders are packed first
+	slices.SortFunc(orders, func(a, b models.Order) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="packing-slips.pdf"`)
+	if err := services.WritePackingSlips(w, orders); err != nil {
+		log.Println("Packing slip error:", err)
+		http.Error(w, "Failed to generate packing slips", http.StatusInternalServerError)
+	}
+}
+
+func CreateShipmentHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	carrier := r.FormValue("carrier")
+	if carrier == "" {
+		http.Error(w, "Carrier is required", http.StatusBadRequest)
+		return
+	}
+
+	// Leaving every quantity blank ships whatever is left on the order; any
+	// quantity entered means only what was entered ships
+	itemIDs := r.Form["order_item_id"]
+	quantities := r.Form["ship_quantity"]
+	if len(itemIDs) != len(quantities) {
+		http.Error(w, "Shipment item fields mismatch", http.StatusBadRequest)
+		return
+	}
+	items := make(map[int]int)
+	entered := false
+	for i := range itemIDs {
+		if strings.TrimSpace(quantities[i]) == "" {
+			continue
+		}
+		entered = true
+		itemID, err := strconv.Atoi(itemIDs[i])
+		if err != nil {
+			http.Error(w, "Invalid order item ID", http.StatusBadRequest)
+			return
+		}
+		quantity, err := strconv.Atoi(strings.TrimSpace(quantities[i]))
+		if err != nil || quantity < 0 {
+			http.Error(w, "Invalid quantity", http.StatusBadRequest)
+			return
+		}
+		if quantity > 0 {
+			items[itemID] = quantity
+		}
+	}
+	if entered && len(items) == 0 {
+		http.Error(w, "Every quantity is zero; enter what to ship, or leave them all blank to ship everything left", http.StatusBadRequest)
+		return
+	}
+
+	shipment, err := services.CreateShipment(orderID, carrier, r.FormValue("tracking_number"), items)
+	if err != nil {
+		log.Println("Shipment error:", err)
+		// A failed notification still leaves the shipment recorded
+		if shipment.ID == 0 {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin/order/"+strconv.Itoa(orderID), http.StatusSeeOther)
+}
+
+func MarkDeliveredHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if order.Status != models.OrderStatusShipped {
+		http.Error(w, "Only shipped orders can be marked delivered", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.UpdateOrderStatus(order.ID, models.OrderStatusDelivered); err != nil {
+		http.Error(w, "Failed to update order", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/order/"+strconv.Itoa(order.ID), http.StatusSeeOther)
+}
+
+func orderFromPath(w http.ResponseWriter, r *http.Request) (models.Order, bool) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return models.Order{}, false
+	}
+
+	order, err := db.GetOrderByID(orderID)
+	if err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return models.Order{}, false
+	}
+	return order, true
+}
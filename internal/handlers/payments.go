@@ -2,18 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/nathanialw/ecommerce/internal/db"
 	"github.com/nathanialw/ecommerce/internal/services"
 	"github.com/nathanialw/ecommerce/pkg/models"
 	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/checkout/session"
 	sessionpkg "github.com/stripe/stripe-go/v82/checkout/session"
+	"github.com/stripe/stripe-go/v82/coupon"
 	"github.com/stripe/stripe-go/v82/webhook"
 )
 
@@ -50,7 +54,7 @@ func CreateCheckoutSession(w http.ResponseWriter, r *http.Request) {
 		Quantity: stripe.Int64(quantity),
 	})
 
-	params := params(lineItems, returnURL)
+	params := params(lineItems, returnURL, services.BaseCurrency, services.StandardShippingCents)
 
 	s, err := session.New(params)
 	if err != nil {
@@ -67,22 +71,35 @@ func CreateCartCheckoutSession(w http.ResponseWriter, r *http.Request) {
 	//TODO: set the Key as an env variable on the server
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
+	shippingCents, err := services.ConvertCents(services.StandardShippingCents, cartItems.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	var lineItems []*stripe.CheckoutSessionLineItemParams
 
 	for _, item := range cartItems.Products {
 		amount := int64(item.Variant.Cents) // Stripe expects amount in cents
-		// TODO: needs the web address of the image asset
-		imgPath := "https://nathanial.ca/assets/images/default.png" // + item.Variant.ImagePath
+		imgPath := "https://nathanial.ca/assets/images/default.png"
+		if url := item.Variant.ImageURL(models.ImageDetail); url != "" {
+			// Stripe fetches the image itself, so it needs the full address
+			if strings.HasPrefix(url, "/") {
+				url = services.Store.URL + url
+			}
+			imgPath = url
+		}
 
 		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
 			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String("CAD"),
+				Currency: stripe.String(cartItems.Currency),
 				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
 					Name:        stripe.String(item.Name),
 					Images:      stripe.StringSlice([]string{imgPath}),
-					Description: stripe.String(fmt.Sprintf("Variant: %s", item.Variant.Color)),
+					Description: stripe.String(fmt.Sprintf("Format: %s", item.Variant.Format)),
 					Metadata: map[string]string{
 						"variant_id": fmt.Sprintf("%d", item.Variant.ID),
+						"format":     item.Variant.Format,
 					},
 				},
 				UnitAmount: stripe.Int64(amount),
@@ -91,10 +108,74 @@ func CreateCartCheckoutSession(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	params := params(lineItems, "http://127.0.0.1:6600/cart")
+	// GST is added on top of the prices, so it goes to Stripe as its own line
+	if cartItems.TaxCents > 0 {
+		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency: stripe.String(cartItems.Currency),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name:     stripe.String(fmt.Sprintf("GST (%g%%)", services.GSTRate*100)),
+					Metadata: map[string]string{"tax": "gst"},
+				},
+				UnitAmount: stripe.Int64(cartItems.TaxCents),
+			},
+			Quantity: stripe.Int64(1),
+		})
+	}
+
+	params := params(lineItems, "http://127.0.0.1:6600/cart", cartItems.Currency, shippingCents)
+
+	// Reserve a use of the promotion code, so checkouts running at the same
+	// time can't go past its usage limit
+	var promotionHold string
+	if cartItems.PromoCode != "" && cartItems.PromoError == "" {
+		promotionHold, err = services.HoldPromotion(cartItems)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		params.AddMetadata("promotion_hold", promotionHold)
+	}
+
+	// Reserve the gift card balance until Stripe tells us how checkout went
+	var hold string
+	if cartItems.GiftCardCents > 0 && cartItems.GiftCardError == "" {
+		hold, err = services.HoldGiftCard(cartItems)
+		if err != nil {
+			if promotionHold != "" {
+				db.ReleasePromotionHold(promotionHold)
+			}
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		params.AddMetadata("gift_card_hold", hold)
+	}
+
+	// Nothing was charged if the coupon or the session can't be created,
+	// so both holds go back
+	releaseHolds := func() {
+		if promotionHold != "" {
+			db.ReleasePromotionHold(promotionHold)
+		}
+		if hold != "" {
+			db.ReleaseGiftCardHold(hold)
+		}
+	}
+
+	// The coupon is only created once the holds are in place, so a code or
+	// card that's already used up doesn't leave a coupon behind
+	if err := applyPromotion(params, cartItems); err != nil {
+		releaseHolds()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Lets the search report tell which searches ended in a purchase
+	params.AddMetadata("visitor_id", services.VisitorID(w, r))
 
 	s, err := session.New(params)
 	if err != nil {
+		releaseHolds()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -102,7 +183,7 @@ func CreateCartCheckoutSession(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, s.URL, http.StatusSeeOther)
 }
 
-func params(lineItems []*stripe.CheckoutSessionLineItemParams, cancelURL string) *stripe.CheckoutSessionParams {
+func params(lineItems []*stripe.CheckoutSessionLineItemParams, cancelURL, currency string, shippingCents int64) *stripe.CheckoutSessionParams {
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
 	params := &stripe.CheckoutSessionParams{
@@ -115,14 +196,17 @@ func params(lineItems []*stripe.CheckoutSessionLineItemParams, cancelURL string)
 					DisplayName: stripe.String("Standard Shipping"),
 					Type:        stripe.String("fixed_amount"),
 					FixedAmount: &stripe.CheckoutSessionShippingOptionShippingRateDataFixedAmountParams{
-						Amount:   stripe.Int64(1500), // in cents
-						Currency: stripe.String("cad"),
+						Amount:   stripe.Int64(shippingCents), // in cents
+						Currency: stripe.String(strings.ToLower(currency)),
 					},
 				},
 			},
 		},
 
-		AllowPromotionCodes: stripe.Bool(true),
+		BillingAddressCollection: stripe.String(string(stripe.CheckoutSessionBillingAddressCollectionRequired)),
+		PhoneNumberCollection: &stripe.CheckoutSessionPhoneNumberCollectionParams{
+			Enabled: stripe.Bool(true),
+		},
 
 		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
 		LineItems:          lineItems,
@@ -136,6 +220,55 @@ func params(lineItems []*stripe.CheckoutSessionLineItemParams, cancelURL string)
 	return params
 }
 
+// applyPromotion carries a discount from our own promotions, plus any gift
+// card the customer is paying with, over to Stripe as a single-use coupon, and
+// drops the shipping charge for free shipping codes. Stripe only takes one
+// coupon per checkout, so both amounts share it.
+func applyPromotion(params *stripe.CheckoutSessionParams, cart models.Cart) error {
+	var names []string
+	var amountOff int64
+
+	if cart.PromoCode != "" && cart.PromoError == "" {
+		params.AddMetadata("promo_code", cart.PromoCode)
+
+		if cart.FreeShipping {
+			rate := params.ShippingOptions[0].ShippingRateData
+			rate.DisplayName = stripe.String("Free Shipping")
+			rate.FixedAmount.Amount = stripe.Int64(0)
+		}
+		if cart.DiscountCents > 0 {
+			names = append(names, cart.PromoCode)
+			amountOff += cart.DiscountCents
+		}
+	}
+
+	if cart.GiftCardCents > 0 && cart.GiftCardError == "" {
+		if cart.GiftCardCents > services.GiftCardLimit(cart) {
+			return fmt.Errorf("gift card of %d cents is more than the %d cents it can pay", cart.GiftCardCents, services.GiftCardLimit(cart))
+		}
+		params.AddMetadata("gift_card_cents", strconv.FormatInt(cart.GiftCardCents, 10))
+		names = append(names, "Gift card")
+		amountOff += cart.GiftCardCents
+	}
+
+	if amountOff > 0 {
+		c, err := coupon.New(&stripe.CouponParams{
+			Name:           stripe.String(strings.Join(names, " + ")),
+			AmountOff:      stripe.Int64(amountOff),
+			Currency:       stripe.String(strings.ToLower(cart.Currency)),
+			Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+			MaxRedemptions: stripe.Int64(1),
+		})
+		if err != nil {
+			return err
+		}
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{
+			{Coupon: stripe.String(c.ID)},
+		}
+	}
+	return nil
+}
+
 // Runs after the order completes
 func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("🔔 Webhook received")
@@ -158,6 +291,28 @@ func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Println("Event Type:", event.Type)
 
+	// Give back the promotion use and gift card balance held for a checkout
+	// that was never paid
+	if event.Type == "checkout.session.expired" {
+		var expired stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &expired); err != nil {
+			http.Error(w, "Failed to parse webhook", http.StatusBadRequest)
+			return
+		}
+		if hold := expired.Metadata["promotion_hold"]; hold != "" {
+			if err := db.ReleasePromotionHold(hold); err != nil {
+				http.Error(w, "failed to release promotion", http.StatusInternalServerError)
+				return
+			}
+		}
+		if hold := expired.Metadata["gift_card_hold"]; hold != "" {
+			if err := db.ReleaseGiftCardHold(hold); err != nil {
+				http.Error(w, "failed to release gift card", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
 	if event.Type == "checkout.session.completed" {
 		var checkoutSession stripe.CheckoutSession
 		err := json.Unmarshal(event.Data.Raw, &checkoutSession)
@@ -166,20 +321,21 @@ func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var address *stripe.Address
-
-		if checkoutSession.CollectedInformation.ShippingDetails != nil {
-			address = checkoutSession.CollectedInformation.ShippingDetails.Address
-			name := checkoutSession.CollectedInformation.ShippingDetails.Name
+		customer := checkoutSession.CustomerDetails
+		order := models.Order{
+			Email:          customer.Email,
+			Phone:          customer.Phone,
+			BillingAddress: addressFromStripe(customer.Name, customer.Phone, customer.Address),
+		}
 
-			fmt.Println("📦 Shipping to:", name)
-			fmt.Println("📍 Address:", address.Line1, address.City, address.PostalCode, address.Country)
+		if checkoutSession.CollectedInformation != nil && checkoutSession.CollectedInformation.ShippingDetails != nil {
+			shipping := checkoutSession.CollectedInformation.ShippingDetails
+			order.ShippingAddress = addressFromStripe(shipping.Name, customer.Phone, shipping.Address)
 
-			// Use this info to store in your DB:
-			services.SaveShippingAddress(name, address.Line1, address.City, address.PostalCode, address.Country)
+			fmt.Println("📦 Shipping to:", shipping.Name)
 		}
 
-		email := checkoutSession.CustomerDetails.Email
+		email := customer.Email
 		fmt.Println("📧 Email:", email)
 
 		// Now fetch the full session and expand line_items
@@ -210,26 +366,74 @@ func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var items []models.OrderItem
+		var taxCents int64
 		for _, li := range fullSess.LineItems.Data {
+			if li.Price.Product.Metadata["tax"] != "" {
+				taxCents += li.AmountSubtotal
+				continue
+			}
 			variantID, _ := strconv.Atoi(li.Price.Product.Metadata["variant_id"])
 			items = append(items, models.OrderItem{
-				Variant_ID:   variantID,
-				Quantity:     int(li.Quantity),
-				Cents:        li.Price.UnitAmount,
-				ProductTitle: li.Price.Product.Name,
-				VariantColor: li.Price.Product.Description, // or from Metadata if you store color there
+				Variant_ID:    variantID,
+				Quantity:      int(li.Quantity),
+				Cents:         li.Price.UnitAmount,
+				Currency:      strings.ToUpper(string(li.Currency)),
+				ProductTitle:  li.Price.Product.Name,
+				VariantFormat: li.Price.Product.Metadata["format"],
 			})
 		}
 
-		// var items []models.OrderItem
-		order_id := services.GenerateShortOrderID()
+		promoCode := fullSess.Metadata["promo_code"]
+		giftCardCents, _ := strconv.ParseInt(fullSess.Metadata["gift_card_cents"], 10, 64)
+		var discountCents, shippingCents int64
+		if fullSess.TotalDetails != nil {
+			// The gift card rode along on the same Stripe coupon as the promotion
+			discountCents = max(fullSess.TotalDetails.AmountDiscount-giftCardCents, 0)
+			shippingCents = fullSess.TotalDetails.AmountShipping
+		}
+
+		order.OrderNumber = services.GenerateShortOrderID()
+		order.CheckoutSession_ID = fullSess.ID
+		if fullSess.PaymentIntent != nil {
+			order.PaymentIntent_ID = fullSess.PaymentIntent.ID
+		}
+		order.PromotionCode = promoCode
+		order.DiscountCents = discountCents
+		order.ShippingCents = shippingCents
+		order.TaxCents = taxCents
+		order.TotalCents = fullSess.AmountTotal
+		order.GiftCardCents = giftCardCents
+		order.GiftCardHold = fullSess.Metadata["gift_card_hold"]
+		order.PromotionHold = fullSess.Metadata["promotion_hold"]
+		order.Visitor_ID = fullSess.Metadata["visitor_id"]
+		order.Products = items
 
 		// TODO: Match session.ID or customer ID to user/cart
-		services.CreateOrder(order_id, email, address.Line1, address.City, address.PostalCode, address.Country, items)
+		orderID, err := services.CreateOrder(order)
+		if errors.Is(err, db.ErrOrderExists) {
+			fmt.Println("Order already made for session:", fullSess.ID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			fmt.Println("❌ Could not save order:", err)
+			http.Error(w, "failed to save order", http.StatusInternalServerError)
+			return
+		}
 		// and then clear the cart or mark order as paid
 		services.ClearCart()
 
-		services.EmailOrderDetails(email)
+		// Reload so the email sees the order exactly as it was stored
+		if saved, err := db.GetOrderByID(orderID); err != nil {
+			fmt.Println("❌ Could not reload order for email:", err)
+		} else {
+			if err := services.EmailOrderDetails(saved); err != nil {
+				fmt.Println("❌ Could not email order details:", err)
+			}
+			if err := services.IssuePurchasedGiftCards(saved); err != nil {
+				fmt.Println("❌ Could not issue gift cards:", err)
+			}
+		}
 
 		fmt.Println("✅ Payment successful for session:", checkoutSession.ID)
 		// e.g., cart.ClearCart(userID) or update order status in DB
@@ -238,6 +442,22 @@ func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func addressFromStripe(name, phone string, a *stripe.Address) models.Address {
+	if a == nil {
+		return models.Address{}
+	}
+	return models.Address{
+		Name:       name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		Phone:      phone,
+	}
+}
+
 func SuccessHandler(w http.ResponseWriter, r *http.Request) {
 	// books := []models.Book{
 	// 	{ID: 1, Title: "Go in Action", Author: "William Kennedy", Price: 29.99, Image: "/static/img/go.jpg"},
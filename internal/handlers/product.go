@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/cache"
 	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
 )
 
 func ProductDetailHandler(w http.ResponseWriter, r *http.Request) {
@@ -26,6 +32,45 @@ func ProductDetailHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to retrieve Product details", http.StatusInternalServerError)
 		return
 	}
+	if !product.OnSale() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if searchID := r.URL.Query().Get("search"); searchID != "" {
+		services.LogSearchClick(searchID, product.ID)
+	}
+	renderProductDetail(w, r, product)
+}
+
+// PreviewProductHandler shows an admin a product's page as the storefront
+// would, whatever its status.
+func PreviewProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid Product ID", http.StatusBadRequest)
+		return
+	}
+	product, err := db.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	product.Preview = !product.OnSale()
+	renderProductDetail(w, r, product)
+}
+
+func renderProductDetail(w http.ResponseWriter, r *http.Request, product *models.Product) {
+	if len(product.Categories) > 0 {
+		product.Breadcrumbs = services.Breadcrumbs(cache.GetCategories(), product.Categories[0].ID)
+	}
+
+	product.Currency = services.GetCurrency(r)
+	if err := services.ApplyCurrency(product.Variants, product.Currency); err != nil {
+		http.Error(w, "Failed to price product", http.StatusInternalServerError)
+		return
+	}
 
 	// Parse the template
 	tmpl, err := template.ParseFiles(
@@ -49,24 +94,42 @@ func ProductDetailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+const maxPageSize = 96
+
 func ProductListHandler(w http.ResponseWriter, r *http.Request) {
-	products, err := db.GetAllProducts()
+	q := r.URL.Query()
+	currency := services.GetCurrency(r)
+
+	page := pageFromRequest(r, browsePageSize)
+	if size, err := strconv.Atoi(q.Get("size")); err == nil && size > 0 {
+		page.PageSize = min(size, maxPageSize)
+	}
+
+	filter := models.ProductFilter{
+		Author:  q.Get("author"),
+		Format:  q.Get("format"),
+		InStock: q.Get("in_stock") != "",
+		Sort:    q.Get("sort"),
+	}
+	var err error
+	if filter.MinCents, err = priceParam(q.Get("min_price"), currency); err != nil {
+		http.Error(w, "Invalid minimum price", http.StatusBadRequest)
+		return
+	}
+	if filter.MaxCents, err = priceParam(q.Get("max_price"), currency); err != nil {
+		http.Error(w, "Invalid maximum price", http.StatusBadRequest)
+		return
+	}
+
+	products, err := db.GetProductListing(filter, &page)
 	if err != nil {
 		http.Error(w, "Failed to load products", http.StatusInternalServerError)
 		return
 	}
 
-	for i := range products {
-		if len(products[i].Variants) == 0 {
-			continue // no variants, skip
-		}
-		price := products[i].Variants[0].Cents
-		for _, variant := range products[i].Variants[1:] {
-			if variant.Cents < price {
-				price = variant.Cents
-			}
-		}
-		products[i].LowestPrice = float64(price) / 100
+	if err := services.ApplyCurrencyToProducts(products, currency); err != nil {
+		http.Error(w, "Failed to price products", http.StatusInternalServerError)
+		return
 	}
 
 	tmpl := template.Must(template.ParseFiles(
@@ -78,40 +141,93 @@ func ProductListHandler(w http.ResponseWriter, r *http.Request) {
 		"templates/product/product-list.html",
 	))
 
-	if err := tmpl.Execute(w, products); err != nil {
+	// The pagination links keep the filters and only change the page
+	q.Del("page")
+
+	d := struct {
+		Products []models.Product
+		Page     models.Pagination
+		Filter   models.ProductFilter
+		MinPrice string
+		MaxPrice string
+		Query    string
+		Sorts    []string
+		Formats  []string
+		Authors  []models.Author
+	}{
+		Products: products,
+		Page:     page,
+		Filter:   filter,
+		MinPrice: q.Get("min_price"),
+		MaxPrice: q.Get("max_price"),
+		Query:    q.Encode(),
+		Sorts:    models.ProductSorts,
+		Formats:  models.Formats,
+		Authors:  cache.GetCache(),
+	}
+
+	if err := tmpl.Execute(w, d); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
 	}
 }
 
-func SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
-	// Get the 'q' query parameter from URL
-	query := r.URL.Query().Get("q")
+// priceParam parses a price the shopper typed in their currency, such as
+// "12.50", into base currency cents. An empty value is zero, meaning no limit.
+func priceParam(value, currency string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 {
+		return 0, fmt.Errorf("invalid price %q", value)
+	}
+	return services.BaseCents(int64(math.Round(price*100)), currency)
+}
 
+func SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
 	if query == "" {
 		http.Error(w, "Query parameter 'q' is missing", http.StatusBadRequest)
 		return
 	}
+	currency := services.GetCurrency(r)
 
-	// Call your db.SearchDB(query) but you need to adjust it to return results instead of just printing
+	page := pageFromRequest(r, browsePageSize)
+	filter := models.ProductFilter{
+		Author:  q.Get("author"),
+		Format:  q.Get("format"),
+		InStock: q.Get("in_stock") != "",
+		Sort:    q.Get("sort"),
+	}
 
-	products, err := db.SearchProducts(query) // See next note about this function
+	// price is a facet range such as "10-20", in the shopper's currency
+	if price := q.Get("price"); price != "" {
+		low, high, _ := strings.Cut(price, "-")
+		var err error
+		if filter.MinCents, err = priceParam(low, currency); err != nil {
+			http.Error(w, "Invalid price range", http.StatusBadRequest)
+			return
+		}
+		if filter.MaxCents, err = priceParam(high, currency); err != nil {
+			http.Error(w, "Invalid price range", http.StatusBadRequest)
+			return
+		}
+		if filter.MaxCents > 0 {
+			// Ranges include the lower bound but stop short of the upper one
+			filter.MaxCents--
+		}
+	}
+
+	result, err := services.Search(query, filter, currency, &page)
 	if err != nil {
 		http.Error(w, "Search error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	for i := range products {
-		if len(products[i].Variants) == 0 {
-			continue // no variants, skip
-		}
-		price := products[i].Variants[0].Cents
-		for _, variant := range products[i].Variants[1:] {
-			if variant.Cents < price {
-				price = variant.Cents
-			}
-		}
-		products[i].LowestPrice = float64(price) / 100
-	}
+	// Result links carry the search ID so clicks can be counted
+	searchID := services.NewSearchID()
+	services.LogSearch(searchID, query, result, services.VisitorID(w, r))
 
 	// Render results (e.g., with template)
 	tmpl := template.Must(template.ParseFiles(
@@ -123,5 +239,23 @@ func SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
 		"templates/product/search-results.html",
 	))
 
-	tmpl.Execute(w, products)
+	q.Del("page")
+
+	d := struct {
+		models.SearchResult
+		SearchID string
+		Filter   models.ProductFilter
+		Query    string
+		Sorts    []string
+	}{
+		SearchResult: result,
+		SearchID:     searchID,
+		Filter:       filter,
+		Query:        q.Encode(),
+		Sorts:        append([]string{models.SortRelevance}, models.ProductSorts...),
+	}
+
+	if err := tmpl.Execute(w, d); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
 }
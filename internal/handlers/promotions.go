@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+const dateLayout = "2006-01-02"
+
+func AdminPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	promotions, err := db.GetAllPromotions()
+	if err != nil {
+		http.Error(w, "Failed to fetch promotions", http.StatusInternalServerError)
+		return
+	}
+
+	products, err := db.GetAllProducts()
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/promotions.html",
+	))
+
+	d := struct {
+		LoggedIn   bool
+		Promotions []models.Promotion
+		Products   []models.Product
+		Authors    []models.Author
+	}{
+		LoggedIn:   true,
+		Promotions: promotions,
+		Products:   products,
+		Authors:    cache.GetCache(),
+	}
+	tmpl.Execute(w, d)
+}
+
+func AddPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	p := models.Promotion{
+		Code:         strings.ToUpper(strings.TrimSpace(r.FormValue("code"))),
+		DiscountType: r.FormValue("discount_type"),
+		StartsAt:     time.Now(),
+	}
+	if p.Code == "" {
+		http.Error(w, "Promotion code is required", http.StatusBadRequest)
+		return
+	}
+
+	switch p.DiscountType {
+	case models.PromotionPercent:
+		percent, err := strconv.Atoi(r.FormValue("percent_off"))
+		if err != nil || percent <= 0 || percent > 100 {
+			http.Error(w, "Invalid percent off", http.StatusBadRequest)
+			return
+		}
+		p.PercentOff = percent
+	case models.PromotionFixed:
+		amount, err := strconv.ParseFloat(r.FormValue("amount_off"), 64)
+		if err != nil || amount <= 0 {
+			http.Error(w, "Invalid amount off", http.StatusBadRequest)
+			return
+		}
+		p.Cents = int64(math.Round(amount * 100))
+	case models.PromotionFreeShipping:
+	default:
+		http.Error(w, "Invalid discount type", http.StatusBadRequest)
+		return
+	}
+
+	if v := r.FormValue("starts_at"); v != "" {
+		startsAt, err := time.ParseInLocation(dateLayout, v, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid start date", http.StatusBadRequest)
+			return
+		}
+		p.StartsAt = startsAt
+	}
+	if v := r.FormValue("ends_at"); v != "" {
+		endsAt, err := time.ParseInLocation(dateLayout, v, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid end date", http.StatusBadRequest)
+			return
+		}
+		// The end date is inclusive
+		endsAt = endsAt.AddDate(0, 0, 1).Add(-time.Second)
+		p.EndsAt = &endsAt
+	}
+	if v := r.FormValue("usage_limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid usage limit", http.StatusBadRequest)
+			return
+		}
+		p.UsageLimit = &limit
+	}
+
+	for _, idStr := range r.Form["product_id"] {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+		p.ProductIDs = append(p.ProductIDs, id)
+	}
+
+	for _, idStr := range r.Form["author_id"] {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+		p.AuthorIDs = append(p.AuthorIDs, id)
+	}
+
+	if _, err := db.InsertPromotion(p); err != nil {
+		http.Error(w, "Failed to create promotion", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Created promotion %s", p.Code)
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
+
+func DeactivatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/admin/deactivate-promotion/")
+	promotionID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetPromotionActive(promotionID, false); err != nil {
+		http.Error(w, "Failed to deactivate promotion", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func RequestReturnHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	itemIDs := r.Form["order_item_id"]
+	quantities := r.Form["return_quantity"]
+	if len(itemIDs) != len(quantities) {
+		http.Error(w, "Return item fields mismatch", http.StatusBadRequest)
+		return
+	}
+	items := make(map[int]int)
+	for i := range itemIDs {
+		if quantities[i] == "" {
+			continue
+		}
+		itemID, err := strconv.Atoi(itemIDs[i])
+		if err != nil {
+			http.Error(w, "Invalid order item ID", http.StatusBadRequest)
+			return
+		}
+		quantity, err := strconv.Atoi(quantities[i])
+		if err != nil || quantity < 0 {
+			http.Error(w, "Invalid quantity", http.StatusBadRequest)
+			return
+		}
+		items[itemID] = quantity
+	}
+
+	ret, err := services.RequestReturn(r.FormValue("email"), r.FormValue("order-number"), r.FormValue("reason"), items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/partials/header.html",
+		"templates/partials/footer.html",
+		"templates/order/return-requested.html",
+	))
+
+	if err := tmpl.Execute(w, ret); err != nil {
+		log.Println("Template execution error:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func AdminReturnsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	returns, err := db.GetReturns(status)
+	if err != nil {
+		http.Error(w, "Failed to fetch returns", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/returns.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Status   string
+		Returns  []models.Return
+	}{
+		LoggedIn: true,
+		Status:   status,
+		Returns:  returns,
+	}
+	tmpl.Execute(w, d)
+}
+
+func AdminReturnHandler(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid return ID", http.StatusBadRequest)
+		return
+	}
+
+	ret, err := db.GetReturnByID(returnID)
+	if err != nil {
+		http.Error(w, "Return not found", http.StatusNotFound)
+		return
+	}
+	order, err := db.GetOrderByID(ret.Order_ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return
+	}
+	refund := services.ReturnValue(order, ret)
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/return.html",
+	))
+
+	d := struct {
+		LoggedIn    bool
+		Return      models.Return
+		Refund      services.ReturnRefund
+		RefundCents int64
+	}{
+		LoggedIn:    true,
+		Return:      ret,
+		Refund:      refund,
+		RefundCents: refund.Total(),
+	}
+	tmpl.Execute(w, d)
+}
+
+// ReturnActionHandler moves a return through its workflow:
+// requested -> approved/rejected -> received -> refunded/credited.
+func ReturnActionHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	returnID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid return ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	note := r.FormValue("admin_note")
+
+	switch r.FormValue("action") {
+	case "approve":
+		err = db.UpdateReturnStatus(returnID, models.ReturnStatusRequested, models.ReturnStatusApproved, note)
+	case "reject":
+		err = db.UpdateReturnStatus(returnID, models.ReturnStatusRequested, models.ReturnStatusRejected, note)
+	case "receive":
+		resellable := make(map[int]bool)
+		for _, itemIDStr := range r.Form["resellable"] {
+			itemID, err := strconv.Atoi(itemIDStr)
+			if err != nil {
+				http.Error(w, "Invalid return item ID", http.StatusBadRequest)
+				return
+			}
+			resellable[itemID] = true
+		}
+		err = db.ReceiveReturn(returnID, resellable)
+	case "refund":
+		err = services.RefundReturn(returnID)
+	case "credit":
+		err = services.CreditReturn(returnID)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Println("Return error:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/return/"+idStr, http.StatusSeeOther)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/admin"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// ProductRevisionsHandler lists a product's revisions, newest first, each
+// with what changed since the one before it.
+func ProductRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	product, err := db.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	revisions, err := db.GetProductRevisions(productID)
+	if err != nil {
+		http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+		return
+	}
+	for i := range len(revisions) - 1 {
+		revisions[i].Changes = admin.Diff(revisions[i+1].Snapshot, revisions[i].Snapshot)
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/revisions.html",
+	))
+
+	d := struct {
+		LoggedIn  bool
+		Product   *models.Product
+		Revisions []models.ProductRevision
+	}{
+		LoggedIn:  true,
+		Product:   product,
+		Revisions: revisions,
+	}
+	tmpl.Execute(w, d)
+}
+
+// RevertProductHandler saves the product as it was at one of its revisions.
+func RevertProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	revisionID, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	err = admin.RevertProduct(productID, revisionID)
+	if errors.Is(err, db.ErrVersionConflict) {
+		http.Error(w, "The book changed while reverting; reload and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revert product %d to revision %d: %v", productID, revisionID, err)
+		http.Error(w, "Failed to revert: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/product/%d/revisions", productID), http.StatusSeeOther)
+}
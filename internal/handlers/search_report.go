@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// AdminSearchReportHandler shows what customers searched for over the last
+// ?days= days (30 by default), what they failed to find and how often a
+// search ended in a purchase.
+func AdminSearchReportHandler(w http.ResponseWriter, r *http.Request) {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+
+	report, err := db.GetSearchReport(time.Now().AddDate(0, 0, -days), 50)
+	if err != nil {
+		http.Error(w, "Failed to build search report", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/search-report.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Days     int
+		Report   models.SearchReport
+	}{
+		LoggedIn: true,
+		Days:     days,
+		Report:   report,
+	}
+	tmpl.Execute(w, d)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// SuggestHandler answers the search box's autocomplete with the titles,
+// authors and categories matching what has been typed so far.
+func SuggestHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	suggestions := []models.Suggestion{}
+	if query != "" {
+		if found := services.Suggest(query); found != nil {
+			suggestions = found
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(map[string]any{
+		"query":       query,
+		"suggestions": suggestions,
+	})
+}
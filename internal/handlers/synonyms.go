@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func AdminSynonymsHandler(w http.ResponseWriter, r *http.Request) {
+	synonyms, err := db.GetAllSynonyms()
+	if err != nil {
+		http.Error(w, "Failed to fetch synonyms", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"templates/layout.html",
+		"templates/admin/header.html",
+		"templates/partials/footer.html",
+		"templates/admin/synonyms.html",
+	))
+
+	d := struct {
+		LoggedIn bool
+		Synonyms []models.Synonym
+	}{
+		LoggedIn: true,
+		Synonyms: synonyms,
+	}
+	tmpl.Execute(w, d)
+}
+
+func AddSynonymHandler(w http.ResponseWriter, r *http.Request) {
+	term := strings.Join(strings.Fields(r.FormValue("term")), " ")
+	expansion := strings.Join(strings.Fields(r.FormValue("expansion")), " ")
+	if term == "" || expansion == "" {
+		http.Error(w, "Term and expansion are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.InsertSynonym(term, expansion); err != nil {
+		http.Error(w, "Failed to save synonym", http.StatusInternalServerError)
+		return
+	}
+
+	cache.UpdateCache()
+	http.Redirect(w, r, "/admin/synonyms", http.StatusSeeOther)
+}
+
+func DeleteSynonymHandler(w http.ResponseWriter, r *http.Request) {
+	synonymID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid synonym ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteSynonym(synonymID); err != nil {
+		http.Error(w, "Failed to delete synonym", http.StatusInternalServerError)
+		return
+	}
+
+	cache.UpdateCache()
+	http.Redirect(w, r, "/admin/synonyms", http.StatusSeeOther)
+}
@@ -0,0 +1,177 @@
+// Package images validates uploaded product images and stores them under
+// their content hash in the media storage, re-encoded at each of the sizes
+// the storefront shows.
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/internal/storage"
+	"github.com/nathanialw/ecommerce/pkg/models"
+	"golang.org/x/image/draw"
+)
+
+const (
+	MaxUploadBytes = 10 << 20
+	// maxPixels stops a small file that decodes to a huge image from
+	// exhausting memory
+	maxPixels   = 40_000_000
+	fullWidth   = 2000
+	jpegQuality = 85
+)
+
+var ctx = context.Background()
+
+var (
+	ErrTooLarge    = errors.New("image is larger than 10 MB")
+	ErrUnsupported = errors.New("image must be a JPEG, PNG, GIF or WebP")
+	ErrDimensions  = errors.New("image dimensions are too large")
+)
+
+// sizes are the widths each upload is scaled down to. Smaller images are
+// never scaled up.
+var sizes = map[string]int{
+	models.ImageThumb:  160,
+	models.ImageGrid:   400,
+	models.ImageDetail: 1000,
+}
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Save checks an upload is an image of an allowed type and size, and stores
+// it under its SHA-256 with a JPEG and WebP copy at each size. It returns the
+// name to keep in variants.image_path. Uploading the same file again reuses
+// the stored copies.
+func Save(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxUploadBytes {
+		return "", ErrTooLarge
+	}
+	if !allowedTypes[http.DetectContentType(data)] {
+		return "", ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return "", ErrDimensions
+	}
+
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + ".jpg"
+	if exists, err := storage.Default.Exists(ctx, name); err != nil {
+		return "", err
+	} else if exists {
+		return name, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	for size, width := range sizes {
+		scaled := scale(img, width)
+		if err := write(models.ImageFile(name, size, "jpg"), scaled, encodeJPEG); err != nil {
+			return "", err
+		}
+		if err := write(models.ImageFile(name, size, "webp"), scaled, encodeWebP); err != nil {
+			return "", err
+		}
+	}
+	// The full-size copy goes last, since its presence means the rest exist
+	if err := write(name, scale(img, fullWidth), encodeJPEG); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// scale resizes img to width, keeping its aspect ratio, and flattens it onto
+// white since JPEG has no transparency.
+func scale(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() < width {
+		width = b.Dx()
+	}
+	height := max(b.Dy()*width/b.Dx(), 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+func encodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+}
+
+func encodeWebP(w io.Writer, img image.Image) error {
+	return nativewebp.Encode(w, img, nil)
+}
+
+func write(name string, img image.Image, encode func(io.Writer, image.Image) error) error {
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		return fmt.Errorf("encoding %s: %w", name, err)
+	}
+	contentType := "image/jpeg"
+	if filepath.Ext(name) == ".webp" {
+		contentType = "image/webp"
+	}
+	return storage.Default.Put(ctx, name, &buf, int64(buf.Len()), contentType)
+}
+
+// RemoveUnused deletes the files of each image no variant uses any more.
+func RemoveUnused(names ...string) {
+	for _, name := range names {
+		if name == "" || name != filepath.Base(name) {
+			continue
+		}
+		inUse, err := db.ImageInUse(name)
+		if err != nil || inUse {
+			if err != nil {
+				log.Printf("Keeping image %s: %v", name, err)
+			}
+			continue
+		}
+
+		files := []string{name}
+		if models.IsHashedImage(name) {
+			for size := range sizes {
+				files = append(files, models.ImageFile(name, size, "jpg"), models.ImageFile(name, size, "webp"))
+			}
+		}
+		for _, f := range files {
+			if err := storage.Default.Delete(ctx, f); err != nil {
+				log.Printf("Failed to remove image %s: %v", f, err)
+			}
+		}
+	}
+}
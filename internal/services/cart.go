@@ -1,6 +1,7 @@
 package services
 
 import (
+	"log"
 	"math"
 	"net/http"
 
@@ -13,27 +14,53 @@ func GetCartItems(r *http.Request) ([]models.CartItem, float64) {
 	cartAny := session.Values["cart"]
 	cart, _ := cartAny.([]models.CartItem)
 
-	var total float64
 	var products []models.CartItem
+	var variants []models.Variant
 	for _, item := range cart {
 		variant, err := db.GetVariantByID(item.Variant_ID)
-		product, _ := db.GetProductByID(variant.ID)
-		if err == nil {
+		if err != nil || variant.ArchivedAt != nil {
+			continue
+		}
+		product, err := db.GetProductByID(variant.Product_ID)
+		if err == nil && product.OnSale() {
+			var authorIDs []int
+			for _, c := range product.Contributors {
+				if c.Role == models.RoleAuthor {
+					authorIDs = append(authorIDs, c.Author_ID)
+				}
+			}
 			products = append(products, models.CartItem{
-				Variant:  variant,
-				Quantity: item.Quantity,
-				Total:    variant.Price * float64(item.Quantity),
-				Name:     product.Title,
+				Variant_ID:  variant.ID,
+				Quantity:    item.Quantity,
+				Name:        product.Title,
+				Author:      product.Author,
+				AuthorIDs:   authorIDs,
+				ProductType: product.ProductType,
 			})
-			total += variant.Price * float64(item.Quantity)
+			variants = append(variants, variant)
 		}
 	}
+
+	// Price everything in the customer's currency
+	if err := ApplyCurrency(variants, GetCurrency(r)); err != nil {
+		log.Printf("Failed to price cart: %v", err)
+		ApplyCurrency(variants, BaseCurrency)
+	}
+
+	var total float64
+	for i := range products {
+		products[i].Variant = variants[i]
+		products[i].Total = variants[i].Price * float64(products[i].Quantity)
+		total += products[i].Total
+	}
 	return products, total
 }
 
+// GSTRate is the goods and services tax charged on every order.
+const GSTRate = 0.05
+
 func CalcTax(total float64) (float64, float64) {
-	const GST = 0.05
-	tax := math.Round(total*GST*100) / 100
+	tax := math.Round(total*GSTRate*100) / 100
 	subtotal := total + tax
 
 	return subtotal, tax
@@ -41,14 +68,39 @@ func CalcTax(total float64) (float64, float64) {
 
 func CheckoutHandler(w http.ResponseWriter, r *http.Request) models.Cart {
 	products, total := GetCartItems(r)
-	subtotal, tax := CalcTax(total)
 
 	data := models.Cart{
 		Products: products,
-		Subtotal: subtotal,
-		Tax:      tax,
-		Total:    total,
+		Currency: BaseCurrency,
+	}
+	if len(products) > 0 {
+		data.Currency = products[0].Variant.Currency
+	}
+
+	// Discounts come off before tax is calculated
+	session, _ := db.Store.Get(r, "session")
+	if code, ok := session.Values["promo"].(string); ok && code != "" {
+		data.PromoCode = code
+		if err := ApplyPromotion(&data, code); err != nil {
+			data.PromoError = err.Error()
+		}
+	}
+
+	data.Total = total - data.Discount
+	data.Subtotal, data.Tax = CalcTax(data.Total)
+	// Charged as its own line at checkout
+	data.TaxCents = int64(math.Round(data.Tax * 100))
+
+	// Gift cards are a way to pay, not a discount, so tax is worked out on the
+	// full total. A card pays for at most the items, leaving tax and shipping
+	// due; see GiftCardLimit
+	if code, ok := session.Values["gift_card"].(string); ok && code != "" {
+		data.GiftCardCode = code
+		if err := ApplyGiftCard(&data, code); err != nil {
+			data.GiftCardError = err.Error()
+		}
 	}
+	data.AmountDue = data.Subtotal - data.GiftCard
 
 	return data
 }
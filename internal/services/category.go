@@ -0,0 +1,45 @@
+package services
+
+import "github.com/nathanialw/ecommerce/pkg/models"
+
+// CategoryTree nests a flat category list (as returned by
+// db.GetAllCategories) under its top-level categories, keeping sibling order.
+func CategoryTree(categories []models.Category) []models.Category {
+	children := make(map[int][]models.Category)
+	var roots []models.Category
+	for _, c := range categories {
+		if c.Parent_ID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.Parent_ID] = append(children[*c.Parent_ID], c)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	return attach(roots)
+}
+
+// Breadcrumbs returns the path from the top-level category down to the one
+// with categoryID.
+func Breadcrumbs(categories []models.Category, categoryID int) []models.Category {
+	byID := make(map[int]models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+
+	var path []models.Category
+	for c, ok := byID[categoryID]; ok && len(path) < len(categories); {
+		path = append([]models.Category{c}, path...)
+		if c.Parent_ID == nil {
+			break
+		}
+		c, ok = byID[*c.Parent_ID]
+	}
+	return path
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// BaseCurrency is the currency variant prices are stored in.
+const BaseCurrency = "CAD"
+
+// StandardShippingCents is the flat shipping rate in the base currency.
+const StandardShippingCents = 1500
+
+var SupportedCurrencies = []string{"CAD", "USD"}
+
+var countryCurrencies = map[string]string{
+	"CA": "CAD",
+	"US": "USD",
+}
+
+func IsSupportedCurrency(currency string) bool {
+	for _, c := range SupportedCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCurrency returns the currency chosen in the session, falling back to the
+// currency of the customer's country and then the base currency.
+func GetCurrency(r *http.Request) string {
+	session, _ := db.Store.Get(r, "session")
+	if c, ok := session.Values["currency"].(string); ok && IsSupportedCurrency(c) {
+		return c
+	}
+	if c, ok := countryCurrencies[RequestCountry(r)]; ok {
+		return c
+	}
+	return BaseCurrency
+}
+
+// RequestCountry guesses the customer's country from a CDN geolocation header,
+// or from the region of their preferred language ("en-US" -> "US").
+func RequestCountry(r *http.Request) string {
+	if country := r.Header.Get("CF-IPCountry"); country != "" {
+		return strings.ToUpper(country)
+	}
+	lang := r.Header.Get("Accept-Language")
+	if i := strings.IndexAny(lang, ",;"); i >= 0 {
+		lang = lang[:i]
+	}
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		return strings.ToUpper(strings.TrimSpace(lang[i+1:]))
+	}
+	return ""
+}
+
+// ConvertCents converts an amount in the base currency using the exchange
+// rate table and the currency's rounding rule.
+func ConvertCents(cents int64, currency string) (int64, error) {
+	if currency == BaseCurrency {
+		return cents, nil
+	}
+	rate, err := db.GetExchangeRate(currency)
+	if err != nil {
+		return 0, fmt.Errorf("no exchange rate for %s: %w", currency, err)
+	}
+	return convert(cents, rate), nil
+}
+
+// BaseCents converts an amount the shopper entered in their currency back to
+// the base currency, so it can be compared with stored prices. Price list
+// overrides and charm pricing are ignored, so it is only approximate.
+func BaseCents(cents int64, currency string) (int64, error) {
+	if currency == BaseCurrency {
+		return cents, nil
+	}
+	rate, err := db.GetExchangeRate(currency)
+	if err != nil {
+		return 0, fmt.Errorf("no exchange rate for %s: %w", currency, err)
+	}
+	if rate.Rate <= 0 {
+		return 0, fmt.Errorf("invalid exchange rate for %s", currency)
+	}
+	return int64(math.Round(float64(cents) / rate.Rate)), nil
+}
+
+func convert(cents int64, rate models.ExchangeRate) int64 {
+	converted := int64(math.Round(float64(cents) * rate.Rate))
+	if rate.CharmPricing && converted > 0 {
+		// Round up to the next whole unit and end in .99
+		converted = (converted+99)/100*100 - 1
+	}
+	return converted
+}
+
+// ApplyCurrency reprices variants in the given currency, preferring a
+// variant's own price list entry over the converted base price.
+func ApplyCurrency(variants []models.Variant, currency string) error {
+	if currency != BaseCurrency && len(variants) > 0 {
+		ids := make([]int, len(variants))
+		for i, v := range variants {
+			ids[i] = v.ID
+		}
+		prices, err := db.GetVariantPrices(ids, currency)
+		if err != nil {
+			return err
+		}
+		rate, err := db.GetExchangeRate(currency)
+		if err != nil {
+			return fmt.Errorf("no exchange rate for %s: %w", currency, err)
+		}
+
+		for i := range variants {
+			if cents, ok := prices[variants[i].ID]; ok {
+				variants[i].Cents = cents
+			} else {
+				variants[i].Cents = convert(variants[i].Cents, rate)
+			}
+		}
+	}
+
+	for i := range variants {
+		variants[i].Currency = currency
+		variants[i].Price = float64(variants[i].Cents) / 100.0
+	}
+	return nil
+}
+
+// ApplyCurrencyToProducts reprices every variant of the products and sets
+// each product's lowest price.
+func ApplyCurrencyToProducts(products []models.Product, currency string) error {
+	var variants []models.Variant
+	for _, p := range products {
+		variants = append(variants, p.Variants...)
+	}
+	if err := ApplyCurrency(variants, currency); err != nil {
+		return err
+	}
+
+	n := 0
+	for i := range products {
+		products[i].Currency = currency
+		m := n + len(products[i].Variants)
+		products[i].Variants = variants[n:m:m]
+		n = m
+
+		if len(products[i].Variants) == 0 {
+			continue // no variants, skip
+		}
+		price := products[i].Variants[0].Cents
+		for _, variant := range products[i].Variants[1:] {
+			if variant.Cents < price {
+				price = variant.Cents
+			}
+		}
+		products[i].LowestPrice = float64(price) / 100
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		cents int64
+		rate  float64
+		charm bool
+		want  int64
+	}{
+		{1000, 0.75, false, 750},
+		{1999, 0.73, false, 1459},   // 1459.27 rounds down
+		{1999, 0.7325, false, 1464}, // 1464.2675 rounds down
+		{3, 0.5, false, 2},          // halves round away from zero
+		{1, 0.5, false, 1},
+		{0, 0.75, false, 0},
+		{1999, 0.73, true, 1499}, // 14.59 goes up to 14.99
+		{1500, 1, true, 1499},    // whole amounts end in .99 below
+		{1, 1, true, 99},
+		{0, 0.73, true, 0}, // free stays free
+	}
+	for _, tt := range tests {
+		rate := models.ExchangeRate{Rate: tt.rate, CharmPricing: tt.charm}
+		if got := convert(tt.cents, rate); got != tt.want {
+			t.Errorf("convert(%d, %g, charm %v) = %d, want %d", tt.cents, tt.rate, tt.charm, got, tt.want)
+		}
+	}
+}
+
+func TestConvertCentsInBaseCurrency(t *testing.T) {
+	// The base currency needs no exchange rate
+	for _, cents := range []int64{0, 1, 1999} {
+		got, err := ConvertCents(cents, BaseCurrency)
+		if err != nil || got != cents {
+			t.Errorf("ConvertCents(%d, %s) = %d, %v; want %d", cents, BaseCurrency, got, err, cents)
+		}
+		got, err = BaseCents(cents, BaseCurrency)
+		if err != nil || got != cents {
+			t.Errorf("BaseCents(%d, %s) = %d, %v; want %d", cents, BaseCurrency, got, err, cents)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// OrderTotals is the money breakdown printed on an invoice.
+type OrderTotals struct {
+	Currency string
+	Subtotal int64
+	Discount int64
+	Shipping int64
+	Tax      int64
+	Total    int64
+	GiftCard int64
+	Due      int64
+}
+
+// CalcOrderTotals lays out the amounts stored on the order when it was paid.
+// Stripe charged TotalCents, GST included, so the invoice total is what was
+// paid by card and gift card together.
+func CalcOrderTotals(order models.Order) OrderTotals {
+	totals := OrderTotals{
+		Currency: BaseCurrency,
+		Discount: order.DiscountCents,
+		Shipping: order.ShippingCents,
+		Tax:      order.TaxCents,
+		GiftCard: order.GiftCardCents,
+	}
+	for _, item := range order.Products {
+		totals.Subtotal += item.Cents * int64(item.Quantity)
+		if item.Currency != "" {
+			totals.Currency = item.Currency
+		}
+	}
+
+	totals.Due = order.TotalCents
+	totals.Total = totals.Due + totals.GiftCard
+	return totals
+}
+
+// WriteInvoice renders a tax invoice for the order as a PDF.
+func WriteInvoice(w io.Writer, order models.Order) error {
+	pdf := newDocument()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.AddPage()
+	documentHeader(pdf, tr, "TAX INVOICE", order)
+	documentAddresses(pdf, tr, order, true)
+
+	totals := CalcOrderTotals(order)
+
+	// Line items
+	widths := []float64{95, 35, 15, 25, 25}
+	tableHeader(pdf, widths, []string{"Title", "Format", "Qty", "Unit price", "Amount"}, "LLRRR")
+	for _, item := range order.Products {
+		pdf.CellFormat(widths[0], 7, tr(item.ProductTitle), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 7, tr(item.VariantFormat), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[2], 7, fmt.Sprint(item.Quantity), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 7, formatCents(item.Cents), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 7, formatCents(item.Cents*int64(item.Quantity)), "B", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Tax breakdown
+	line := func(label string, cents int64, bold bool) {
+		if bold {
+			pdf.SetFont("Helvetica", "B", 10)
+		}
+		pdf.CellFormat(145, 6, label, "", 0, "R", false, 0, "")
+		pdf.CellFormat(50, 6, formatCents(cents), "", 1, "R", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+	}
+	line("Subtotal", totals.Subtotal, false)
+	if totals.Discount > 0 {
+		label := "Discount"
+		if order.PromotionCode != "" {
+			label += " (" + order.PromotionCode + ")"
+		}
+		line(label, -totals.Discount, false)
+	}
+	line("Shipping", totals.Shipping, false)
+	line(fmt.Sprintf("GST (%g%%)", GSTRate*100), totals.Tax, false)
+	line("Total ("+totals.Currency+")", totals.Total, true)
+	if totals.GiftCard > 0 {
+		line("Paid by gift card / store credit", -totals.GiftCard, false)
+		line("Paid by card", totals.Due, false)
+	}
+
+	if Store.TaxNumber != "" {
+		pdf.Ln(6)
+		pdf.CellFormat(0, 5, "GST registration number: "+Store.TaxNumber, "", 1, "L", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
+
+// InvoicePDF returns the order's invoice as an email attachment.
+func InvoicePDF(order models.Order) (Attachment, error) {
+	var buf bytes.Buffer
+	if err := WriteInvoice(&buf, order); err != nil {
+		return Attachment{}, err
+	}
+	return Attachment{
+		Filename:    "invoice-" + order.OrderNumber + ".pdf",
+		ContentType: "application/pdf",
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// packingItems returns the stocked items of an order still left to ship,
+// with Quantity set to how many of each are left.
+func packingItems(order models.Order) []models.OrderItem {
+	var items []models.OrderItem
+	for _, item := range order.Products {
+		left := item.Quantity - item.ShippedQuantity
+		if !models.Stocked(item.VariantFormat) || left <= 0 {
+			continue
+		}
+		item.Quantity = left
+		items = append(items, item)
+	}
+	return items
+}
+
+// WritePackingSlips renders one packing slip page per order into a single
+// PDF, so a whole batch can be printed at once. Slips only list what is
+// left to ship, and orders with nothing left to ship are skipped.
+func WritePackingSlips(w io.Writer, orders []models.Order) error {
+	pdf := newDocument()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	packed := 0
+	for _, order := range orders {
+		items := packingItems(order)
+		if len(items) == 0 {
+			continue
+		}
+		packed++
+
+		pdf.AddPage()
+		documentHeader(pdf, tr, "PACKING SLIP", order)
+		documentAddresses(pdf, tr, order, false)
+
+		widths := []float64{15, 120, 40, 20}
+		tableHeader(pdf, widths, []string{"", "Title", "Format", "Qty"}, "CLLR")
+		for _, item := range items {
+			pdf.CellFormat(widths[0], 8, "[  ]", "B", 0, "C", false, 0, "")
+			pdf.CellFormat(widths[1], 8, tr(item.ProductTitle), "B", 0, "L", false, 0, "")
+			pdf.CellFormat(widths[2], 8, tr(item.VariantFormat), "B", 0, "L", false, 0, "")
+			pdf.CellFormat(widths[3], 8, fmt.Sprint(item.Quantity), "B", 1, "R", false, 0, "")
+		}
+	}
+	if packed == 0 {
+		pdf.AddPage()
+		pdf.CellFormat(0, 10, "No orders to pack.", "", 1, "L", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
+
+func newDocument() *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "Letter", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetFont("Helvetica", "", 10)
+	return pdf
+}
+
+func documentHeader(pdf *fpdf.Fpdf, tr func(string) string, title string, order models.Order) {
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(120, 8, tr(Store.Name), "", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 8, title, "", 1, "R", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	storeLines := append([]string{}, Store.Address...)
+	storeLines = append(storeLines, Store.Email, Store.Phone)
+	orderLines := []string{
+		"Order: " + order.OrderNumber,
+		"Date: " + order.CreatedAt.Format("January 2, 2006"),
+	}
+	for i := 0; i < max(len(storeLines), len(orderLines)); i++ {
+		left, right := "", ""
+		if i < len(storeLines) {
+			left = storeLines[i]
+		}
+		if i < len(orderLines) {
+			right = orderLines[i]
+		}
+		if left == "" && right == "" {
+			continue
+		}
+		pdf.CellFormat(120, 5, tr(left), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, right, "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(6)
+}
+
+func documentAddresses(pdf *fpdf.Fpdf, tr func(string) string, order models.Order, withBilling bool) {
+	shipTo := addressLines(order.ShippingAddress)
+	if len(shipTo) == 0 {
+		// Orders from before structured addresses only have the flat copy
+		shipTo = []string{order.Address, order.City + " " + order.PostalCode, order.Country}
+	}
+
+	var billTo []string
+	if withBilling {
+		billTo = addressLines(order.BillingAddress)
+		if len(billTo) == 0 {
+			billTo = []string{order.Email}
+		}
+	}
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(95, 6, "Ship to", "", 0, "L", false, 0, "")
+	if withBilling {
+		pdf.CellFormat(95, 6, "Bill to", "", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 10)
+
+	for i := 0; i < max(len(shipTo), len(billTo)); i++ {
+		left, right := "", ""
+		if i < len(shipTo) {
+			left = shipTo[i]
+		}
+		if i < len(billTo) {
+			right = billTo[i]
+		}
+		pdf.CellFormat(95, 5, tr(left), "", 0, "L", false, 0, "")
+		pdf.CellFormat(95, 5, tr(right), "", 1, "L", false, 0, "")
+	}
+	if order.Phone != "" {
+		pdf.CellFormat(95, 5, "Phone: "+order.Phone, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+}
+
+func addressLines(a models.Address) []string {
+	if a.Line1 == "" {
+		return nil
+	}
+	lines := []string{a.Name, a.Line1}
+	if a.Line2 != "" {
+		lines = append(lines, a.Line2)
+	}
+	lines = append(lines, strings.TrimSpace(strings.Join([]string{a.City, a.State, a.PostalCode}, " ")), a.Country)
+	return lines
+}
+
+// tableHeader prints a shaded row of column headings; aligns holds one
+// alignment letter (L, C or R) per column.
+func tableHeader(pdf *fpdf.Fpdf, widths []float64, headings []string, aligns string) {
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	for i, h := range headings {
+		pdf.CellFormat(widths[i], 7, h, "B", 0, aligns[i:i+1], true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 10)
+}
+
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func TestCalcOrderTotals(t *testing.T) {
+	books := []models.OrderItem{
+		{Cents: 2000, Quantity: 2, Currency: "USD"},
+		{Cents: 1500, Quantity: 1, Currency: "USD"},
+	}
+
+	tests := []struct {
+		name  string
+		order models.Order
+		want  OrderTotals
+	}{
+		{
+			"card only",
+			models.Order{Products: books, ShippingCents: 1000, TaxCents: 275, TotalCents: 6775},
+			OrderTotals{Currency: "USD", Subtotal: 5500, Shipping: 1000, Tax: 275, Total: 6775, Due: 6775},
+		},
+		{
+			"with a promotion",
+			models.Order{Products: books, DiscountCents: 500, ShippingCents: 1000, TaxCents: 250, TotalCents: 6250},
+			OrderTotals{Currency: "USD", Subtotal: 5500, Discount: 500, Shipping: 1000, Tax: 250, Total: 6250, Due: 6250},
+		},
+		{
+			"free shipping",
+			models.Order{Products: books, TaxCents: 275, TotalCents: 5775},
+			OrderTotals{Currency: "USD", Subtotal: 5500, Tax: 275, Total: 5775, Due: 5775},
+		},
+		{
+			// The gift card came off what Stripe charged, but is still part
+			// of what the order cost
+			"partly paid by gift card",
+			models.Order{Products: books, ShippingCents: 1000, TaxCents: 275, GiftCardCents: 3000, TotalCents: 3775},
+			OrderTotals{Currency: "USD", Subtotal: 5500, Shipping: 1000, Tax: 275, Total: 6775, GiftCard: 3000, Due: 3775},
+		},
+		{
+			"paid entirely by gift card",
+			models.Order{Products: books, ShippingCents: 1000, TaxCents: 275, GiftCardCents: 5500, TotalCents: 1275},
+			OrderTotals{Currency: "USD", Subtotal: 5500, Shipping: 1000, Tax: 275, Total: 6775, GiftCard: 5500, Due: 1275},
+		},
+		{
+			"from before GST was charged",
+			models.Order{Products: books, ShippingCents: 1000, TotalCents: 6500},
+			OrderTotals{Currency: "USD", Subtotal: 5500, Shipping: 1000, Total: 6500, Due: 6500},
+		},
+		{
+			"items without a currency are in the base currency",
+			models.Order{Products: []models.OrderItem{{Cents: 1000, Quantity: 1}}, TaxCents: 50, TotalCents: 1050},
+			OrderTotals{Currency: BaseCurrency, Subtotal: 1000, Tax: 50, Total: 1050, Due: 1050},
+		},
+	}
+	for _, tt := range tests {
+		if got := CalcOrderTotals(tt.order); got != tt.want {
+			t.Errorf("%s: CalcOrderTotals = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPackingItems(t *testing.T) {
+	item := func(id int, format string, quantity, shipped int) models.OrderItem {
+		return models.OrderItem{ID: id, VariantFormat: format, Quantity: quantity, ShippedQuantity: shipped}
+	}
+
+	tests := []struct {
+		name  string
+		items []models.OrderItem
+		want  map[int]int // order item ID to quantity left to pack
+	}{
+		{
+			"nothing shipped yet",
+			[]models.OrderItem{item(1, models.FormatHardcover, 2, 0), item(2, models.FormatPaperback, 1, 0)},
+			map[int]int{1: 2, 2: 1},
+		},
+		{
+			"partly shipped",
+			[]models.OrderItem{item(1, models.FormatHardcover, 3, 1), item(2, models.FormatPaperback, 1, 1)},
+			map[int]int{1: 2},
+		},
+		{
+			"ebooks are never packed",
+			[]models.OrderItem{item(1, models.FormatEbook, 1, 0), item(2, models.FormatPaperback, 1, 0)},
+			map[int]int{2: 1},
+		},
+		{
+			"an ebook-only order has nothing to pack",
+			[]models.OrderItem{item(1, models.FormatEbook, 2, 0)},
+			map[int]int{},
+		},
+		{
+			"fully shipped",
+			[]models.OrderItem{item(1, models.FormatHardcover, 2, 2), item(2, models.FormatEbook, 1, 0)},
+			map[int]int{},
+		},
+	}
+	for _, tt := range tests {
+		got := packingItems(models.Order{Products: tt.items})
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: packed %d items, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for _, item := range got {
+			if want, ok := tt.want[item.ID]; !ok || item.Quantity != want {
+				t.Errorf("%s: item %d packs %d, want %d", tt.name, item.ID, item.Quantity, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+var (
+	ErrGiftCardNotFound = errors.New("that gift card code is not valid")
+	ErrGiftCardEmpty    = errors.New("that gift card has no balance left")
+	ErrGiftCardCurrency = errors.New("that gift card can't be used in this currency")
+)
+
+// GenerateGiftCardCode returns a code like ABCD-EFGH-JKLM-NPQR. Base32 has no
+// 0 or 1 to mistake for O or I.
+func GenerateGiftCardCode() string {
+	bytes := make([]byte, 10)
+	rand.Read(bytes)
+	raw := base32.StdEncoding.EncodeToString(bytes)
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+}
+
+// ApplyGiftCard looks up code and fills in the gift card fields on the cart.
+// A card pays for the items after discounts, up to its balance, but not tax
+// or shipping; see GiftCardLimit. The cart's Products and DiscountCents must
+// already be set.
+func ApplyGiftCard(cart *models.Cart, code string) error {
+	g, err := db.GetGiftCardByCode(code)
+	if err != nil {
+		return ErrGiftCardNotFound
+	}
+	if g.VoidedAt != nil {
+		return db.ErrGiftCardVoided
+	}
+	if g.BalanceCents <= 0 {
+		return ErrGiftCardEmpty
+	}
+	if g.Currency != cart.Currency {
+		return ErrGiftCardCurrency
+	}
+
+	cart.GiftCardCode = g.Code
+	cart.GiftCardCents = min(g.BalanceCents, GiftCardLimit(*cart))
+	cart.GiftCard = float64(cart.GiftCardCents) / 100.0
+	return nil
+}
+
+// GiftCardLimit is the most a gift card can pay towards the cart: the items
+// after discounts. The card reaches Stripe as a coupon, and a coupon only
+// takes money off items, so tax and shipping are always paid by card. Gift
+// cards in the cart are paid by card too, so one card can't buy another.
+func GiftCardLimit(cart models.Cart) int64 {
+	var items int64
+	for _, item := range cart.Products {
+		if item.ProductType != models.ProductTypeGiftCard {
+			items += item.Variant.Cents * int64(item.Quantity)
+		}
+	}
+	return max(items-cart.DiscountCents, 0)
+}
+
+// HoldGiftCard reserves the cart's gift card amount for a checkout and returns
+// the reference the hold was recorded under.
+func HoldGiftCard(cart models.Cart) (string, error) {
+	g, err := db.GetGiftCardByCode(cart.GiftCardCode)
+	if err != nil {
+		return "", ErrGiftCardNotFound
+	}
+
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	reference := fmt.Sprintf("hold-%x", bytes)
+
+	if err := db.HoldGiftCard(g.ID, cart.GiftCardCents, reference); err != nil {
+		return "", err
+	}
+	return reference, nil
+}
+
+// IssueGiftCard creates a new gift card worth cents and emails the code to
+// email when one is given.
+func IssueGiftCard(cents int64, currency, email, note string, orderID *int) (models.GiftCard, error) {
+	g := models.GiftCard{
+		Code:         GenerateGiftCardCode(),
+		Kind:         models.GiftCardKindGiftCard,
+		Currency:     currency,
+		Email:        strings.TrimSpace(email),
+		Order_ID:     orderID,
+		Note:         note,
+		BalanceCents: cents,
+	}
+
+	var err error
+	g.ID, err = db.InsertGiftCard(g, cents)
+	if err != nil {
+		return models.GiftCard{}, err
+	}
+
+	if g.Email != "" {
+		if err := EmailGiftCard(g); err != nil {
+			return g, fmt.Errorf("gift card issued but email failed: %w", err)
+		}
+	}
+	return g, nil
+}
+
+// IssuePurchasedGiftCards creates one card for every gift card bought on the
+// order, each worth what the customer paid for it.
+func IssuePurchasedGiftCards(order models.Order) error {
+	for _, item := range order.Products {
+		variant, err := db.GetVariantByID(item.Variant_ID)
+		if err != nil {
+			return err
+		}
+		product, err := db.GetProductByID(variant.Product_ID)
+		if err != nil {
+			return err
+		}
+		if product.ProductType != models.ProductTypeGiftCard {
+			continue
+		}
+
+		for range item.Quantity {
+			note := "Purchased on order " + order.OrderNumber
+			if _, err := IssueGiftCard(item.Cents, item.Currency, order.Email, note, &order.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func EmailGiftCard(g models.GiftCard) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "You have a %s gift card worth %s %s.\n\n", Store.Name, formatCents(g.BalanceCents), g.Currency)
+	fmt.Fprintf(&body, "Gift card code: %s\n\n", g.Code)
+	fmt.Fprintf(&body, "Enter the code in your cart at %s/cart to use it.\n", Store.URL)
+
+	return SendEmail(g.Email, "Your "+Store.Name+" gift card", body.String())
+}
+
+// EmailStoreCredit tells the customer store credit was added to their account.
+func EmailStoreCredit(g models.GiftCard, cents int64) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "We've added %s %s of store credit to your %s account.\n\n", formatCents(cents), g.Currency, Store.Name)
+	fmt.Fprintf(&body, "Your balance is now %s %s.\n", formatCents(g.BalanceCents), g.Currency)
+	fmt.Fprintf(&body, "Use your store credit code %s in your cart at %s/cart.\n", g.Code, Store.URL)
+
+	return SendEmail(g.Email, "Store credit from "+Store.Name, body.String())
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func cartItem(cents int64, quantity int, productType string) models.CartItem {
+	return models.CartItem{
+		Quantity:    quantity,
+		ProductType: productType,
+		Variant:     models.Variant{Cents: cents},
+	}
+}
+
+func TestGiftCardLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		cart models.Cart
+		want int64
+	}{
+		{"empty cart", models.Cart{}, 0},
+		{
+			"items",
+			models.Cart{Products: []models.CartItem{
+				cartItem(2000, 2, models.ProductTypeBook),
+				cartItem(1500, 1, models.ProductTypeBook),
+			}},
+			5500,
+		},
+		{
+			"after a discount",
+			models.Cart{
+				Products:      []models.CartItem{cartItem(2000, 2, models.ProductTypeBook)},
+				DiscountCents: 400,
+			},
+			3600,
+		},
+		{
+			"never below zero",
+			models.Cart{
+				Products:      []models.CartItem{cartItem(1000, 1, models.ProductTypeBook)},
+				DiscountCents: 1500,
+			},
+			0,
+		},
+		{
+			"gift cards in the cart are left out",
+			models.Cart{Products: []models.CartItem{
+				cartItem(2000, 1, models.ProductTypeBook),
+				cartItem(10000, 1, models.ProductTypeGiftCard),
+			}},
+			2000,
+		},
+		{
+			"a cart of only gift cards",
+			models.Cart{Products: []models.CartItem{cartItem(5000, 2, models.ProductTypeGiftCard)}},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		if got := GiftCardLimit(tt.cart); got != tt.want {
+			t.Errorf("%s: GiftCardLimit = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPromotionsSkipGiftCards(t *testing.T) {
+	everything := models.Promotion{}
+	product := models.Promotion{ProductIDs: []int{7}}
+
+	giftCard := cartItem(10000, 1, models.ProductTypeGiftCard)
+	giftCard.Variant.Product_ID = 7
+	book := cartItem(2000, 1, models.ProductTypeBook)
+	book.Variant.Product_ID = 7
+
+	if promotionApplies(everything, giftCard) {
+		t.Error("a store-wide promotion applies to a gift card")
+	}
+	if promotionApplies(product, giftCard) {
+		t.Error("a product promotion applies to a gift card product")
+	}
+	if !promotionApplies(everything, book) || !promotionApplies(product, book) {
+		t.Error("promotions no longer apply to books")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/nathanialw/ecommerce/internal/db"
 	"github.com/nathanialw/ecommerce/pkg/models"
@@ -17,18 +18,30 @@ func GenerateShortOrderID() string {
 	return id
 }
 
-// TODO:
-func CreateOrder(orderNumber, email, address, city, postalCode, country string, items []models.OrderItem) {
-	db.InsertOrder(orderNumber, email, address, city, postalCode, country, items)
-	println("NOT IMPLEMENTED creating order: ", orderNumber)
+func CreateOrder(order models.Order) (int, error) {
+	orderID, err := db.InsertOrder(order)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Println("created order: ", order.OrderNumber)
+	CheckStockSoon()
+	return orderID, nil
 }
 
-// TODO:
-func SaveShippingAddress(name, line, city, postalCode, country string) {
-	fmt.Println("NOT IMPLEMENTED saving shipping address: ", name, line, city, postalCode, country)
-}
+// EmailOrderDetails sends the order confirmation with the invoice attached.
+func EmailOrderDetails(order models.Order) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Thank you for your order from %s!\n\n", Store.Name)
+	fmt.Fprintf(&body, "Order number: %s\n\n", order.OrderNumber)
+	for _, item := range order.Products {
+		fmt.Fprintf(&body, "%d x %s (%s)\n", item.Quantity, item.ProductTitle, item.VariantFormat)
+	}
+	fmt.Fprintf(&body, "\nYour invoice is attached. You can look up your order at %s/orders\n", Store.URL)
+
+	invoice, err := InvoicePDF(order)
+	if err != nil {
+		return err
+	}
 
-// TODO:
-func EmailOrderDetails(email string) {
-	fmt.Println("NOT IMPLEMENTED emailing order details to: ", email)
+	return SendEmail(order.Email, "Your order "+order.OrderNumber, body.String(), invoice)
 }
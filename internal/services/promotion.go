@@ -0,0 +1,125 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+var (
+	ErrPromotionNotFound = errors.New("that promotion code is not valid")
+	ErrPromotionInactive = errors.New("that promotion code is no longer active")
+	ErrPromotionNotYet   = errors.New("that promotion code is not active yet")
+	ErrPromotionExpired  = errors.New("that promotion code has expired")
+	ErrPromotionUsedUp   = errors.New("that promotion code has reached its usage limit")
+	ErrPromotionNoItems  = errors.New("no items in your cart are eligible for that promotion code")
+)
+
+// ValidatePromotion checks the validity window and usage limit of a promotion.
+func ValidatePromotion(p models.Promotion, now time.Time) error {
+	switch {
+	case !p.Active:
+		return ErrPromotionInactive
+	case now.Before(p.StartsAt):
+		return ErrPromotionNotYet
+	case p.EndsAt != nil && now.After(*p.EndsAt):
+		return ErrPromotionExpired
+	case p.UsageLimit != nil && p.TimesUsed >= *p.UsageLimit:
+		return ErrPromotionUsedUp
+	}
+	return nil
+}
+
+// ApplyPromotion looks up code and fills in the discount fields on the cart.
+// The cart's Products must already be loaded.
+func ApplyPromotion(cart *models.Cart, code string) error {
+	p, err := db.GetPromotionByCode(code)
+	if err != nil {
+		return ErrPromotionNotFound
+	}
+	return applyPromotion(cart, p, time.Now())
+}
+
+// applyPromotion checks p is usable at now and fills in the discount it gives
+// the cart.
+func applyPromotion(cart *models.Cart, p models.Promotion, now time.Time) error {
+	if err := ValidatePromotion(p, now); err != nil {
+		return err
+	}
+
+	var eligibleCents int64
+	for _, item := range cart.Products {
+		if promotionApplies(p, item) {
+			eligibleCents += item.Variant.Cents * int64(item.Quantity)
+		}
+	}
+	if eligibleCents == 0 {
+		return ErrPromotionNoItems
+	}
+
+	var discount int64
+	switch p.DiscountType {
+	case models.PromotionPercent:
+		discount = int64(math.Round(float64(eligibleCents) * float64(p.PercentOff) / 100))
+	case models.PromotionFixed:
+		cents, err := ConvertCents(p.Cents, cart.Currency)
+		if err != nil {
+			return err
+		}
+		discount = min(cents, eligibleCents)
+	case models.PromotionFreeShipping:
+		cart.FreeShipping = true
+	}
+
+	cart.PromoCode = p.Code
+	cart.DiscountCents = discount
+	cart.Discount = float64(discount) / 100.0
+	return nil
+}
+
+// HoldPromotion reserves a use of the cart's promotion code for a checkout
+// and returns the reference the hold was recorded under.
+func HoldPromotion(cart models.Cart) (string, error) {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	reference := fmt.Sprintf("promo-%x", bytes)
+
+	held, err := db.HoldPromotion(cart.PromoCode, reference)
+	if err != nil {
+		return "", err
+	}
+	if !held {
+		return "", ErrPromotionUsedUp
+	}
+	return reference, nil
+}
+
+// promotionApplies reports whether a cart item is eligible for the promotion.
+// A promotion restricted to neither products nor authors covers every item
+// but gift cards, which are issued for their full price; an author
+// restriction matches any of a book's co-authors.
+func promotionApplies(p models.Promotion, item models.CartItem) bool {
+	if item.ProductType == models.ProductTypeGiftCard {
+		return false
+	}
+	if len(p.ProductIDs) == 0 && len(p.AuthorIDs) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == item.Variant.Product_ID {
+			return true
+		}
+	}
+	for _, id := range p.AuthorIDs {
+		if slices.Contains(item.AuthorIDs, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func bookItem(productID int, cents int64, quantity int, authorIDs ...int) models.CartItem {
+	item := cartItem(cents, quantity, models.ProductTypeBook)
+	item.Variant.Product_ID = productID
+	item.AuthorIDs = authorIDs
+	return item
+}
+
+func TestApplyPromotion(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	tomorrow := now.AddDate(0, 0, 1)
+	limit := 5
+
+	promotion := func(discountType string, percent int, cents int64) models.Promotion {
+		return models.Promotion{
+			Code:         "SAVE",
+			DiscountType: discountType,
+			PercentOff:   percent,
+			Cents:        cents,
+			StartsAt:     yesterday,
+			Active:       true,
+		}
+	}
+	with := func(p models.Promotion, change func(*models.Promotion)) models.Promotion {
+		change(&p)
+		return p
+	}
+
+	books := []models.CartItem{
+		bookItem(1, 2000, 2, 10),    // 4000
+		bookItem(2, 1500, 1, 11),    // 1500
+		bookItem(3, 999, 1, 10, 12), // 999, co-authored
+	}
+
+	tests := []struct {
+		name         string
+		promotion    models.Promotion
+		items        []models.CartItem
+		wantDiscount int64
+		wantShipping bool
+		wantErr      error
+	}{
+		{
+			name:         "percent off the whole cart",
+			promotion:    promotion(models.PromotionPercent, 10, 0),
+			items:        books,
+			wantDiscount: 650, // 10% of 6499 rounds to 650
+		},
+		{
+			name:         "percent off rounds to the nearest cent",
+			promotion:    promotion(models.PromotionPercent, 15, 0),
+			items:        []models.CartItem{bookItem(1, 999, 1)},
+			wantDiscount: 150, // 149.85
+		},
+		{
+			name:         "fixed amount off",
+			promotion:    promotion(models.PromotionFixed, 0, 500),
+			items:        books,
+			wantDiscount: 500,
+		},
+		{
+			name:         "fixed amount is capped at the eligible total",
+			promotion:    promotion(models.PromotionFixed, 0, 5000),
+			items:        []models.CartItem{bookItem(1, 2000, 1)},
+			wantDiscount: 2000,
+		},
+		{
+			name:         "free shipping",
+			promotion:    promotion(models.PromotionFreeShipping, 0, 0),
+			items:        books,
+			wantShipping: true,
+		},
+		{
+			name: "restricted to a product",
+			promotion: with(promotion(models.PromotionPercent, 50, 0), func(p *models.Promotion) {
+				p.ProductIDs = []int{2}
+			}),
+			items:        books,
+			wantDiscount: 750,
+		},
+		{
+			name: "restricted to an author, matching co-authors",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.AuthorIDs = []int{10}
+			}),
+			items:        books,
+			wantDiscount: 500, // 10% of 4000 + 999
+		},
+		{
+			name: "fixed amount capped at the restricted items",
+			promotion: with(promotion(models.PromotionFixed, 0, 5000), func(p *models.Promotion) {
+				p.AuthorIDs = []int{12}
+			}),
+			items:        books,
+			wantDiscount: 999,
+		},
+		{
+			name: "product or author",
+			promotion: with(promotion(models.PromotionFixed, 0, 10000), func(p *models.Promotion) {
+				p.ProductIDs = []int{2}
+				p.AuthorIDs = []int{12}
+			}),
+			items:        books,
+			wantDiscount: 2499,
+		},
+		{
+			name: "no eligible items",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.AuthorIDs = []int{99}
+			}),
+			items:   books,
+			wantErr: ErrPromotionNoItems,
+		},
+		{
+			name:      "gift cards are never eligible",
+			promotion: promotion(models.PromotionPercent, 10, 0),
+			items:     []models.CartItem{cartItem(5000, 1, models.ProductTypeGiftCard)},
+			wantErr:   ErrPromotionNoItems,
+		},
+		{
+			name: "inactive",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.Active = false
+			}),
+			items:   books,
+			wantErr: ErrPromotionInactive,
+		},
+		{
+			name: "not started",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.StartsAt = tomorrow
+			}),
+			items:   books,
+			wantErr: ErrPromotionNotYet,
+		},
+		{
+			name: "expired",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.EndsAt = &yesterday
+			}),
+			items:   books,
+			wantErr: ErrPromotionExpired,
+		},
+		{
+			name: "ends later",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.EndsAt = &tomorrow
+			}),
+			items:        books,
+			wantDiscount: 650,
+		},
+		{
+			name: "used up",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.UsageLimit = &limit
+				p.TimesUsed = 5
+			}),
+			items:   books,
+			wantErr: ErrPromotionUsedUp,
+		},
+		{
+			name: "under its usage limit",
+			promotion: with(promotion(models.PromotionPercent, 10, 0), func(p *models.Promotion) {
+				p.UsageLimit = &limit
+				p.TimesUsed = 4
+			}),
+			items:        books,
+			wantDiscount: 650,
+		},
+	}
+	for _, tt := range tests {
+		cart := models.Cart{Products: tt.items, Currency: BaseCurrency}
+		err := applyPromotion(&cart, tt.promotion, now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if cart.PromoCode != "" || cart.DiscountCents != 0 || cart.FreeShipping {
+				t.Errorf("%s: a rejected promotion changed the cart", tt.name)
+			}
+			continue
+		}
+		if cart.DiscountCents != tt.wantDiscount {
+			t.Errorf("%s: DiscountCents = %d, want %d", tt.name, cart.DiscountCents, tt.wantDiscount)
+		}
+		if cart.FreeShipping != tt.wantShipping {
+			t.Errorf("%s: FreeShipping = %v, want %v", tt.name, cart.FreeShipping, tt.wantShipping)
+		}
+		if cart.PromoCode != tt.promotion.Code {
+			t.Errorf("%s: PromoCode = %q, want %q", tt.name, cart.PromoCode, tt.promotion.Code)
+		}
+	}
+}
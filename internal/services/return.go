@@ -0,0 +1,203 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/refund"
+)
+
+var ErrNotDelivered = errors.New("returns can only be requested once an order has been delivered")
+
+func generateRMANumber() string {
+	bytes := make([]byte, 4)
+	rand.Read(bytes)
+	return "RMA-" + hex.EncodeToString(bytes)
+}
+
+// RequestReturn opens a return for items on a delivered order. The customer
+// proves ownership the same way as the guest order lookup, with the order's
+// email and number. quantities maps order item IDs to how many are coming back.
+func RequestReturn(email, orderNumber, reason string, quantities map[int]int) (models.Return, error) {
+	order, err := db.SearchOrders(email, orderNumber)
+	if err != nil {
+		return models.Return{}, fmt.Errorf("order not found")
+	}
+	if order.Status != models.OrderStatusDelivered {
+		return models.Return{}, ErrNotDelivered
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return models.Return{}, fmt.Errorf("please tell us why you are returning these items")
+	}
+
+	ret := models.Return{
+		Order_ID:    order.ID,
+		RMANumber:   generateRMANumber(),
+		Status:      models.ReturnStatusRequested,
+		Reason:      reason,
+		OrderNumber: order.OrderNumber,
+		Email:       order.Email,
+	}
+	for _, item := range order.Products {
+		if quantities[item.ID] > 0 {
+			ret.Items = append(ret.Items, models.ReturnItem{
+				OrderItem_ID:  item.ID,
+				Quantity:      quantities[item.ID],
+				Variant_ID:    item.Variant_ID,
+				Cents:         item.Cents,
+				ProductTitle:  item.ProductTitle,
+				VariantFormat: item.VariantFormat,
+			})
+		}
+	}
+	if len(ret.Items) == 0 {
+		return models.Return{}, fmt.Errorf("choose at least one item to return")
+	}
+
+	ret.ID, err = db.InsertReturn(ret)
+	if err != nil {
+		return models.Return{}, err
+	}
+	return ret, nil
+}
+
+// ReturnRefund is what a return gives back, split by how the order was paid.
+type ReturnRefund struct {
+	Card     int64 // back to the card through Stripe
+	GiftCard int64 // back as store credit
+}
+
+func (r ReturnRefund) Total() int64 {
+	return r.Card + r.GiftCard
+}
+
+// ReturnValue is the returned items' share of what was actually paid for the
+// order's items, so promotion discounts are taken off and the part paid by
+// gift card is kept apart. GST on the items is refunded with them; shipping
+// is not. Shares round down, so several returns on one order never add up to
+// more than was paid.
+func ReturnValue(order models.Order, ret models.Return) ReturnRefund {
+	var items, returned int64
+	for _, item := range order.Products {
+		items += item.Cents * int64(item.Quantity)
+	}
+	for _, item := range ret.Items {
+		returned += item.Cents * int64(item.Quantity)
+	}
+	if items == 0 {
+		return ReturnRefund{}
+	}
+
+	charged := max(order.TotalCents-order.ShippingCents, 0)
+	return ReturnRefund{
+		Card:     charged * returned / items,
+		GiftCard: order.GiftCardCents * returned / items,
+	}
+}
+
+// RefundReturn refunds a received return the way the order was paid: the
+// card's share through Stripe and the gift card's share as store credit.
+func RefundReturn(returnID int) error {
+	ret, err := db.GetReturnByID(returnID)
+	if err != nil {
+		return err
+	}
+	if ret.Status != models.ReturnStatusReceived {
+		return fmt.Errorf("return %s has not been received", ret.RMANumber)
+	}
+	order, err := db.GetOrderByID(ret.Order_ID)
+	if err != nil {
+		return err
+	}
+	value := ReturnValue(order, ret)
+	if value.Card > 0 && order.PaymentIntent_ID == "" {
+		return fmt.Errorf("order %s has no Stripe payment to refund", order.OrderNumber)
+	}
+
+	// Claim the return first, so a second submit can't refund it again
+	if err := db.ClaimReturnRefund(ret.ID); err != nil {
+		return err
+	}
+
+	var refundID string
+	if value.Card > 0 {
+		stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+		params := &stripe.RefundParams{
+			PaymentIntent: stripe.String(order.PaymentIntent_ID),
+			Amount:        stripe.Int64(value.Card),
+			Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+		}
+		params.AddMetadata("rma_number", ret.RMANumber)
+		params.SetIdempotencyKey("return-" + ret.RMANumber)
+		re, err := refund.New(params)
+		if err != nil {
+			if err := db.ReleaseReturnRefund(ret.ID); err != nil {
+				log.Printf("Failed to release return %s after a failed refund: %v", ret.RMANumber, err)
+			}
+			return fmt.Errorf("stripe refund failed: %w", err)
+		}
+		refundID = re.ID
+	}
+
+	currency := CalcOrderTotals(order).Currency
+	giftCardID, err := db.CompleteReturn(ret.ID, value.Total(), refundID,
+		order.Email, currency, GenerateGiftCardCode(), value.GiftCard)
+	if err != nil {
+		// The card was refunded, so the return stays refunding for an admin to settle
+		return fmt.Errorf("refund %s made but return %s not recorded: %w", refundID, ret.RMANumber, err)
+	}
+	if giftCardID == 0 {
+		return nil
+	}
+
+	account, err := db.GetGiftCardByID(giftCardID)
+	if err != nil {
+		return err
+	}
+	if err := EmailStoreCredit(account, value.GiftCard); err != nil {
+		return fmt.Errorf("refunded but store credit email failed: %w", err)
+	}
+	return nil
+}
+
+// CreditReturn settles a received return as store credit on the customer's
+// account instead of a refund, and emails them the account's code.
+func CreditReturn(returnID int) error {
+	ret, err := db.GetReturnByID(returnID)
+	if err != nil {
+		return err
+	}
+	if ret.Status != models.ReturnStatusReceived {
+		return fmt.Errorf("return %s has not been received", ret.RMANumber)
+	}
+	order, err := db.GetOrderByID(ret.Order_ID)
+	if err != nil {
+		return err
+	}
+
+	cents := ReturnValue(order, ret).Total()
+	currency := CalcOrderTotals(order).Currency
+	giftCardID, err := db.CreditReturn(ret.ID, order.Email, currency, GenerateGiftCardCode(), cents)
+	if err != nil {
+		return err
+	}
+
+	account, err := db.GetGiftCardByID(giftCardID)
+	if err != nil {
+		return err
+	}
+	if err := EmailStoreCredit(account, cents); err != nil {
+		return fmt.Errorf("store credit issued but email failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func returnOf(items ...models.ReturnItem) models.Return {
+	return models.Return{Items: items}
+}
+
+func TestReturnValue(t *testing.T) {
+	// 2 x 20.00 and 1 x 15.00, with 5% GST and 10.00 shipping
+	items := []models.OrderItem{
+		{ID: 1, Cents: 2000, Quantity: 2},
+		{ID: 2, Cents: 1500, Quantity: 1},
+	}
+	one := models.ReturnItem{OrderItem_ID: 1, Cents: 2000, Quantity: 1}
+	both := models.ReturnItem{OrderItem_ID: 1, Cents: 2000, Quantity: 2}
+	other := models.ReturnItem{OrderItem_ID: 2, Cents: 1500, Quantity: 1}
+
+	tests := []struct {
+		name  string
+		order models.Order
+		ret   models.Return
+		want  ReturnRefund
+	}{
+		{
+			"whole order, shipping kept",
+			models.Order{Products: items, ShippingCents: 1000, TaxCents: 275, TotalCents: 6775},
+			returnOf(both, other),
+			ReturnRefund{Card: 5775},
+		},
+		{
+			"one item, with its GST",
+			models.Order{Products: items, ShippingCents: 1000, TaxCents: 275, TotalCents: 6775},
+			returnOf(one),
+			ReturnRefund{Card: 2100},
+		},
+		{
+			"some of the items",
+			models.Order{Products: items, ShippingCents: 1000, TaxCents: 275, TotalCents: 6775},
+			returnOf(one, other),
+			ReturnRefund{Card: 3675},
+		},
+		{
+			"promotion discount is taken off",
+			models.Order{Products: items, DiscountCents: 500, ShippingCents: 1000, TaxCents: 250, TotalCents: 6250},
+			returnOf(one),
+			ReturnRefund{Card: 1909}, // 5250 x 2000 / 5500, rounded down
+		},
+		{
+			"free shipping",
+			models.Order{Products: items, TaxCents: 275, TotalCents: 5775},
+			returnOf(other),
+			ReturnRefund{Card: 1575},
+		},
+		{
+			"partly paid by gift card",
+			models.Order{Products: items, ShippingCents: 1000, TaxCents: 275, GiftCardCents: 3000, TotalCents: 3775},
+			returnOf(one),
+			ReturnRefund{Card: 1009, GiftCard: 1090},
+		},
+		{
+			"items paid entirely by gift card",
+			models.Order{Products: items, ShippingCents: 1000, TaxCents: 275, GiftCardCents: 5500, TotalCents: 1275},
+			returnOf(both, other),
+			ReturnRefund{Card: 275, GiftCard: 5500},
+		},
+		{
+			"never negative",
+			models.Order{Products: items, ShippingCents: 1000, TotalCents: 500},
+			returnOf(one),
+			ReturnRefund{},
+		},
+		{
+			"order without items",
+			models.Order{ShippingCents: 1000, TotalCents: 1000},
+			returnOf(one),
+			ReturnRefund{},
+		},
+	}
+	for _, tt := range tests {
+		if got := ReturnValue(tt.order, tt.ret); got != tt.want {
+			t.Errorf("%s: ReturnValue = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReturnValueSeveralReturns(t *testing.T) {
+	// Three items at 33.33 each can't be split evenly
+	order := models.Order{
+		Products:      []models.OrderItem{{ID: 1, Cents: 3333, Quantity: 3}},
+		ShippingCents: 1000,
+		TaxCents:      500,
+		GiftCardCents: 2000,
+		TotalCents:    9499,
+	}
+	var refunded ReturnRefund
+	for range 3 {
+		value := ReturnValue(order, returnOf(models.ReturnItem{OrderItem_ID: 1, Cents: 3333, Quantity: 1}))
+		refunded.Card += value.Card
+		refunded.GiftCard += value.GiftCard
+	}
+	if charged := order.TotalCents - order.ShippingCents; refunded.Card > charged {
+		t.Errorf("refunded %d to the card, more than the %d charged", refunded.Card, charged)
+	}
+	if refunded.GiftCard > order.GiftCardCents {
+		t.Errorf("refunded %d to the gift card, more than the %d paid", refunded.GiftCard, order.GiftCardCents)
+	}
+}
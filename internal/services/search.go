@@ -0,0 +1,179 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// priceBucketEdges split search results into price ranges, in cents of the
+// shopper's currency.
+var priceBucketEdges = []int64{1000, 2000, 5000}
+
+// PriceBuckets returns the search price ranges for the currency, with their
+// bounds converted to the base currency.
+func PriceBuckets(currency string) ([]models.PriceBucket, error) {
+	buckets := make([]models.PriceBucket, 0, len(priceBucketEdges)+1)
+	edges := priceBucketEdges[:len(priceBucketEdges):len(priceBucketEdges)]
+	var low, lowBase int64
+	for _, edge := range append(edges, 0) {
+		b := models.PriceBucket{MinCents: lowBase}
+		if edge > 0 {
+			edgeBase, err := BaseCents(edge, currency)
+			if err != nil {
+				return nil, err
+			}
+			b.MaxCents = edgeBase - 1
+			lowBase = edgeBase
+		}
+
+		switch {
+		case low == 0:
+			b.Label = "Under " + wholeDollars(edge)
+		case edge == 0:
+			b.Label = wholeDollars(low) + " and up"
+		default:
+			b.Label = wholeDollars(low) + " – " + wholeDollars(edge)
+		}
+		b.Value = priceRange(low, edge)
+
+		buckets = append(buckets, b)
+		low = edge
+	}
+	return buckets, nil
+}
+
+func wholeDollars(cents int64) string {
+	return fmt.Sprintf("$%d", cents/100)
+}
+
+// priceRange is the search price parameter for a bucket, such as "10-20",
+// leaving out a bound that is zero.
+func priceRange(low, high int64) string {
+	var s strings.Builder
+	if low > 0 {
+		fmt.Fprint(&s, low/100)
+	}
+	s.WriteString("-")
+	if high > 0 {
+		fmt.Fprint(&s, high/100)
+	}
+	return s.String()
+}
+
+// weakResults is how few results a search can find before it offers a
+// "Did you mean" suggestion.
+const weakResults = 3
+
+// Search runs a product search priced in the shopper's currency, with each
+// result's description excerpt highlighted. Synonyms are applied to the query
+// first, and a likely correction is suggested when little is found.
+func Search(query string, f models.ProductFilter, currency string, page *models.Pagination) (models.SearchResult, error) {
+	buckets, err := PriceBuckets(currency)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+
+	expanded := ExpandSynonyms(query, cache.GetSynonyms())
+	result, err := db.SearchProducts(expanded, f, buckets, page)
+	if err != nil {
+		return result, err
+	}
+	result.Query = query
+	if expanded != strings.Join(strings.Fields(query), " ") {
+		result.Expanded = expanded
+	}
+
+	if result.Fuzzy || result.Page.Total < weakResults {
+		if result.DidYouMean, err = db.DidYouMean(expanded); err != nil {
+			log.Printf("Spelling suggestion for %q: %v", expanded, err)
+		}
+	}
+
+	if err := ApplyCurrencyToProducts(result.Products, currency); err != nil {
+		return result, err
+	}
+	for i := range result.Products {
+		result.Products[i].Snippet = Highlight(result.Snippets[result.Products[i].ID])
+	}
+	return result, nil
+}
+
+// Highlight escapes a search snippet and turns its match markers into <mark>
+// tags.
+func Highlight(snippet string) template.HTML {
+	s := html.EscapeString(snippet)
+	s = strings.ReplaceAll(s, models.SnippetStart, "<mark>")
+	s = strings.ReplaceAll(s, models.SnippetStop, "</mark>")
+	return template.HTML(s)
+}
+
+const suggestLimit = 8
+
+// Suggest completes a partly typed search from the in-memory prefix index,
+// topping up with trigram matches so misspellings still find something.
+func Suggest(query string) []models.Suggestion {
+	query = strings.TrimSpace(query)
+	suggestions := cache.Suggest(query, suggestLimit)
+	if len(suggestions) == suggestLimit || len([]rune(query)) < 3 {
+		return suggestions
+	}
+
+	fuzzy, err := db.SuggestFuzzy(query, suggestLimit)
+	if err != nil {
+		// Too slow or failed; the prefix matches will do
+		log.Printf("Fuzzy suggestions for %q: %v", query, err)
+		return suggestions
+	}
+
+	seen := make(map[string]bool, len(suggestions))
+	for _, s := range suggestions {
+		seen[s.URL] = true
+	}
+	for _, s := range fuzzy {
+		if len(suggestions) == suggestLimit {
+			break
+		}
+		if !seen[s.URL] {
+			seen[s.URL] = true
+			suggestions = append(suggestions, s)
+		}
+	}
+	return suggestions
+}
+
+// ExpandSynonyms rewrites every synonym term in the query to its expansion,
+// preferring the longest term where several start at the same word.
+func ExpandSynonyms(query string, synonyms []models.Synonym) string {
+	expansions := make(map[string]string, len(synonyms))
+	longest := 0
+	for _, s := range synonyms {
+		term := normalizeQuery(s.Term)
+		expansions[term] = s.Expansion
+		longest = max(longest, len(strings.Fields(term)))
+	}
+
+	words := strings.Fields(query)
+	var out []string
+	for i := 0; i < len(words); {
+		n := min(longest, len(words)-i)
+		for ; n > 0; n-- {
+			if expansion, ok := expansions[normalizeQuery(strings.Join(words[i:i+n], " "))]; ok {
+				out = append(out, expansion)
+				break
+			}
+		}
+		if n == 0 {
+			out = append(out, words[i])
+			n = 1
+		}
+		i += n
+	}
+	return strings.Join(out, " ")
+}
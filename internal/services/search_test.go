@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+func TestExpandSynonyms(t *testing.T) {
+	synonyms := []models.Synonym{
+		{Term: "sci fi", Expansion: "science fiction"},
+		{Term: "sci", Expansion: "science"},
+		{Term: "ya", Expansion: "young adult"},
+		{Term: "Lord of the Rings", Expansion: "tolkien"},
+		{Term: "lord of", Expansion: "master of"},
+	}
+	tests := []struct {
+		query, want string
+	}{
+		{"sci fi", "science fiction"},
+		{"sci books", "science books"},
+		{"best sci fi ya", "best science fiction young adult"},
+		{"SCI   FI", "science fiction"},
+		// The longest term wins where several start at the same word
+		{"lord of the rings", "tolkien"},
+		{"lord of the flies", "master of the flies"},
+		// Terms are matched on whole words only
+		{"scifi yard", "scifi yard"},
+		{"fi sci", "fi science"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ExpandSynonyms(tt.query, synonyms); got != tt.want {
+			t.Errorf("ExpandSynonyms(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	if got := ExpandSynonyms("sci fi", nil); got != "sci fi" {
+		t.Errorf("ExpandSynonyms with no synonyms = %q, want the query unchanged", got)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// The search logger writes searches and clicks in batches from its own
+// goroutine, so logging never holds up a request. Events that arrive while
+// the queue is full are dropped rather than waited on.
+const (
+	searchLogQueue = 1024
+	searchLogBatch = 200
+	searchLogFlush = 5 * time.Second
+)
+
+var (
+	searchLogs   = make(chan models.SearchLog, searchLogQueue)
+	searchClicks = make(chan models.SearchClick, searchLogQueue)
+)
+
+// StartSearchLogger starts the goroutine that writes out logged searches.
+func StartSearchLogger() {
+	go func() {
+		ticker := time.NewTicker(searchLogFlush)
+		defer ticker.Stop()
+
+		var searches []models.SearchLog
+		var clicks []models.SearchClick
+		flush := func() {
+			if len(searches) == 0 && len(clicks) == 0 {
+				return
+			}
+			if err := db.InsertSearchLogs(searches, clicks); err != nil {
+				log.Printf("Dropped %d searches and %d clicks: %v", len(searches), len(clicks), err)
+			}
+			searches, clicks = nil, nil
+		}
+
+		for {
+			select {
+			case s := <-searchLogs:
+				searches = append(searches, s)
+			case c := <-searchClicks:
+				clicks = append(clicks, c)
+			case <-ticker.C:
+				flush()
+				continue
+			}
+			if len(searches)+len(clicks) >= searchLogBatch {
+				flush()
+			}
+		}
+	}()
+}
+
+// NewSearchID makes up the ID a search is logged under, so result links can
+// carry it before the search has been written.
+func NewSearchID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// LogSearch queues a search to be written.
+func LogSearch(id, query string, result models.SearchResult, visitorID string) {
+	entry := models.SearchLog{
+		ID:          id,
+		Query:       normalizeQuery(query),
+		ResultCount: result.Page.Total,
+		Fuzzy:       result.Fuzzy,
+		Visitor_ID:  visitorID,
+		CreatedAt:   time.Now(),
+	}
+	select {
+	case searchLogs <- entry:
+	default:
+		log.Printf("Search log queue full, dropped search %q", entry.Query)
+	}
+}
+
+// LogSearchClick queues a click on a search result to be written.
+func LogSearchClick(searchID string, productID int) {
+	entry := models.SearchClick{Search_ID: searchID, Product_ID: productID, CreatedAt: time.Now()}
+	select {
+	case searchClicks <- entry:
+	default:
+		log.Printf("Search log queue full, dropped click on product %d", productID)
+	}
+}
+
+// normalizeQuery folds case and spacing so the report groups the same search
+// typed differently.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// VisitorID returns the random ID that ties a browser's searches to the order
+// it goes on to place, giving it one if it has none yet.
+func VisitorID(w http.ResponseWriter, r *http.Request) string {
+	session, _ := db.Store.Get(r, "session")
+	if id, ok := session.Values["visitor"].(string); ok && id != "" {
+		return id
+	}
+	id := NewSearchID()
+	session.Values["visitor"] = id
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Failed to save visitor ID: %v", err)
+	}
+	return id
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+// Carriers maps the carriers we ship with to their tracking page; %s is
+// replaced with the tracking number.
+var Carriers = map[string]string{
+	"Canada Post": "https://www.canadapost-postescanada.ca/track-reperage/en#/search?searchFor=%s",
+	"Purolator":   "https://www.purolator.com/en/shipping/tracker?pin=%s",
+	"UPS":         "https://www.ups.com/track?tracknum=%s",
+	"FedEx":       "https://www.fedex.com/fedextrack/?trknbr=%s",
+	"USPS":        "https://tools.usps.com/go/TrackConfirmAction?tLabels=%s",
+	"DHL":         "https://www.dhl.com/en/express/tracking.html?AWB=%s",
+}
+
+func TrackingURL(carrier, trackingNumber string) string {
+	format, ok := Carriers[carrier]
+	if !ok || trackingNumber == "" {
+		return ""
+	}
+	return fmt.Sprintf(format, url.QueryEscape(trackingNumber))
+}
+
+// SetTrackingURLs fills in the tracking link of each of the order's shipments.
+func SetTrackingURLs(order *models.Order) {
+	for i := range order.Shipments {
+		s := &order.Shipments[i]
+		s.TrackingURL = TrackingURL(s.Carrier, s.TrackingNumber)
+	}
+}
+
+// CreateShipment records a shipment for an order and emails the customer.
+// quantities maps order item IDs to how many of each are in the box; when it
+// is empty every stocked item still left on the order is shipped.
+func CreateShipment(orderID int, carrier, trackingNumber string, quantities map[int]int) (models.Shipment, error) {
+	order, err := db.GetOrderByID(orderID)
+	if err != nil {
+		return models.Shipment{}, err
+	}
+
+	shipment := models.Shipment{
+		Order_ID:       orderID,
+		Carrier:        strings.TrimSpace(carrier),
+		TrackingNumber: strings.TrimSpace(trackingNumber),
+	}
+	for _, item := range order.Products {
+		if !models.Stocked(item.VariantFormat) {
+			continue
+		}
+		quantity := item.Quantity - item.ShippedQuantity
+		if len(quantities) > 0 {
+			quantity = quantities[item.ID]
+		}
+		if quantity > 0 {
+			shipment.Items = append(shipment.Items, models.ShipmentItem{
+				OrderItem_ID:  item.ID,
+				Quantity:      quantity,
+				ProductTitle:  item.ProductTitle,
+				VariantFormat: item.VariantFormat,
+			})
+		}
+	}
+	if len(shipment.Items) == 0 {
+		return models.Shipment{}, fmt.Errorf("nothing left to ship on order %s", order.OrderNumber)
+	}
+
+	shipment.ID, err = db.InsertShipment(shipment)
+	if err != nil {
+		return models.Shipment{}, err
+	}
+	shipment.TrackingURL = TrackingURL(shipment.Carrier, shipment.TrackingNumber)
+
+	if err := EmailShipmentNotice(order, shipment); err != nil {
+		return shipment, fmt.Errorf("shipment saved but notification failed: %w", err)
+	}
+	return shipment, nil
+}
+
+// EmailShipmentNotice tells the customer part or all of their order is on its way.
+func EmailShipmentNotice(order models.Order, shipment models.Shipment) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Good news! Items from your %s order %s have shipped.\n\n", Store.Name, order.OrderNumber)
+	for _, item := range shipment.Items {
+		fmt.Fprintf(&body, "%d x %s (%s)\n", item.Quantity, item.ProductTitle, item.VariantFormat)
+	}
+	fmt.Fprintf(&body, "\nCarrier: %s\n", shipment.Carrier)
+	if shipment.TrackingNumber != "" {
+		fmt.Fprintf(&body, "Tracking number: %s\n", shipment.TrackingNumber)
+	}
+	if shipment.TrackingURL != "" {
+		fmt.Fprintf(&body, "Track your package: %s\n", shipment.TrackingURL)
+	}
+
+	return SendEmail(order.Email, "Your order "+order.OrderNumber+" has shipped", body.String())
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nathanialw/ecommerce/internal/db"
+)
+
+// stockCheckInterval is how often stock is checked when nothing asks sooner,
+// which catches changes made outside the app.
+const stockCheckInterval = time.Hour
+
+// stockChecks holds a pending request to check stock; one is enough however
+// many movements asked for it.
+var stockChecks = make(chan struct{}, 1)
+
+// StartStockAlerts starts the goroutine that emails ADMIN_EMAIL, or the
+// store's address without one, when variants fall below their reorder
+// threshold. Each variant alerts once until it is restocked.
+func StartStockAlerts() {
+	go func() {
+		ticker := time.NewTicker(stockCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			checkLowStock()
+			select {
+			case <-stockChecks:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CheckStockSoon asks for a low stock check after stock has moved. It never
+// blocks.
+func CheckStockSoon() {
+	select {
+	case stockChecks <- struct{}{}:
+	default:
+	}
+}
+
+func checkLowStock() {
+	if err := db.ClearRestockedAlerts(); err != nil {
+		log.Printf("Failed to clear restocked alerts: %v", err)
+	}
+	items, err := db.GetUnalertedLowStock()
+	if err != nil {
+		log.Printf("Failed to check low stock: %v", err)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	var body strings.Builder
+	body.WriteString("These are now below their reorder threshold:\n\n")
+	ids := make([]int, len(items))
+	for n, i := range items {
+		ids[n] = i.Variant_ID
+		fmt.Fprintf(&body, "%s (%s, %s): %d left, reorder below %d\n", i.Title, i.Format, i.ISBN, i.Stock, i.Threshold)
+	}
+	fmt.Fprintf(&body, "\nSee what to reorder at %s/admin/reorder\n", Store.URL)
+
+	to := envOr("ADMIN_EMAIL", Store.Email)
+	subject := fmt.Sprintf("Low stock: %d to reorder", len(items))
+	if err := SendEmail(to, subject, body.String()); err != nil {
+		log.Printf("Failed to send low stock alert: %v", err)
+		return
+	}
+	if err := db.MarkLowStockAlerted(ids); err != nil {
+		log.Printf("Failed to mark low stock alerted: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package services
+
+import "os"
+
+// StoreDetails is printed on invoices, packing slips and outgoing email.
+type StoreDetails struct {
+	Name      string
+	Address   []string
+	Email     string
+	Phone     string
+	TaxNumber string
+	URL       string
+}
+
+var Store = StoreDetails{
+	Name:      envOr("STORE_NAME", "Book Seller"),
+	Address:   []string{envOr("STORE_ADDRESS_LINE1", ""), envOr("STORE_ADDRESS_LINE2", "")},
+	Email:     envOr("STORE_EMAIL", ""),
+	Phone:     envOr("STORE_PHONE", ""),
+	TaxNumber: envOr("STORE_GST_NUMBER", ""),
+	URL:       envOr("STORE_URL", "http://127.0.0.1:6600"),
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,110 @@
+// Package storage keeps product media in a local directory or an
+// S3-compatible bucket, chosen by environment variables, so several app
+// instances can share the same files.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/pkg/models"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid file name")
+)
+
+// Storage stores files under flat keys such as "<sha256>-thumb.webp".
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+	// List calls fn with every key in the store.
+	List(ctx context.Context, fn func(key string) error) error
+	// URL is where browsers and Stripe fetch the file from.
+	URL(key string) string
+}
+
+// Config picks and configures a Storage. See ConfigFromEnv for the variables
+// each field is read from.
+type Config struct {
+	Driver string // "local" or "s3"
+
+	Dir     string
+	BaseURL string
+
+	Endpoint  string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+	PublicURL string
+}
+
+// ConfigFromEnv reads MEDIA_STORAGE ("local", the default, or "s3"), then
+// MEDIA_DIR and MEDIA_URL for local storage or the S3_* variables for a
+// bucket. S3_PUBLIC_URL is the bucket's public address, such as a CDN; by
+// default files are linked straight from the endpoint.
+func ConfigFromEnv() Config {
+	return Config{
+		Driver:    envOr("MEDIA_STORAGE", "local"),
+		Dir:       envOr("MEDIA_DIR", "static/img"),
+		BaseURL:   envOr("MEDIA_URL", "/static/img/"),
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_SECRET_KEY"),
+		Region:    os.Getenv("S3_REGION"),
+		UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		PublicURL: os.Getenv("S3_PUBLIC_URL"),
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// New opens the storage described by config.
+func New(config Config) (Storage, error) {
+	switch config.Driver {
+	case "local":
+		return NewLocal(config.Dir, config.BaseURL), nil
+	case "s3":
+		return NewS3(config)
+	default:
+		return nil, errors.New("unknown media storage " + config.Driver)
+	}
+}
+
+// Default is the store the app reads and writes media through.
+var Default Storage = NewLocal("static/img", "/static/img/")
+
+// Init opens the storage configured in the environment as Default, and makes
+// image URLs in templates point at it.
+func Init() error {
+	s, err := New(ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	Default = s
+	models.ImageURL = s.URL
+	return nil
+}
+
+// validKey rejects keys that could reach outside the store.
+func validKey(key string) error {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") || strings.ContainsAny(key, `/\`) {
+		return ErrInvalidKey
+	}
+	return nil
+}
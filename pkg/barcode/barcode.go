@@ -0,0 +1,28 @@
+// Package barcode validates EAN-13 and UPC-A product barcodes and converts
+// them to a single EAN-13 form for storage and lookups.
+package barcode
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nathanialw/ecommerce/pkg/isbn"
+)
+
+var ErrInvalid = errors.New("invalid barcode")
+
+// Normalize strips hyphens and spaces from s, checks its check digit and
+// returns it as EAN-13 digits. A 12-digit UPC-A gets a leading zero, which
+// is how EAN-13 encodes it.
+func Normalize(s string) (string, error) {
+	s = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s))
+	if len(s) == 12 {
+		s = "0" + s
+	}
+	// An ISBN-13 is an EAN-13 in the 978 and 979 ranges, so the check digit
+	// is worked out the same way
+	if !isbn.Valid13(s) {
+		return "", ErrInvalid
+	}
+	return s, nil
+}
@@ -0,0 +1,28 @@
+package barcode
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"4006381333931", "4006381333931", false}, // EAN-13
+		{"9780306406157", "9780306406157", false}, // ISBN-13 is an EAN-13
+		{"036000291452", "0036000291452", false},  // UPC-A gets a leading zero
+		{"0-36000-29145-2", "0036000291452", false},
+		{" 4006 3813 3393 1 ", "4006381333931", false},
+		{"4006381333932", "", true}, // wrong check digit
+		{"036000291453", "", true},  // wrong UPC-A check digit
+		{"40063813339", "", true},   // too short
+		{"400638133393A", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
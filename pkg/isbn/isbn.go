@@ -0,0 +1,79 @@
+// Package isbn validates ISBN-10 and ISBN-13 numbers and converts them to a
+// single ISBN-13 form for storage and lookups.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid ISBN")
+
+// Normalize strips hyphens and spaces from s, checks its check digit and
+// returns it as ISBN-13 digits. ISBN-10s are converted with the 978 prefix.
+func Normalize(s string) (string, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s)))
+	switch {
+	case len(s) == 10 && Valid10(s):
+		return To13(s), nil
+	case len(s) == 13 && Valid13(s):
+		return s, nil
+	}
+	return "", ErrInvalid
+}
+
+// Valid10 reports whether s is ten characters with a correct ISBN-10 check
+// digit. The check digit may be X, standing for 10.
+func Valid10(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case (c == 'X' || c == 'x') && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += d * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+// Valid13 reports whether s is thirteen digits with a correct ISBN-13 check digit.
+func Valid13(s string) bool {
+	if len(s) != 13 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 13; i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// To13 converts a valid ISBN-10 to its ISBN-13 equivalent.
+func To13(s string) string {
+	digits := "978" + s[:9]
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return digits + string(rune('0'+(10-sum%10)%10))
+}
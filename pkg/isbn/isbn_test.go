@@ -0,0 +1,79 @@
+package isbn
+
+import "testing"
+
+func TestValid10(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"0306406152", true},
+		{"080442957X", true},
+		{"080442957x", true},
+		{"0306406153", false}, // wrong check digit
+		{"X306406152", false}, // X only as the check digit
+		{"030640615", false},
+		{"03064061520", false},
+	}
+	for _, tt := range tests {
+		if got := Valid10(tt.in); got != tt.want {
+			t.Errorf("Valid10(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValid13(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"9780306406157", true},
+		{"9791032305690", true},
+		{"9780306406158", false}, // wrong check digit
+		{"978030640615X", false},
+		{"978030640615", false},
+	}
+	for _, tt := range tests {
+		if got := Valid13(tt.in); got != tt.want {
+			t.Errorf("Valid13(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTo13(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0306406152", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"0198526636", "9780198526636"},
+	}
+	for _, tt := range tests {
+		if got := To13(tt.in); got != tt.want {
+			t.Errorf("To13(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"978-0-306-40615-7", "9780306406157", false},
+		{" 9780306406157 ", "9780306406157", false},
+		{"0-306-40615-2", "9780306406157", false},
+		{"0 8044 2957 x", "9780804429573", false},
+		{"978-0-306-40615-8", "", true},
+		{"0-306-40615-3", "", true},
+		{"", "", true},
+		{"not an isbn", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nathanialw/ecommerce/internal/cache"
+	"github.com/nathanialw/ecommerce/internal/catalog"
 	"github.com/nathanialw/ecommerce/internal/db"
 	"github.com/nathanialw/ecommerce/internal/migrations"
+	"github.com/nathanialw/ecommerce/internal/services"
+	"github.com/nathanialw/ecommerce/internal/storage"
 	"github.com/nathanialw/ecommerce/pkg/models"
 	"github.com/nathanialw/ecommerce/pkg/routes"
 )
@@ -27,10 +30,18 @@ func Run() (*mux.Router, *pgxpool.Pool) {
 	gob.Register([]models.CartItem{})
 
 	db := db.InitDB()
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to open media storage: %v", err)
+	}
 	if err := cache.LoadCache(); err != nil {
 		log.Fatalf("Failed to load genres: %v", err)
 	}
 
+	services.StartSearchLogger()
+	catalog.StartImporter()
+	catalog.StartPublisher()
+	services.StartStockAlerts()
+
 	r := routes.SetupRoutes()
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
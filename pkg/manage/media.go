@@ -0,0 +1,59 @@
+package manage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"path/filepath"
+
+	"github.com/nathanialw/ecommerce/internal/storage"
+)
+
+// MigrateMedia copies every file in from that to doesn't already have, such
+// as when moving from local files to a bucket. With remove set, files are
+// deleted from from once they are safely in to.
+func MigrateMedia(ctx context.Context, from, to storage.Storage, remove bool) error {
+	var copied, skipped int
+	err := from.List(ctx, func(key string) error {
+		exists, err := to.Exists(ctx, key)
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", key, err)
+		}
+		if exists {
+			skipped++
+		} else {
+			if err := copyMedia(ctx, from, to, key); err != nil {
+				return err
+			}
+			copied++
+		}
+
+		if remove {
+			if err := from.Delete(ctx, key); err != nil {
+				return fmt.Errorf("removing %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	log.Printf("Copied %d media files, %d were already there", copied, skipped)
+	return err
+}
+
+func copyMedia(ctx context.Context, from, to storage.Storage, key string) error {
+	r, err := from.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", key, err)
+	}
+	defer r.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// Size is unknown up front; the S3 client streams in parts
+	if err := to.Put(ctx, key, r, -1, contentType); err != nil {
+		return fmt.Errorf("writing %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Address struct {
+	ID         int
+	Name       string
+	Line1      string
+	Line2      string
+	City       string
+	State      string
+	PostalCode string
+	Country    string
+	Phone      string
+	CreatedAt  time.Time
+}
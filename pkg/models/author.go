@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+var ContributorRoles = []string{RoleAuthor, RoleEditor, RoleTranslator, RoleIllustrator}
+
+type Author struct {
+	ID        int
+	Name      string
+	Slug      string
+	Bio       string
+	CreatedAt time.Time
+}
+
+// Contributor links an author to a product in some role. A book can have
+// several contributors, and the same person in more than one role.
+type Contributor struct {
+	Product_ID int //`foreign:Product(ID)`
+	Author_ID  int //`foreign:Author(ID)`
+	Role       string
+	Position   int
+	//not to be  stored in db
+	Name string
+	Slug string
+}
@@ -11,7 +11,10 @@ type CartItem struct {
 	CreatedAt  time.Time
 
 	//not to be  stored in db
-	Variant Variant
+	Variant     Variant
+	Author      string
+	AuthorIDs   []int
+	ProductType string
 }
 
 type Cart struct {
@@ -22,5 +25,17 @@ type Cart struct {
 	CreatedAt time.Time
 
 	//not to be  stored in db
-	Products []CartItem
+	Products      []CartItem
+	Currency      string
+	PromoCode     string
+	Discount      float64
+	DiscountCents int64
+	TaxCents      int64
+	FreeShipping  bool
+	PromoError    string
+	GiftCardCode  string
+	GiftCardCents int64
+	GiftCard      float64
+	GiftCardError string
+	AmountDue     float64
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type Category struct {
+	ID          int
+	Parent_ID   *int //`foreign:Category(ID)`
+	Name        string
+	Slug        string
+	Description string
+	Position    int
+	CreatedAt   time.Time
+	//not to be  stored in db
+	Children     []Category
+	ProductCount int
+}
+
+type Tag struct {
+	ID        int
+	Name      string
+	Slug      string
+	CreatedAt time.Time
+	//not to be  stored in db
+	ProductCount int
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type ExchangeRate struct {
+	Currency     string
+	Rate         float64
+	CharmPricing bool
+	UpdatedAt    time.Time
+}
+
+type VariantPrice struct {
+	Variant_ID int
+	Currency   string
+	Cents      int64
+}
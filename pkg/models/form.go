@@ -0,0 +1,40 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// FieldErrors maps form field names to what is wrong with their values, for
+// showing next to the fields when a form is sent back. Fields repeated per
+// row are named with the row index, such as "price[2]".
+type FieldErrors map[string]string
+
+// Add records a problem with a field, keeping the first one reported.
+func (e FieldErrors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// Get returns the problem with a field, or "" when there is none.
+func (e FieldErrors) Get(field string) string {
+	return e[field]
+}
+
+func (e FieldErrors) Has(field string) bool {
+	_, ok := e[field]
+	return ok
+}
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		fields[i] = field + ": " + e[field]
+	}
+	return strings.Join(fields, "; ")
+}
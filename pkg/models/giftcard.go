@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+const (
+	GiftCardKindGiftCard    = "gift_card"
+	GiftCardKindStoreCredit = "store_credit"
+)
+
+// Ledger entry types. Issue, credit and release add to a card's balance;
+// redeem and void take from it.
+const (
+	GiftCardEntryIssue   = "issue"
+	GiftCardEntryCredit  = "credit"
+	GiftCardEntryRedeem  = "redeem"
+	GiftCardEntryRelease = "release"
+	GiftCardEntryVoid    = "void"
+)
+
+type GiftCard struct {
+	ID        int
+	Code      string
+	Kind      string
+	Currency  string
+	Email     string
+	Order_ID  *int //`foreign:Order(ID)`
+	Note      string
+	VoidedAt  *time.Time
+	CreatedAt time.Time
+	//not to be  stored in db
+	BalanceCents int64
+	Entries      []GiftCardEntry
+}
+
+type GiftCardEntry struct {
+	ID            int
+	GiftCard_ID   int //`foreign:GiftCard(ID)`
+	EntryType     string
+	Cents         int64
+	Order_ID      *int
+	Return_ID     *int
+	HoldReference string
+	Note          string
+	CreatedAt     time.Time
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Image sizes rendered for every upload.
+const (
+	ImageThumb  = "thumb"
+	ImageGrid   = "grid"
+	ImageDetail = "detail"
+)
+
+// hashedImage matches the names uploads are stored under: the SHA-256 of the
+// uploaded file with the extension of the full-size copy.
+var hashedImage = regexp.MustCompile(`^[0-9a-f]{64}\.jpg$`)
+
+// IsHashedImage reports whether name came through the upload pipeline, and so
+// has resized and WebP copies, rather than being an older direct upload.
+func IsHashedImage(name string) bool {
+	return hashedImage.MatchString(name)
+}
+
+// ImageFile returns the file name of one size of an image in the given
+// format, "jpg" or "webp". Older uploads only exist at their original size.
+func ImageFile(name, size, format string) string {
+	if !IsHashedImage(name) {
+		return name
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + "-" + size + "." + format
+}
+
+// ImageURL turns a stored image name into the address it is served from.
+// storage.Init points it at the configured media storage.
+var ImageURL = func(name string) string {
+	return "/static/img/" + name
+}
+
+func imageURL(name, size string) string {
+	if name == "" {
+		return ""
+	}
+	return ImageURL(ImageFile(name, size, "jpg"))
+}
+
+func webPURL(name, size string) string {
+	if !IsHashedImage(name) {
+		return ""
+	}
+	return ImageURL(ImageFile(name, size, "webp"))
+}
+
+// ImageURL returns where the variant's image is served at the given size as
+// a JPEG.
+func (v Variant) ImageURL(size string) string {
+	return imageURL(v.ImagePath, size)
+}
+
+// WebPURL returns where the variant's image is served at the given size as
+// WebP, or "" when it has none.
+func (v Variant) WebPURL(size string) string {
+	return webPURL(v.ImagePath, size)
+}
+
+// ProductImage is one picture in a product's gallery. Images with a variant
+// are shown when that variant is chosen; the rest are shown for all of them.
+type ProductImage struct {
+	ID         int
+	Product_ID int
+	Variant_ID *int
+	ImagePath  string
+	AltText    string
+	Position   int
+	IsPrimary  bool
+	CreatedAt  time.Time
+}
+
+func (i ProductImage) URL(size string) string {
+	return imageURL(i.ImagePath, size)
+}
+
+func (i ProductImage) WebPURL(size string) string {
+	return webPURL(i.ImagePath, size)
+}
+
+// ImagesFor returns the gallery for a variant: the primary image first, then
+// the variant's own images and the shared ones in their set order. A
+// variantID of 0 gives only the shared images.
+func (p Product) ImagesFor(variantID int) []ProductImage {
+	var gallery []ProductImage
+	for _, img := range p.Images {
+		if img.Variant_ID == nil || *img.Variant_ID == variantID {
+			if img.IsPrimary {
+				gallery = append([]ProductImage{img}, gallery...)
+			} else {
+				gallery = append(gallery, img)
+			}
+		}
+	}
+	return gallery
+}
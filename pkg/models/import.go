@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Catalog import file formats.
+const (
+	ImportCSV  = "csv"
+	ImportONIX = "onix"
+)
+
+// Import job statuses.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// What an import did with a row.
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+	ImportError  = "error"
+)
+
+// ImportJob is a catalog import running in the background. A dry run checks
+// every row and reports what it would do without saving anything.
+type ImportJob struct {
+	ID         int
+	Format     string
+	Filename   string
+	Data       []byte
+	DryRun     bool
+	Status     string
+	Total      int
+	Processed  int
+	Created    int
+	Updated    int
+	Failed     int
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+	//not to be  stored in db
+	Rows []ImportRow
+}
+
+// Finished reports whether the job has stopped, successfully or not.
+func (j ImportJob) Finished() bool {
+	return j.Status == JobDone || j.Status == JobFailed
+}
+
+// Percent is how far through its rows the job is.
+func (j ImportJob) Percent() int {
+	if j.Total == 0 {
+		if j.Finished() {
+			return 100
+		}
+		return 0
+	}
+	return j.Processed * 100 / j.Total
+}
+
+// ImportRow is the outcome of one row of an import. Key is the ISBN or SKU
+// the row was matched on.
+type ImportRow struct {
+	Job_ID  int
+	Line    int
+	Action  string
+	Key     string
+	Title   string
+	Message string
+}
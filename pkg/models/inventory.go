@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// Location kinds
+const (
+	LocationWarehouse   = "warehouse"
+	LocationShop        = "shop"
+	LocationConsignment = "consignment"
+)
+
+var LocationKinds = []string{LocationWarehouse, LocationShop, LocationConsignment}
+
+// Location is somewhere stock is kept. Only stock at sellable locations is
+// offered in the storefront.
+type Location struct {
+	ID        int
+	Name      string
+	Kind      string
+	Sellable  bool
+	CreatedAt time.Time
+}
+
+// Stock movement kinds
+const (
+	MovementReceipt    = "receipt"
+	MovementSale       = "sale"
+	MovementAdjustment = "adjustment"
+	MovementReturn     = "return"
+	MovementTransfer   = "transfer"
+)
+
+// StockMovement is one entry in the stock ledger: stock arriving at or
+// leaving a location. Quantity is negative for stock leaving.
+type StockMovement struct {
+	ID          int
+	Variant_ID  int //`foreign:Variant(ID)`
+	Location_ID int //`foreign:Location(ID)`
+	Kind        string
+	Quantity    int
+	Order_ID    *int //`foreign:Order(ID)`
+	Return_ID   *int //`foreign:Return(ID)`
+	Transfer_ID *int //`foreign:StockTransfer(ID)`
+	Note        string
+	CreatedAt   time.Time
+	//not to be  stored in db
+	LocationName string
+}
+
+// StockLevel is the quantity of a variant at one location.
+type StockLevel struct {
+	Location Location
+	Quantity int
+}
+
+// StockDiscrepancy is a variant whose stored stock doesn't match its ledger.
+type StockDiscrepancy struct {
+	Variant_ID int
+	Title      string
+	Format     string
+	Stock      int
+	Ledger     int
+}
+
+// Stocked reports whether sales of a format take stock off the shelf. Ebooks
+// and gift cards, which are sold as ebooks, are never out of stock.
+func Stocked(format string) bool {
+	return format == FormatHardcover || format == FormatPaperback
+}
+
+// ReorderItem is a variant whose stock is below its reorder threshold, with
+// its sales over the report's window.
+type ReorderItem struct {
+	Variant_ID int
+	Product_ID int
+	Title      string
+	Format     string
+	ISBN       string
+	SKU        string
+	Stock      int
+	Threshold  int
+	Sold       int // units sold in the window
+	AlertedAt  *time.Time
+	//not to be  stored in db
+	PerDay    float64 // units sold per day in the window
+	DaysLeft  float64 // days until the stock runs out at that rate, or -1 when nothing sold
+	Suggested int     // units to order to cover the threshold or the window's sales
+}
@@ -2,28 +2,59 @@ package models
 
 import "time"
 
+const (
+	OrderStatusPaid             = "paid"
+	OrderStatusPartiallyShipped = "partially_shipped"
+	OrderStatusShipped          = "shipped"
+	OrderStatusDelivered        = "delivered"
+	OrderStatusCancelled        = "cancelled"
+)
+
 type Order struct {
-	ID          int
-	OrderNumber string
-	Email       string
-	Address     string
-	City        string
-	PostalCode  string
-	Country     string
-	CreatedAt   time.Time
+	ID                 int
+	OrderNumber        string
+	Status             string
+	PaymentIntent_ID   string
+	CheckoutSession_ID string
+	Email              string
+	Address            string
+	City               string
+	PostalCode         string
+	Country            string
+	Phone              string
+	ShippingAddress_ID int
+	BillingAddress_ID  int
+	PromotionCode      string
+	DiscountCents      int64
+	ShippingCents      int64
+	TaxCents           int64
+	TotalCents         int64
+	GiftCardCents      int64
+	Visitor_ID         string
+	CreatedAt          time.Time
 	//not to be  stored in db
-	Products []OrderItem
+	Products        []OrderItem
+	Discount        float64
+	ShippingAddress Address
+	BillingAddress  Address
+	Shipments       []Shipment
+	Returns         []Return
+	GiftCardHold    string
+	PromotionHold   string
 }
 
 type OrderItem struct {
-	ID           int
-	Order_ID     int
-	Variant_ID   int
-	Quantity     int
-	Cents        int64
-	ProductTitle string
-	VariantColor string
-	CreatedAt    time.Time
+	ID            int
+	Order_ID      int
+	Variant_ID    int
+	Quantity      int
+	Cents         int64
+	Currency      string
+	ProductTitle  string
+	VariantFormat string
+	CreatedAt     time.Time
 	//not to be  stored in db
-	Price float64
+	Price            float64
+	ShippedQuantity  int
+	ReturnedQuantity int
 }
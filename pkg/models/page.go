@@ -0,0 +1,58 @@
+package models
+
+// Pagination describes one page of a longer listing.
+type Pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+}
+
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+func (p Pagination) TotalPages() int {
+	if p.PageSize <= 0 {
+		return 0
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p Pagination) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+func (p Pagination) PrevPage() int {
+	return p.Page - 1
+}
+
+func (p Pagination) NextPage() int {
+	return p.Page + 1
+}
+
+// Product listing sort orders.
+const (
+	SortRelevance = "relevance"
+	SortTitle     = "title"
+	SortAuthor    = "author"
+	SortNewest    = "newest"
+	SortPriceLow  = "price"
+	SortPriceHigh = "price_desc"
+)
+
+var ProductSorts = []string{SortTitle, SortAuthor, SortNewest, SortPriceLow, SortPriceHigh}
+
+// ProductFilter narrows the product listing. Zero values don't filter; prices
+// are cents in the base currency.
+type ProductFilter struct {
+	Author   string // author slug
+	Format   string
+	MinCents int64
+	MaxCents int64
+	InStock  bool
+	Sort     string
+}
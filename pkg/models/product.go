@@ -1,28 +1,97 @@
 package models
 
-import "time"
+import (
+	"html/template"
+	"time"
+)
+
+const (
+	ProductTypeBook     = "book"
+	ProductTypeGiftCard = "gift_card"
+)
+
+// Variant formats. Gift cards are sold as ebooks, since they are delivered by
+// email.
+const (
+	FormatHardcover = "hardcover"
+	FormatPaperback = "paperback"
+	FormatEbook     = "ebook"
+)
+
+var Formats = []string{FormatHardcover, FormatPaperback, FormatEbook}
+
+// Publication statuses. Only published products are shown in the storefront;
+// a scheduled one is published once its PublishAt has passed.
+const (
+	StatusDraft       = "draft"
+	StatusScheduled   = "scheduled"
+	StatusPublished   = "published"
+	StatusUnpublished = "unpublished"
+)
+
+var PublicationStatuses = []string{StatusDraft, StatusScheduled, StatusPublished, StatusUnpublished}
 
 type Product struct {
-	ID          int
-	Title       string
-	Author      string
-	Description string
-	CreatedAt   time.Time
+	ID              int
+	Title           string
+	Author          string
+	Description     string
+	ProductType     string
+	Publisher       string
+	PublicationDate *time.Time
+	Language        string
+	PageCount       int
+	Series          string
+	SeriesVolume    int
+	Version         int
+	Status          string
+	PublishAt       *time.Time
+	ArchivedAt      *time.Time
+	CreatedAt       time.Time
 	//not to be  stored in db
 	LowestPrice float64
+	Currency    string
 	Type0       string
+	Snippet     template.HTML
+	// Preview is set when an admin views a product the storefront doesn't show
+	Preview bool
+
+	Variants     []Variant
+	Contributors []Contributor
+	Categories   []Category
+	Tags         []Tag
+	Breadcrumbs  []Category
+	Images       []ProductImage
+	PrimaryImage ProductImage
+}
 
-	Variants []Variant
+// OnSale reports whether the storefront shows the product.
+func (p Product) OnSale() bool {
+	return p.Status == StatusPublished && p.ArchivedAt == nil
 }
 
 type Variant struct {
 	ID         int
 	Product_ID int //`foreign:Product(ID)` //or just Product_ID
-	Color      string
+	Format     string
+	ISBN       string
+	SKU        string
+	Barcode    string
 	ImagePath  string
 	Cents      int64
-	Stock      int
-	CreatedAt  time.Time
+	Stock      int // sellable stock, kept from the stock ledger
+	// ReorderThreshold is the stock below which the variant is reordered
+	ReorderThreshold  int
+	LowStockAlertedAt *time.Time
+	ArchivedAt        *time.Time
+	CreatedAt         time.Time
 	//not to be  stored in db
-	Price float64
+	Price    float64
+	Currency string
+	Prices   map[string]int64
+	Levels   []StockLevel
+	// StockShown is the stock the product form was loaded with. Saving moves
+	// stock by Stock minus it, so sales made meanwhile are kept; nil leaves
+	// the stock of an existing variant alone.
+	StockShown *int
 }
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	PromotionPercent      = "percent"
+	PromotionFixed        = "fixed"
+	PromotionFreeShipping = "free_shipping"
+)
+
+type Promotion struct {
+	ID           int
+	Code         string
+	DiscountType string
+	PercentOff   int
+	Cents        int64
+	StartsAt     time.Time
+	EndsAt       *time.Time
+	UsageLimit   *int
+	TimesUsed    int
+	Active       bool
+	CreatedAt    time.Time
+	//not to be  stored in db
+	ProductIDs []int
+	AuthorIDs  []int
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunding = "refunding" // claimed while the Stripe refund is made
+	ReturnStatusRefunded  = "refunded"
+	ReturnStatusCredited  = "credited"
+)
+
+type Return struct {
+	ID              int
+	Order_ID        int
+	RMANumber       string
+	Status          string
+	Reason          string
+	AdminNote       string
+	RefundCents     int64
+	StripeRefund_ID string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	//not to be  stored in db
+	OrderNumber string
+	Email       string
+	Items       []ReturnItem
+}
+
+type ReturnItem struct {
+	ID           int
+	Return_ID    int
+	OrderItem_ID int
+	Quantity     int
+	Resellable   bool
+	//not to be  stored in db
+	Variant_ID    int
+	Cents         int64
+	ProductTitle  string
+	VariantFormat string
+}
@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+// ProductRevision is a product as it was saved at one version.
+type ProductRevision struct {
+	ID         int
+	Product_ID int //`foreign:Product(ID)`
+	Version    int
+	// Note says what made the save, such as a revert
+	Note      string
+	Snapshot  ProductSnapshot
+	CreatedAt time.Time
+	//not to be  stored in db
+	Changes []FieldChange
+}
+
+// ProductSnapshot is the editable part of a product and its variants, stored
+// as JSON with each revision.
+type ProductSnapshot struct {
+	Title           string            `json:"title"`
+	Author          string            `json:"author"`
+	Description     string            `json:"description"`
+	ProductType     string            `json:"product_type"`
+	Publisher       string            `json:"publisher"`
+	PublicationDate *time.Time        `json:"publication_date,omitempty"`
+	Language        string            `json:"language"`
+	PageCount       int               `json:"page_count"`
+	Series          string            `json:"series"`
+	SeriesVolume    int               `json:"series_volume"`
+	Status          string            `json:"status"`
+	PublishAt       *time.Time        `json:"publish_at,omitempty"`
+	Contributors    []SnapshotCredit  `json:"contributors"`
+	Category_IDs    []int             `json:"category_ids"`
+	Tags            []string          `json:"tags"`
+	Variants        []VariantSnapshot `json:"variants"`
+}
+
+type SnapshotCredit struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type VariantSnapshot struct {
+	ID        int              `json:"id"`
+	Format    string           `json:"format"`
+	ISBN      string           `json:"isbn"`
+	SKU       string           `json:"sku,omitempty"`
+	Barcode   string           `json:"barcode,omitempty"`
+	Cents     int64            `json:"cents"`
+	Stock     int              `json:"stock"`
+	ImagePath string           `json:"image_path"`
+	Prices    map[string]int64 `json:"prices,omitempty"`
+}
+
+// FieldChange is one field that differs between two revisions. Before is
+// empty for something added and After for something removed.
+type FieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// SnapshotOf takes the snapshot of a product as the admin form saves it.
+func SnapshotOf(p Product) ProductSnapshot {
+	s := ProductSnapshot{
+		Title:           p.Title,
+		Author:          p.Author,
+		Description:     p.Description,
+		ProductType:     p.ProductType,
+		Publisher:       p.Publisher,
+		PublicationDate: p.PublicationDate,
+		Language:        p.Language,
+		PageCount:       p.PageCount,
+		Series:          p.Series,
+		SeriesVolume:    p.SeriesVolume,
+		Status:          p.Status,
+		PublishAt:       p.PublishAt,
+	}
+	for _, c := range p.Contributors {
+		s.Contributors = append(s.Contributors, SnapshotCredit{Name: c.Name, Role: c.Role})
+	}
+	for _, c := range p.Categories {
+		s.Category_IDs = append(s.Category_IDs, c.ID)
+	}
+	for _, t := range p.Tags {
+		s.Tags = append(s.Tags, t.Name)
+	}
+	for _, v := range p.Variants {
+		s.Variants = append(s.Variants, VariantSnapshot{
+			ID:        v.ID,
+			Format:    v.Format,
+			ISBN:      v.ISBN,
+			SKU:       v.SKU,
+			Barcode:   v.Barcode,
+			Cents:     v.Cents,
+			Stock:     v.Stock,
+			ImagePath: v.ImagePath,
+			Prices:    v.Prices,
+		})
+	}
+	return s
+}
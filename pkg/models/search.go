@@ -0,0 +1,123 @@
+package models
+
+import "time"
+
+// Facet is one option of a search refinement with how many results it has.
+type Facet struct {
+	Value    string
+	Label    string
+	Count    int
+	Selected bool
+}
+
+type SearchFacets struct {
+	Authors      []Facet
+	Formats      []Facet
+	Prices       []Facet
+	Availability []Facet
+}
+
+// PriceBucket is a price range offered as a search facet. Value and Label are
+// in the shopper's currency; the cents bounds are in the base currency, with
+// zero meaning unbounded.
+type PriceBucket struct {
+	Value    string
+	Label    string
+	MinCents int64
+	MaxCents int64
+}
+
+type SearchResult struct {
+	Query    string
+	Products []Product
+	Page     Pagination
+	Facets   SearchFacets
+	// Fuzzy is set when nothing matched the full-text search and the
+	// results are trigram matches instead
+	Fuzzy bool
+	// DidYouMean is a close title or author to offer when few results came
+	// back, perhaps because of a typo
+	DidYouMean string
+	// Expanded is the query after synonyms were applied, when they changed it
+	Expanded string
+	// Snippets holds each product's ts_headline description excerpt, with
+	// matches wrapped in SnippetStart and SnippetStop
+	Snippets map[int]string
+}
+
+const (
+	SnippetStart = "[[mark]]"
+	SnippetStop  = "[[/mark]]"
+)
+
+// Suggestion kinds returned by search autocomplete.
+const (
+	SuggestTitle    = "title"
+	SuggestAuthor   = "author"
+	SuggestCategory = "category"
+)
+
+// Suggestion is one autocomplete match for a partly typed search.
+type Suggestion struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// SearchLog records one storefront search for the search report.
+type SearchLog struct {
+	ID          string
+	Query       string
+	ResultCount int
+	Fuzzy       bool
+	Visitor_ID  string
+	CreatedAt   time.Time
+}
+
+// SearchClick records a result followed from a search.
+type SearchClick struct {
+	Search_ID  string
+	Product_ID int
+	CreatedAt  time.Time
+}
+
+// QueryStat sums up the searches for one query.
+type QueryStat struct {
+	Query      string
+	Searches   int
+	AvgResults float64
+	Clicks     int
+	Purchases  int
+}
+
+// SearchReport is the admin overview of what customers searched for.
+type SearchReport struct {
+	Since      time.Time
+	Searches   int
+	Clicked    int
+	Purchased  int
+	TopQueries []QueryStat
+	NoResults  []QueryStat
+}
+
+func (r SearchReport) ClickRate() float64 {
+	if r.Searches == 0 {
+		return 0
+	}
+	return float64(r.Clicked) / float64(r.Searches) * 100
+}
+
+func (r SearchReport) ConversionRate() float64 {
+	if r.Searches == 0 {
+		return 0
+	}
+	return float64(r.Purchased) / float64(r.Searches) * 100
+}
+
+// Synonym rewrites Term to Expansion wherever it appears in a search.
+type Synonym struct {
+	ID        int
+	Term      string
+	Expansion string
+	CreatedAt time.Time
+}
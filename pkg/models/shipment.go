@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type Shipment struct {
+	ID             int
+	Order_ID       int
+	Carrier        string
+	TrackingNumber string
+	ShippedAt      time.Time
+	CreatedAt      time.Time
+	//not to be  stored in db
+	TrackingURL string
+	Items       []ShipmentItem
+}
+
+type ShipmentItem struct {
+	Shipment_ID  int
+	OrderItem_ID int
+	Quantity     int
+	//not to be  stored in db
+	ProductTitle  string
+	VariantFormat string
+}
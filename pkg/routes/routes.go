@@ -35,11 +35,17 @@ func SetupRoutes() *mux.Router {
 	// Orders
 	r.HandleFunc("/orders", handlers.OrdersHandler).Methods("GET")
 	r.HandleFunc("/search-orders", handlers.SearchOrdersHandler).Methods("GET")
+	r.HandleFunc("/request-return", handlers.RequestReturnHandler).Methods("POST")
 
 	// Products
 	r.HandleFunc("/products", handlers.ProductListHandler).Methods("GET")
 	r.HandleFunc("/product/{id}", handlers.ProductDetailHandler).Methods("GET")
 	r.HandleFunc("/search-products", handlers.SearchProductsHandler).Methods("GET")
+	r.HandleFunc("/api/search/suggest", handlers.SuggestHandler).Methods("GET")
+	r.HandleFunc("/author/{slug}", handlers.AuthorHandler).Methods("GET")
+	r.HandleFunc("/category/{slug}", handlers.CategoryHandler).Methods("GET")
+	r.HandleFunc("/tag/{slug}", handlers.TagHandler).Methods("GET")
+	r.HandleFunc("/set-currency", handlers.SetCurrencyHandler).Methods("POST")
 
 	// Cart
 	r.HandleFunc("/cart", handlers.CartHandler).Methods("GET")
@@ -47,6 +53,10 @@ func SetupRoutes() *mux.Router {
 	r.HandleFunc("/increment-item", handlers.IncrementItemHandler).Methods("POST")
 	r.HandleFunc("/decrement-item", handlers.DecrementItemHandler).Methods("POST")
 	r.HandleFunc("/remove-item", handlers.RemoveItemHandler).Methods("POST")
+	r.HandleFunc("/apply-promo", handlers.ApplyPromoHandler).Methods("POST")
+	r.HandleFunc("/remove-promo", handlers.RemovePromoHandler).Methods("POST")
+	r.HandleFunc("/apply-gift-card", handlers.ApplyGiftCardHandler).Methods("POST")
+	r.HandleFunc("/remove-gift-card", handlers.RemoveGiftCardHandler).Methods("POST")
 
 	// Payment
 	r.HandleFunc("/cart-checkout", handlers.CreateCartCheckoutSession).Methods("POST")
@@ -67,7 +77,63 @@ func SetupRoutes() *mux.Router {
 	admin.HandleFunc("/update-product", RequireAuth(handlers.UpdateProductHandler)).Methods("POST")
 	admin.HandleFunc("/edit-products", RequireAuth(handlers.EditAllProductssHandler)).Methods("GET")
 	admin.HandleFunc("/edit-product/{id}", RequireAuth(handlers.EditProductFormHandler)).Methods("GET")
+	admin.HandleFunc("/preview/{id}", RequireAuth(handlers.PreviewProductHandler)).Methods("GET")
+	admin.HandleFunc("/product/{id}/revisions", RequireAuth(handlers.ProductRevisionsHandler)).Methods("GET")
+	admin.HandleFunc("/product/{id}/revisions/{revision}/revert", RequireAuth(handlers.RevertProductHandler)).Methods("POST")
 	admin.HandleFunc("/delete-product/{id}", RequireAuth(handlers.DeleteProductFormHandler)).Methods("GET")
+	admin.HandleFunc("/archived", RequireAuth(handlers.AdminArchivedHandler)).Methods("GET")
+	admin.HandleFunc("/product/{id}/archive", RequireAuth(handlers.ArchiveProductHandler)).Methods("POST")
+	admin.HandleFunc("/product/{id}/restore", RequireAuth(handlers.RestoreProductHandler)).Methods("POST")
+	admin.HandleFunc("/product/{id}/purge", RequireAuth(handlers.PurgeProductHandler)).Methods("POST")
+	admin.HandleFunc("/variant/{id}/archive", RequireAuth(handlers.ArchiveVariantHandler)).Methods("POST")
+	admin.HandleFunc("/variant/{id}/restore", RequireAuth(handlers.RestoreVariantHandler)).Methods("POST")
+	admin.HandleFunc("/variant/{id}/purge", RequireAuth(handlers.PurgeVariantHandler)).Methods("POST")
+	admin.HandleFunc("/product/{id}/images", RequireAuth(handlers.AddProductImagesHandler)).Methods("POST")
+	admin.HandleFunc("/product/{id}/images/order", RequireAuth(handlers.ReorderProductImagesHandler)).Methods("POST")
+	admin.HandleFunc("/product-image/{id}", RequireAuth(handlers.ProductImageHandler)).Methods("POST")
+	admin.HandleFunc("/imports", RequireAuth(handlers.AdminImportsHandler)).Methods("GET")
+	admin.HandleFunc("/imports", RequireAuth(handlers.StartImportHandler)).Methods("POST")
+	admin.HandleFunc("/imports/{id}", RequireAuth(handlers.ImportJobHandler)).Methods("GET")
+	admin.HandleFunc("/imports/{id}/status", RequireAuth(handlers.ImportStatusHandler)).Methods("GET")
+	admin.HandleFunc("/imports/{id}/apply", RequireAuth(handlers.ApplyImportHandler)).Methods("POST")
+	admin.HandleFunc("/export.csv", RequireAuth(handlers.ExportCatalogHandler)).Methods("GET")
+	admin.HandleFunc("/locations", RequireAuth(handlers.AdminLocationsHandler)).Methods("GET")
+	admin.HandleFunc("/locations", RequireAuth(handlers.AddLocationHandler)).Methods("POST")
+	admin.HandleFunc("/location/{id}", RequireAuth(handlers.UpdateLocationHandler)).Methods("POST")
+	admin.HandleFunc("/stock/{id}", RequireAuth(handlers.VariantStockHandler)).Methods("GET")
+	admin.HandleFunc("/stock/{id}", RequireAuth(handlers.StockMovementHandler)).Methods("POST")
+	admin.HandleFunc("/stock/{id}/reorder", RequireAuth(handlers.ReorderThresholdHandler)).Methods("POST")
+	admin.HandleFunc("/reorder", RequireAuth(handlers.ReorderReportHandler)).Methods("GET")
+	admin.HandleFunc("/stock-lookup", RequireAuth(handlers.StockLookupHandler)).Methods("GET")
+	admin.HandleFunc("/stock-audit", RequireAuth(handlers.StockAuditHandler)).Methods("GET")
+	admin.HandleFunc("/search-report", RequireAuth(handlers.AdminSearchReportHandler)).Methods("GET")
+	admin.HandleFunc("/synonyms", RequireAuth(handlers.AdminSynonymsHandler)).Methods("GET")
+	admin.HandleFunc("/synonyms", RequireAuth(handlers.AddSynonymHandler)).Methods("POST")
+	admin.HandleFunc("/delete-synonym/{id}", RequireAuth(handlers.DeleteSynonymHandler)).Methods("POST")
+	admin.HandleFunc("/categories", RequireAuth(handlers.AdminCategoriesHandler)).Methods("GET")
+	admin.HandleFunc("/categories", RequireAuth(handlers.AddCategoryHandler)).Methods("POST")
+	admin.HandleFunc("/category/{id}", RequireAuth(handlers.UpdateCategoryHandler)).Methods("POST")
+	admin.HandleFunc("/tags", RequireAuth(handlers.AdminTagsHandler)).Methods("GET")
+	admin.HandleFunc("/delete-tag/{id}", RequireAuth(handlers.DeleteTagHandler)).Methods("POST")
+	admin.HandleFunc("/promotions", RequireAuth(handlers.AdminPromotionsHandler)).Methods("GET")
+	admin.HandleFunc("/promotions", RequireAuth(handlers.AddPromotionHandler)).Methods("POST")
+	admin.HandleFunc("/deactivate-promotion/{id}", RequireAuth(handlers.DeactivatePromotionHandler)).Methods("GET")
+	admin.HandleFunc("/gift-cards", RequireAuth(handlers.AdminGiftCardsHandler)).Methods("GET")
+	admin.HandleFunc("/gift-cards", RequireAuth(handlers.IssueGiftCardHandler)).Methods("POST")
+	admin.HandleFunc("/gift-card/{id}", RequireAuth(handlers.AdminGiftCardHandler)).Methods("GET")
+	admin.HandleFunc("/void-gift-card/{id}", RequireAuth(handlers.VoidGiftCardHandler)).Methods("POST")
+	admin.HandleFunc("/exchange-rates", RequireAuth(handlers.AdminExchangeRatesHandler)).Methods("GET")
+	admin.HandleFunc("/exchange-rates", RequireAuth(handlers.UpdateExchangeRateHandler)).Methods("POST")
+	admin.HandleFunc("/orders", RequireAuth(handlers.AdminOrdersHandler)).Methods("GET")
+	admin.HandleFunc("/order/{id}", RequireAuth(handlers.AdminOrderHandler)).Methods("GET")
+	admin.HandleFunc("/order/{id}/invoice", RequireAuth(handlers.InvoiceHandler)).Methods("GET")
+	admin.HandleFunc("/order/{id}/packing-slip", RequireAuth(handlers.PackingSlipHandler)).Methods("GET")
+	admin.HandleFunc("/order/{id}/shipments", RequireAuth(handlers.CreateShipmentHandler)).Methods("POST")
+	admin.HandleFunc("/order/{id}/delivered", RequireAuth(handlers.MarkDeliveredHandler)).Methods("POST")
+	admin.HandleFunc("/returns", RequireAuth(handlers.AdminReturnsHandler)).Methods("GET")
+	admin.HandleFunc("/return/{id}", RequireAuth(handlers.AdminReturnHandler)).Methods("GET")
+	admin.HandleFunc("/return/{id}", RequireAuth(handlers.ReturnActionHandler)).Methods("POST")
+	admin.HandleFunc("/packing-slips", RequireAuth(handlers.BatchPackingSlipsHandler)).Methods("GET")
 
 	return r
 }
@@ -0,0 +1,20 @@
+-- Prices are stored in the base currency (CAD) on variants. Other currencies
+-- use an explicit per-variant price when one exists, otherwise the base price
+-- converted with the exchange rate below.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency TEXT PRIMARY KEY,
+    rate NUMERIC(12, 6) NOT NULL CHECK (rate > 0),
+    charm_pricing BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS variant_prices (
+    variant_id INTEGER NOT NULL REFERENCES variants(id) ON DELETE CASCADE,
+    currency TEXT NOT NULL,
+    cents INTEGER NOT NULL CHECK (cents >= 0),
+    PRIMARY KEY (variant_id, currency)
+);
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'CAD';
+
+INSERT INTO exchange_rates (currency, rate, charm_pricing) VALUES ('USD', 0.73, TRUE) ON CONFLICT DO NOTHING;
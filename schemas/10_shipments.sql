@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS shipments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    carrier TEXT NOT NULL,
+    tracking_number TEXT NOT NULL DEFAULT '',
+    shipped_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- An order item can be split across several shipments for partial fulfilment
+CREATE TABLE IF NOT EXISTS shipment_items (
+    shipment_id INTEGER NOT NULL REFERENCES shipments(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (shipment_id, order_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments (order_id);
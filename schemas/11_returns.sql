@@ -0,0 +1,28 @@
+-- Needed to refund an order through Stripe
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_intent_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS returns (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    rma_number TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'requested'
+        CHECK (status IN ('requested', 'approved', 'rejected', 'received', 'refunded', 'credited')),
+    reason TEXT NOT NULL,
+    admin_note TEXT NOT NULL DEFAULT '',
+    refund_cents INTEGER NOT NULL DEFAULT 0,
+    stripe_refund_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS return_items (
+    id SERIAL PRIMARY KEY,
+    return_id INTEGER NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    resellable BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (return_id, order_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_returns_order_id ON returns (order_id);
+CREATE INDEX IF NOT EXISTS idx_returns_status ON returns (status);
@@ -0,0 +1,38 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS product_type TEXT NOT NULL DEFAULT 'book'
+    CHECK (product_type IN ('book', 'gift_card'));
+
+-- Gift cards and store credit accounts share one ledger. A card's balance is
+-- never stored; it is the sum of its entries.
+CREATE TABLE IF NOT EXISTS gift_cards (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL CHECK (kind IN ('gift_card', 'store_credit')),
+    currency TEXT NOT NULL DEFAULT 'CAD',
+    email TEXT NOT NULL DEFAULT '',
+    order_id INTEGER REFERENCES orders(id),
+    note TEXT NOT NULL DEFAULT '',
+    voided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Each customer has one store credit account per currency
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gift_cards_store_credit
+    ON gift_cards (LOWER(email), currency) WHERE kind = 'store_credit';
+
+CREATE TABLE IF NOT EXISTS gift_card_entries (
+    id SERIAL PRIMARY KEY,
+    gift_card_id INTEGER NOT NULL REFERENCES gift_cards(id) ON DELETE CASCADE,
+    entry_type TEXT NOT NULL CHECK (entry_type IN ('issue', 'credit', 'redeem', 'release', 'void')),
+    cents INTEGER NOT NULL CHECK (cents <> 0),
+    order_id INTEGER REFERENCES orders(id),
+    return_id INTEGER REFERENCES returns(id),
+    -- Ties a redemption to the Stripe checkout it was held for
+    hold_reference TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_card_entries_card ON gift_card_entries (gift_card_id);
+CREATE INDEX IF NOT EXISTS idx_gift_card_entries_hold ON gift_card_entries (hold_reference) WHERE hold_reference <> '';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS gift_card_cents INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,59 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS publisher TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS publication_date DATE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT 'en';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS page_count INTEGER NOT NULL DEFAULT 0 CHECK (page_count >= 0);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS series_volume INTEGER NOT NULL DEFAULT 0 CHECK (series_volume >= 0);
+
+CREATE INDEX IF NOT EXISTS trgm_idx_publisher ON products USING GIN (publisher gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS trgm_idx_series ON products USING GIN (series gin_trgm_ops);
+
+-- Variants used to be split by color; for books the dimension is the format.
+-- 02_variants.sql and 03_orders.sql still create the old column names.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'variants' AND column_name = 'color') THEN
+        ALTER TABLE variants RENAME COLUMN color TO format;
+    END IF;
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'order_items' AND column_name = 'variant_color') THEN
+        ALTER TABLE order_items RENAME COLUMN variant_color TO variant_format;
+    END IF;
+END $$;
+
+ALTER INDEX IF EXISTS trgm_idx_color RENAME TO trgm_idx_format;
+CREATE INDEX IF NOT EXISTS trgm_idx_format ON variants USING GIN (format gin_trgm_ops);
+
+-- Known spellings are mapped to a format. Anything else stops the migration
+-- rather than guessing, so fix those variants by hand and run it again.
+UPDATE variants SET format = CASE LOWER(TRIM(format))
+    WHEN 'hardback' THEN 'hardcover'
+    WHEN 'softcover' THEN 'paperback'
+    WHEN 'trade paperback' THEN 'paperback'
+    WHEN 'mass market paperback' THEN 'paperback'
+    WHEN 'e-book' THEN 'ebook'
+    WHEN 'digital' THEN 'ebook'
+    ELSE LOWER(TRIM(format))
+END
+WHERE format <> LOWER(TRIM(format))
+   OR LOWER(TRIM(format)) IN ('hardback', 'softcover', 'trade paperback', 'mass market paperback', 'e-book', 'digital');
+
+DO $$
+DECLARE
+    unknown TEXT;
+BEGIN
+    SELECT string_agg(DISTINCT format, ', ') INTO unknown
+    FROM variants WHERE format NOT IN ('hardcover', 'paperback', 'ebook');
+    IF unknown IS NOT NULL THEN
+        RAISE EXCEPTION 'variants have formats other than hardcover, paperback or ebook: %', unknown;
+    END IF;
+
+    ALTER TABLE variants DROP CONSTRAINT IF EXISTS variants_format_check;
+    ALTER TABLE variants ADD CONSTRAINT variants_format_check
+        CHECK (format IN ('hardcover', 'paperback', 'ebook'));
+END $$;
+
+-- ISBNs are stored as ISBN-13 digits; ISBN-10s are converted on save
+ALTER TABLE variants ADD COLUMN IF NOT EXISTS isbn TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_variants_isbn ON variants (isbn) WHERE isbn <> '';
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS authors (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    bio TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authors_name ON authors (LOWER(name));
+CREATE INDEX IF NOT EXISTS trgm_idx_authors_name ON authors USING GIN (name gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS product_contributors (
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES authors(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'author'
+        CHECK (role IN ('author', 'editor', 'translator', 'illustrator')),
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (product_id, author_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_contributors_author ON product_contributors (author_id);
+
+-- products.author stays as the display byline (and feeds the search vector);
+-- it is rewritten from product_contributors whenever contributors are saved.
+-- Existing bylines are split on "and", "&" and ";" into separate authors.
+WITH names AS (
+    SELECT p.id AS product_id, TRIM(n.name) AS name, n.position
+    FROM products p
+    CROSS JOIN LATERAL regexp_split_to_table(p.author, '\s+(?:and|&)\s+|\s*;\s*')
+        WITH ORDINALITY AS n(name, position)
+    WHERE TRIM(p.author) <> ''
+      AND NOT EXISTS (SELECT 1 FROM product_contributors pc WHERE pc.product_id = p.id)
+), new_authors AS (
+    INSERT INTO authors (name, slug)
+    SELECT DISTINCT ON (LOWER(name)) name,
+           COALESCE(NULLIF(TRIM(BOTH '-' FROM LOWER(regexp_replace(name, '[^a-zA-Z0-9]+', '-', 'g'))), ''),
+                    'author-' || LEFT(md5(name), 8))
+    FROM names
+    WHERE name <> ''
+    ON CONFLICT DO NOTHING
+    RETURNING id, name
+)
+INSERT INTO product_contributors (product_id, author_id, role, position)
+SELECT n.product_id, COALESCE(na.id, a.id), 'author', n.position - 1
+FROM names n
+LEFT JOIN new_authors na ON LOWER(na.name) = LOWER(n.name)
+LEFT JOIN authors a ON LOWER(a.name) = LOWER(n.name)
+WHERE COALESCE(na.id, a.id) IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Sorting and filtering for the product listing
+CREATE INDEX IF NOT EXISTS idx_products_created_at ON products (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_products_title ON products (title, id);
+CREATE INDEX IF NOT EXISTS idx_variants_product_cents ON variants (product_id, cents);
@@ -0,0 +1,27 @@
+-- Every storefront search, written in batches by the search logger. The ID
+-- is made up before the row is written so result links can carry it.
+CREATE TABLE IF NOT EXISTS search_logs (
+    id TEXT PRIMARY KEY,
+    query TEXT NOT NULL,
+    result_count INTEGER NOT NULL,
+    fuzzy BOOLEAN NOT NULL DEFAULT FALSE,
+    visitor_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Results followed from a search. No foreign key: a click can be written in
+-- the same batch as its search, and searches dropped under load leave orphans.
+CREATE TABLE IF NOT EXISTS search_clicks (
+    id BIGSERIAL PRIMARY KEY,
+    search_id TEXT NOT NULL,
+    product_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_logs_created_at ON search_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_search_logs_visitor ON search_logs (visitor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_search_clicks_search_id ON search_clicks (search_id);
+
+-- Ties orders to the browser that searched, for search-to-purchase conversion
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS visitor_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_orders_visitor ON orders (visitor_id, created_at) WHERE visitor_id <> '';
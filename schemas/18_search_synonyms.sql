@@ -0,0 +1,9 @@
+-- Admin-managed rewrites applied to search queries, e.g. lotr -> lord of the rings
+CREATE TABLE IF NOT EXISTS search_synonyms (
+    id SERIAL PRIMARY KEY,
+    term TEXT NOT NULL,
+    expansion TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_search_synonyms_term ON search_synonyms (LOWER(term));
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS product_images (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    -- Shown only when this variant is chosen; NULL for every variant
+    variant_id INTEGER REFERENCES variants(id) ON DELETE CASCADE,
+    image_path TEXT NOT NULL,
+    alt_text TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_images_product ON product_images (product_id, position);
+CREATE INDEX IF NOT EXISTS idx_product_images_path ON product_images (image_path);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_images_primary ON product_images (product_id) WHERE is_primary;
+
+-- Start each gallery with the images variants already have, the first
+-- variant's being the primary one
+INSERT INTO product_images (product_id, variant_id, image_path, alt_text, position, is_primary)
+SELECT v.product_id, v.id, v.image_path, p.title || ' (' || v.format || ')',
+       ROW_NUMBER() OVER (PARTITION BY v.product_id ORDER BY v.id) - 1,
+       ROW_NUMBER() OVER (PARTITION BY v.product_id ORDER BY v.id) = 1
+FROM variants v
+JOIN products p ON p.id = v.product_id
+WHERE v.image_path <> ''
+  AND NOT EXISTS (SELECT 1 FROM product_images pi WHERE pi.product_id = v.product_id);
@@ -0,0 +1,35 @@
+-- Stock keeping units identify variants that have no ISBN, such as gift
+-- cards, and let catalog imports match rows to them.
+ALTER TABLE variants ADD COLUMN IF NOT EXISTS sku TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_variants_sku ON variants (sku) WHERE sku <> '';
+
+-- Catalog imports run in the background. The uploaded file is kept so a dry
+-- run can be applied once its preview has been checked.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id SERIAL PRIMARY KEY,
+    format TEXT NOT NULL CHECK (format IN ('csv', 'onix')),
+    filename TEXT NOT NULL DEFAULT '',
+    data BYTEA NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'done', 'failed')),
+    total INTEGER NOT NULL DEFAULT 0,
+    processed INTEGER NOT NULL DEFAULT 0,
+    created INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- What happened to each row of an import, or would have in a dry run
+CREATE TABLE IF NOT EXISTS import_job_rows (
+    job_id INTEGER NOT NULL REFERENCES import_jobs(id) ON DELETE CASCADE,
+    line INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'error')),
+    key TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (job_id, line)
+);
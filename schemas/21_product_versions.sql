@@ -0,0 +1,4 @@
+-- Bumped on every save of a product through the admin or an import. The edit
+-- form sends back the version it loaded, and a save is refused when the
+-- product has changed since, so two editors can't overwrite each other.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
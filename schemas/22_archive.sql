@@ -0,0 +1,9 @@
+-- Archived products and variants are hidden from the storefront but kept,
+-- since order items still point at them. Only items no order refers to can
+-- be purged for good.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+ALTER TABLE variants ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_products_archived ON products (archived_at) WHERE archived_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_variants_archived ON variants (product_id) WHERE archived_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_order_items_variant ON order_items (variant_id);
@@ -0,0 +1,21 @@
+-- Only published products are shown in the storefront. A scheduled product
+-- is published by the scheduler once publish_at has passed. Products that
+-- existed before publication states were added stay published.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published', 'unpublished'));
+ALTER TABLE products ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+
+-- publish_at was first a TIMESTAMP holding the app's local time, compared
+-- with the database's NOW(). Those times are read in the database's time
+-- zone; reschedule anything due soon if the app ran in another one.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'products' AND column_name = 'publish_at'
+                 AND data_type = 'timestamp without time zone') THEN
+        ALTER TABLE products ALTER COLUMN publish_at TYPE TIMESTAMPTZ
+            USING publish_at AT TIME ZONE current_setting('TimeZone');
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_products_scheduled ON products (publish_at) WHERE status = 'scheduled';
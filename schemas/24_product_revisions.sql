@@ -0,0 +1,12 @@
+-- A snapshot of a product and its variants is kept for every save through
+-- the admin, under the version that save produced, so editors can compare
+-- earlier versions and revert to one.
+CREATE TABLE IF NOT EXISTS product_revisions (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (product_id, version)
+);
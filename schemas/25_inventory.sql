@@ -0,0 +1,55 @@
+-- EAN-13 barcodes, with UPC-A codes stored with a leading zero, so a scan
+-- finds the variant whichever was printed.
+ALTER TABLE variants ADD COLUMN IF NOT EXISTS barcode TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_variants_barcode ON variants (barcode) WHERE barcode <> '';
+
+-- Places stock is kept. Only stock at sellable locations counts towards what
+-- the storefront offers; consignment stock held elsewhere usually doesn't.
+CREATE TABLE IF NOT EXISTS locations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL CHECK (kind IN ('warehouse', 'shop', 'consignment')),
+    sellable BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO locations (name, kind)
+SELECT 'Warehouse', 'warehouse'
+WHERE NOT EXISTS (SELECT 1 FROM locations);
+
+CREATE TABLE IF NOT EXISTS stock_transfers (
+    id SERIAL PRIMARY KEY,
+    variant_id INTEGER NOT NULL REFERENCES variants(id) ON DELETE CASCADE,
+    from_location_id INTEGER NOT NULL REFERENCES locations(id),
+    to_location_id INTEGER NOT NULL REFERENCES locations(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_location_id <> to_location_id)
+);
+
+-- The stock ledger. The quantity at a location is the sum of its movements,
+-- and variants.stock is kept as the sum over sellable locations, never below
+-- zero, by the code that records movements.
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id SERIAL PRIMARY KEY,
+    variant_id INTEGER NOT NULL REFERENCES variants(id) ON DELETE CASCADE,
+    location_id INTEGER NOT NULL REFERENCES locations(id),
+    kind TEXT NOT NULL CHECK (kind IN ('receipt', 'sale', 'adjustment', 'return', 'transfer')),
+    quantity INTEGER NOT NULL CHECK (quantity <> 0),
+    order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+    return_id INTEGER REFERENCES returns(id) ON DELETE SET NULL,
+    transfer_id INTEGER REFERENCES stock_transfers(id) ON DELETE CASCADE,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_variant ON stock_movements (variant_id, location_id);
+
+-- Stock held before the ledger existed becomes an opening balance at the
+-- first location.
+INSERT INTO stock_movements (variant_id, location_id, kind, quantity, note)
+SELECT v.id, (SELECT MIN(id) FROM locations), 'adjustment', v.stock, 'Opening balance'
+FROM variants v
+WHERE v.stock > 0
+  AND NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.variant_id = v.id);
@@ -0,0 +1,10 @@
+-- A variant is due for reordering when its stock falls below its reorder
+-- threshold; zero means it is never reordered. low_stock_alerted_at is set
+-- when admins were told, and cleared once stock is back up, so each dip
+-- sends one alert.
+ALTER TABLE variants ADD COLUMN IF NOT EXISTS reorder_threshold INTEGER NOT NULL DEFAULT 0
+    CHECK (reorder_threshold >= 0);
+ALTER TABLE variants ADD COLUMN IF NOT EXISTS low_stock_alerted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_variants_reorder ON variants (product_id) WHERE reorder_threshold > 0;
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders (created_at);
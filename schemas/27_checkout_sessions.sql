@@ -0,0 +1,4 @@
+-- Stripe can deliver checkout.session.completed more than once; each
+-- checkout session makes at most one order.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_session_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_checkout_session ON orders (checkout_session_id);
@@ -0,0 +1,5 @@
+-- A return is claimed as refunding before the Stripe refund is made, so two
+-- submits can't both refund it.
+ALTER TABLE returns DROP CONSTRAINT IF EXISTS returns_status_check;
+ALTER TABLE returns ADD CONSTRAINT returns_status_check
+    CHECK (status IN ('requested', 'approved', 'rejected', 'received', 'refunding', 'refunded', 'credited'));
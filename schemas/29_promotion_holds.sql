@@ -0,0 +1,9 @@
+-- A checkout reserves one use of its promotion code when the Stripe session
+-- is created, so concurrent checkouts can't go past the usage limit. The hold
+-- is claimed by the order, or given back when the checkout expires.
+CREATE TABLE IF NOT EXISTS promotion_holds (
+    reference TEXT PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+    order_id INTEGER REFERENCES orders(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
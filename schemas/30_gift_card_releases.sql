@@ -0,0 +1,4 @@
+-- A hold is released at most once, even when the expired checkout webhook
+-- and another release run at the same time.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gift_card_entries_release
+    ON gift_card_entries (hold_reference) WHERE entry_type = 'release';
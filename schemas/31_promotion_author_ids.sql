@@ -0,0 +1,29 @@
+-- Author eligibility used to be stored by name, from before products had
+-- contributors. Match the names to authors and key the rows by author ID.
+-- A promotion whose authors can't all be matched is deactivated rather than
+-- left to cover more than it was meant to.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'promotion_authors' AND column_name = 'author'
+    ) THEN
+        ALTER TABLE promotion_authors ADD COLUMN IF NOT EXISTS author_id INTEGER REFERENCES authors(id) ON DELETE CASCADE;
+
+        UPDATE promotion_authors pa SET author_id = a.id
+        FROM authors a
+        WHERE LOWER(a.name) = LOWER(TRIM(pa.author));
+
+        UPDATE promotions SET active = FALSE
+        WHERE id IN (SELECT promotion_id FROM promotion_authors WHERE author_id IS NULL);
+
+        DELETE FROM promotion_authors WHERE author_id IS NULL;
+        DELETE FROM promotion_authors a USING promotion_authors b
+        WHERE a.promotion_id = b.promotion_id AND a.author_id = b.author_id AND a.ctid > b.ctid;
+
+        ALTER TABLE promotion_authors DROP CONSTRAINT IF EXISTS promotion_authors_pkey;
+        ALTER TABLE promotion_authors DROP COLUMN author;
+        ALTER TABLE promotion_authors ALTER COLUMN author_id SET NOT NULL;
+        ALTER TABLE promotion_authors ADD PRIMARY KEY (promotion_id, author_id);
+    END IF;
+END $$;
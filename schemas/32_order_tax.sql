@@ -0,0 +1,4 @@
+-- GST is charged as its own line at checkout and stored as charged, so
+-- invoices print the tax that was actually paid. Orders from before it was
+-- charged keep 0.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_cents INTEGER NOT NULL DEFAULT 0;